@@ -9,60 +9,29 @@ import (
 	"github.com/danielhep/go-elections/internal"
 )
 
-func initalLoad(db *internal.DB) error {
+// Function to check for updates. Every attempt is recorded as an IngestRun.
+func checkForUpdates(store internal.Store, election *internal.Election) error {
 	stateURL := os.Getenv("STATE_DATA")
 	countyURL := os.Getenv("COUNTY_DATA")
-	election, err := db.GetElection()
-	if err != nil {
-		return fmt.Errorf("error getting election: %v", err)
-	}
-	data, hash, err := internal.ParseFromURL(stateURL, internal.StateJurisdiction)
-	if err != nil {
-		return fmt.Errorf("error scraping %s data: %v", internal.StateJurisdiction, err)
-	}
-	if err := db.LoadBallotResponses(data, *election); err != nil {
-		return err
-	}
-	if err := db.CheckAndProcessUpdate(data, hash, internal.StateJurisdiction, *election); err != nil {
-		return err
-	}
+	// The state's per-county results and the county's precinct results, optional
+	stateCountiesURL := os.Getenv("STATE_COUNTY_DATA")
+	precinctURL := os.Getenv("PRECINCT_DATA")
 
-	data, hash, err = internal.ParseFromURL(countyURL, internal.CountyJurisdiction)
-	if err != nil {
-		return fmt.Errorf("error scraping %s data: %v", internal.CountyJurisdiction, err)
-	}
-	if err := db.LoadBallotResponses(data, *election); err != nil {
-		return err
-	}
-	if err := db.CheckAndProcessUpdate(data, hash, internal.CountyJurisdiction, *election); err != nil {
+	if err := internal.IngestURL(store, stateURL, internal.StateJurisdiction, *election); err != nil {
 		return err
 	}
-	return nil
-}
-
-// Function to check for updates
-func checkForUpdates(db *internal.DB) error {
-	stateURL := os.Getenv("STATE_DATA")
-	countyURL := os.Getenv("COUNTY_DATA")
-	election, err := db.GetElection()
-	if err != nil {
-		return fmt.Errorf("error getting election: %v", err)
-	}
-
-	data, hash, err := internal.ParseFromURL(stateURL, internal.StateJurisdiction)
-	if err != nil {
-		return fmt.Errorf("error scraping %s data: %v", internal.StateJurisdiction, err)
+	if stateCountiesURL != "" {
+		if err := internal.IngestURL(store, stateCountiesURL, internal.StateJurisdiction, *election); err != nil {
+			return err
+		}
 	}
-	if err := db.CheckAndProcessUpdate(data, hash, internal.StateJurisdiction, *election); err != nil {
+	if err := internal.IngestURL(store, countyURL, internal.CountyJurisdiction, *election); err != nil {
 		return err
 	}
-
-	data, hash, err = internal.ParseFromURL(countyURL, internal.CountyJurisdiction)
-	if err != nil {
-		return fmt.Errorf("error scraping %s data: %v", internal.CountyJurisdiction, err)
-	}
-	if err := db.CheckAndProcessUpdate(data, hash, internal.CountyJurisdiction, *election); err != nil {
-		return err
+	if precinctURL != "" {
+		if err := internal.IngestURL(store, precinctURL, internal.PrecinctJurisdiction, *election); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -74,6 +43,10 @@ func main() {
 	if pgURL == "" {
 		log.Fatal("PG_URL environment variable is not set")
 	}
+	electionSlug := os.Getenv("ELECTION")
+	if electionSlug == "" {
+		log.Fatal("ELECTION environment variable is not set")
+	}
 
 	// Connect to the database
 	db, err := internal.NewDB(pgURL)
@@ -87,13 +60,29 @@ func main() {
 		log.Fatalf("Failed to migrate database schema: %v", err)
 	}
 
+	// Look up the election in the registry, see `elections create`
+	election, err := db.FindElection(electionSlug)
+	if err != nil {
+		log.Fatalf("Failed to find election: %v", err)
+	}
+
+	// Unchanged and failed runs are pruned hourly after INGEST_RUN_RETENTION
+	retention := 7 * 24 * time.Hour
+	if v := os.Getenv("INGEST_RUN_RETENTION"); v != "" {
+		if retention, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid INGEST_RUN_RETENTION: %v", err)
+		}
+	}
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
+
 	// Set up a ticker to periodically check for updates
 	updateInterval := time.Second
 	ticker := time.NewTicker(updateInterval)
 	defer ticker.Stop()
 
 	// Run the first check immediately
-	if err := initalLoad(db); err != nil {
+	if err := checkForUpdates(db, election); err != nil {
 		log.Printf("Error checking for updates: %v", err)
 	}
 
@@ -104,9 +93,15 @@ func main() {
 		for {
 			select {
 			case <-ticker.C:
-				if err := checkForUpdates(db); err != nil {
+				if err := checkForUpdates(db, election); err != nil {
 					log.Printf("Error checking for updates: %v", err)
 				}
+			case <-pruneTicker.C:
+				if count, err := db.PruneIngestRuns(time.Now().Add(-retention)); err != nil {
+					log.Printf("Error pruning ingest runs: %v", err)
+				} else if count > 0 {
+					log.Printf("Pruned %v ingest runs", count)
+				}
 			case <-done:
 				return
 			}
@@ -0,0 +1,1226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danielhep/go-elections/internal"
+	"github.com/urfave/cli/v2"
+)
+
+func main() {
+	app := &cli.App{
+		Name:  "elections",
+		Usage: "Manage the registry of elections used by the scraper, importer and web app",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "db",
+				Usage:    "Database URL (postgres://... or sqlite://path/to/file.db)",
+				EnvVars:  []string{"PG_URL"},
+				Required: true,
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Register a new election",
+				ArgsUsage: "<slug>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "Name of the election (2024 Primary)",
+						Aliases:  []string{"n"},
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "date",
+						Usage:    "Election date (YYYY-MM-DD)",
+						Aliases:  []string{"d"},
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "type",
+						Usage:    "Election type (primary, general or special)",
+						Aliases:  []string{"t"},
+						Required: true,
+					},
+					&cli.Float64Flag{
+						Name:  "turnout",
+						Usage: "Expected final turnout as a percentage of registered voters, used to estimate the ballots left to count",
+					},
+					&cli.BoolFlag{
+						Name:  "top-two",
+						Usage: "Mark a primary as top-two, where the first two candidates in each contest advance",
+					},
+				},
+				Action: createElection,
+			},
+			{
+				Name:  "list",
+				Usage: "List registered elections",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Usage:   "Include archived elections",
+						Aliases: []string{"a"},
+					},
+				},
+				Action: listElections,
+			},
+			{
+				Name:      "rename",
+				Usage:     "Change the display name of an election",
+				ArgsUsage: "<slug> <name>",
+				Action:    renameElection,
+			},
+			{
+				Name:      "turnout",
+				Usage:     "Set the expected final turnout, as a percentage of registered voters",
+				ArgsUsage: "<slug> <percent>",
+				Action:    setTurnout,
+			},
+			{
+				Name:      "top-two",
+				Usage:     "Mark a primary as top-two, or not with --off",
+				ArgsUsage: "<slug>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "off",
+						Usage: "Unmark the election",
+					},
+				},
+				Action: setTopTwo,
+			},
+			{
+				Name:      "certify",
+				Usage:     "Record that an election's results were certified, or clear it with --undo",
+				ArgsUsage: "<slug>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "date",
+						Usage:   "Certification date (YYYY-MM-DD), today if not set",
+						Aliases: []string{"d"},
+					},
+					&cli.BoolFlag{
+						Name:  "undo",
+						Usage: "Clear the certification",
+					},
+				},
+				Action: certifyElection,
+			},
+			{
+				Name:      "archive",
+				Usage:     "Hide an election from the main listing without deleting its data",
+				ArgsUsage: "<slug>",
+				Action:    setStatus(internal.ArchivedElection),
+			},
+			{
+				Name:      "unarchive",
+				Usage:     "Return an archived election to the main listing",
+				ArgsUsage: "<slug>",
+				Action:    setStatus(internal.ActiveElection),
+			},
+			{
+				Name:      "compact",
+				Usage:     "Remove stored tallies that repeat the previous update's numbers",
+				ArgsUsage: "<slug>",
+				Action:    compactElection,
+			},
+			{
+				Name:      "contests",
+				Usage:     "List an election's contests with their categories and levels",
+				ArgsUsage: "<slug>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "category",
+						Usage: "Only contests of this category (" + contestCategoryNames() + ")",
+					},
+					&cli.StringFlag{
+						Name:  "level",
+						Usage: "Only contests at this level (" + contestLevelNames() + ")",
+					},
+				},
+				Action: listContests,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "classify",
+						Usage:     "Classify an election's contests again with the rules in CONTEST_RULES",
+						ArgsUsage: "<slug>",
+						Action:    classifyContests,
+					},
+				},
+			},
+			{
+				Name:      "backtest",
+				Usage:     "Score the projection model against the county drops of stored elections",
+				ArgsUsage: "[slug...]",
+				Action:    backtest,
+			},
+			{
+				Name:  "updates",
+				Usage: "Inspect, retract and restore an election's updates",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "list",
+						Usage:     "List an election's updates, including retracted ones",
+						ArgsUsage: "<slug>",
+						Action:    listUpdates,
+					},
+					{
+						Name:      "retract",
+						Usage:     "Hide an update from results while keeping it for auditing",
+						ArgsUsage: "<update id>",
+						Flags:     updateEventFlags(true),
+						Action:    retractUpdate,
+					},
+					{
+						Name:      "restore",
+						Usage:     "Make a retracted update visible again",
+						ArgsUsage: "<update id>",
+						Flags:     updateEventFlags(false),
+						Action:    restoreUpdate,
+					},
+					{
+						Name:      "history",
+						Usage:     "Show who retracted or restored an update and why",
+						ArgsUsage: "<update id>",
+						Action:    updateHistory,
+					},
+				},
+			},
+			{
+				Name:  "runs",
+				Usage: "Browse the scraper and importer's attempts at loading files",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "election",
+						Usage:   "Only show runs for this election",
+						Aliases: []string{"e"},
+					},
+					&cli.StringFlag{
+						Name:  "outcome",
+						Usage: "Only show runs with this outcome (new_update, unchanged or failed)",
+					},
+					&cli.IntFlag{
+						Name:    "limit",
+						Usage:   "Number of runs to show",
+						Aliases: []string{"n"},
+						Value:   50,
+					},
+				},
+				Action: listIngestRuns,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "Show the details, error, warnings and recount margins of a run",
+						ArgsUsage: "<run id>",
+						Action:    showIngestRun,
+					},
+					{
+						Name:  "prune",
+						Usage: "Delete unchanged and failed runs last seen before a cutoff, keeping the ones that loaded an update",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "older-than",
+								Usage: "Age of the runs to delete",
+								Value: 7 * 24 * time.Hour,
+							},
+						},
+						Action: pruneIngestRuns,
+					},
+				},
+			},
+			{
+				Name:      "candidates",
+				Usage:     "List candidates across elections",
+				ArgsUsage: "[name]",
+				Action:    listCandidates,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "Show the contests a candidate ran in and their ballot response IDs",
+						ArgsUsage: "<candidate slug>",
+						Action:    showCandidate,
+					},
+					{
+						Name:      "merge",
+						Usage:     "Treat two candidates as the same person",
+						ArgsUsage: "<from slug> <into slug>",
+						Action:    mergeCandidates,
+					},
+					{
+						Name:      "split",
+						Usage:     "Move some of a candidate's ballot responses to a new candidate",
+						ArgsUsage: "<candidate slug> <ballot response id>...",
+						Action:    splitCandidate,
+					},
+				},
+			},
+			{
+				Name:      "districts",
+				Usage:     "List the districts contests are grouped by, with their types and parents",
+				ArgsUsage: "[name]",
+				Action:    listDistricts,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "type",
+						Usage:     "Change the type of a district (" + districtTypeNames() + ")",
+						ArgsUsage: "<district> <type>",
+						Action:    setDistrictType,
+					},
+					{
+						Name:      "parent",
+						Usage:     "Set the district a district is part of",
+						ArgsUsage: "<district> <parent>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "clear",
+								Usage: "Remove the district's parent instead",
+							},
+						},
+						Action: setDistrictParent,
+					},
+				},
+			},
+			{
+				Name:   "parties",
+				Usage:  "List the parties candidates are linked to, with their aliases and colors",
+				Action: listParties,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "merge",
+						Usage:     "Merge a party into another, making its name an alias",
+						ArgsUsage: "<from> <into>",
+						Action:    mergeParties,
+					},
+					{
+						Name:      "set",
+						Usage:     "Change a party's abbreviation or color",
+						ArgsUsage: "<party>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "abbreviation",
+								Usage:   "Short name, like D or NPP",
+								Aliases: []string{"a"},
+							},
+							&cli.StringFlag{
+								Name:    "color",
+								Usage:   "Hex color used in charts and maps, like #2563EB",
+								Aliases: []string{"c"},
+							},
+						},
+						Action: updateParty,
+					},
+				},
+			},
+			{
+				Name:      "boundaries",
+				Usage:     "List the boundaries loaded for an election's results maps",
+				ArgsUsage: "<slug>",
+				Action:    listBoundaries,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "load",
+						Usage:     "Load a GeoJSON file of boundaries, replacing those of the same kind",
+						ArgsUsage: "<slug> <file.geojson>",
+						Flags: []cli.Flag{
+							boundaryKindFlag,
+							&cli.StringFlag{
+								Name:     "name-property",
+								Usage:    "Feature property holding the precinct name, district number or county",
+								Aliases:  []string{"p"},
+								Required: true,
+							},
+						},
+						Action: loadBoundaries,
+					},
+					{
+						Name:      "delete",
+						Usage:     "Delete an election's boundaries of one kind",
+						ArgsUsage: "<slug>",
+						Flags:     []cli.Flag{boundaryKindFlag},
+						Action:    deleteBoundaries,
+					},
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "Permanently delete an election and all of its results",
+				ArgsUsage: "<slug>",
+				Action:    deleteElection,
+			},
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func openDB(c *cli.Context) (*internal.DB, error) {
+	db, err := internal.NewDB(c.String("db"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	if err := db.MigrateSchema(); err != nil {
+		return nil, fmt.Errorf("failed to migrate schema: %v", err)
+	}
+	return db, nil
+}
+
+func slugArg(c *cli.Context) (string, error) {
+	slug := c.Args().Get(0)
+	if slug == "" {
+		return "", fmt.Errorf("election slug is required")
+	}
+	return slug, nil
+}
+
+func createElection(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	electionDate, err := time.Parse("2006-01-02", c.String("date"))
+	if err != nil {
+		return fmt.Errorf("failed to parse election date: %v", err)
+	}
+	electionType, err := internal.ParseElectionType(c.String("type"))
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+
+	election := internal.Election{
+		ID:              slug,
+		Name:            c.String("name"),
+		ElectionDate:    electionDate,
+		Type:            electionType,
+		ExpectedTurnout: c.Float64("turnout"),
+		TopTwo:          c.Bool("top-two"),
+	}
+	if err := db.CreateElection(&election); err != nil {
+		return err
+	}
+	fmt.Printf("Created election %s (%s)\n", election.ID, election.Name)
+	return nil
+}
+
+func listElections(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	elections, err := db.ListElections(c.Bool("all"))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tNAME\tDATE\tTYPE\tSTATUS\tCERTIFIED")
+	for _, election := range elections {
+		certified := "-"
+		if election.CertifiedAt != nil {
+			certified = election.CertifiedAt.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			election.ID,
+			election.Name,
+			election.ElectionDate.Format("2006-01-02"),
+			election.Type,
+			election.Status,
+			certified,
+		)
+	}
+	return w.Flush()
+}
+
+func renameElection(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	name := c.Args().Get(1)
+	if name == "" {
+		return fmt.Errorf("new election name is required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.RenameElection(slug, name); err != nil {
+		return err
+	}
+	fmt.Printf("Renamed election %s to %s\n", slug, name)
+	return nil
+}
+
+func setTurnout(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	percent, err := strconv.ParseFloat(c.Args().Get(1), 64)
+	if err != nil {
+		return fmt.Errorf("expected turnout percentage is required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.SetExpectedTurnout(slug, percent); err != nil {
+		return err
+	}
+	fmt.Printf("Set the expected turnout of %s to %v%%\n", slug, percent)
+	return nil
+}
+
+func setTopTwo(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	topTwo := !c.Bool("off")
+	if err := db.SetTopTwo(slug, topTwo); err != nil {
+		return err
+	}
+	if topTwo {
+		fmt.Printf("Marked %s as a top-two primary\n", slug)
+	} else {
+		fmt.Printf("%s is no longer a top-two primary\n", slug)
+	}
+	return nil
+}
+
+func certifyElection(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	var certifiedAt *time.Time
+	if !c.Bool("undo") {
+		at := time.Now()
+		if date := c.String("date"); date != "" {
+			if at, err = time.Parse("2006-01-02", date); err != nil {
+				return fmt.Errorf("failed to parse certification date: %v", err)
+			}
+		}
+		certifiedAt = &at
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.CertifyElection(slug, certifiedAt); err != nil {
+		return err
+	}
+	if certifiedAt == nil {
+		fmt.Printf("Cleared the certification of %s\n", slug)
+	} else {
+		fmt.Printf("Certified %s on %s\n", slug, certifiedAt.Format("2006-01-02"))
+	}
+	return nil
+}
+
+func setStatus(status internal.ElectionStatus) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		slug, err := slugArg(c)
+		if err != nil {
+			return err
+		}
+		db, err := openDB(c)
+		if err != nil {
+			return err
+		}
+		if err := db.SetElectionStatus(slug, status); err != nil {
+			return err
+		}
+		fmt.Printf("Election %s is now %s\n", slug, status)
+		return nil
+	}
+}
+
+func deleteElection(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.DeleteElection(slug); err != nil {
+		return err
+	}
+	fmt.Printf("🗑️ Deleted election %s\n", slug)
+	return nil
+}
+
+func compactElection(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	election, err := db.FindElection(slug)
+	if err != nil {
+		return err
+	}
+	removed, err := db.CompactElection(*election)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d unchanged vote tallies from %s\n", removed, slug)
+	return nil
+}
+
+func contestCategoryNames() string {
+	names := make([]string, len(internal.ContestCategories))
+	for i, category := range internal.ContestCategories {
+		names[i] = string(category)
+	}
+	return strings.Join(names, ", ")
+}
+
+func contestLevelNames() string {
+	names := make([]string, len(internal.ContestLevels))
+	for i, level := range internal.ContestLevels {
+		names[i] = string(level)
+	}
+	return strings.Join(names, ", ")
+}
+
+func listContests(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	var filter internal.ContestFilter
+	if category := c.String("category"); category != "" {
+		if filter.Category, err = internal.ParseContestCategory(category); err != nil {
+			return err
+		}
+	}
+	if level := c.String("level"); level != "" {
+		if filter.Level, err = internal.ParseContestLevel(level); err != nil {
+			return err
+		}
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if _, err := db.FindElection(slug); err != nil {
+		return err
+	}
+	contests, err := db.ListContests(slug)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(contests, func(a, b internal.Contest) int { return strings.Compare(a.ContestKey, b.ContestKey) })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tCATEGORY\tLEVEL\tBALLOT TITLE\tDISTRICT")
+	for _, contest := range contests {
+		if filter.Matches(contest) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", contest.ContestKey, contest.Category, contest.Level, contest.BallotTitle, contest.District)
+		}
+	}
+	return w.Flush()
+}
+
+func classifyContests(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if _, err := db.FindElection(slug); err != nil {
+		return err
+	}
+	changed, err := db.ClassifyContests(slug)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reclassified %d contests in %s\n", changed, slug)
+	return nil
+}
+
+func updateEventFlags(reasonRequired bool) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "reason",
+			Usage:    "Why the update is being changed",
+			Aliases:  []string{"r"},
+			Required: reasonRequired,
+		},
+		&cli.StringFlag{
+			Name:    "by",
+			Usage:   "Who is making the change",
+			EnvVars: []string{"USER"},
+		},
+	}
+}
+
+func updateArg(c *cli.Context, db *internal.DB) (*internal.Update, error) {
+	id, err := strconv.ParseUint(c.Args().Get(0), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("update id is required")
+	}
+	return db.GetUpdate(uint(id))
+}
+
+func listUpdates(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	updates, err := db.ListUpdates(slug)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIMESTAMP\tJURISDICTION\tHASH\tRETRACTED")
+	for _, update := range updates {
+		retracted := ""
+		if update.RetractedAt != nil {
+			retracted = fmt.Sprintf("%s by %s: %s", update.RetractedAt.Format(time.DateTime), update.RetractedBy, update.RetractionReason)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			update.ID,
+			update.Timestamp.Format(time.DateTime),
+			update.JurisdictionType,
+			update.Hash,
+			retracted,
+		)
+	}
+	return w.Flush()
+}
+
+func retractUpdate(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	update, err := updateArg(c, db)
+	if err != nil {
+		return err
+	}
+	webhooks, err := internal.WebhooksFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid UPDATE_WEBHOOKS: %v", err)
+	}
+	if err := db.RetractUpdate(*update, c.String("by"), c.String("reason")); err != nil {
+		return err
+	}
+	fmt.Printf("Retracted %s update %d from %s\n", update.JurisdictionType, update.ID, update.ElectionID)
+	return notifyWebhooks(c, webhooks, internal.NewUpdateNotification(*update, internal.RetractedUpdate, c.String("by"), c.String("reason")))
+}
+
+func restoreUpdate(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	update, err := updateArg(c, db)
+	if err != nil {
+		return err
+	}
+	webhooks, err := internal.WebhooksFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid UPDATE_WEBHOOKS: %v", err)
+	}
+	if err := db.RestoreUpdate(*update, c.String("by"), c.String("reason")); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s update %d from %s\n", update.JurisdictionType, update.ID, update.ElectionID)
+	return notifyWebhooks(c, webhooks, internal.NewUpdateNotification(*update, internal.RestoredUpdate, c.String("by"), c.String("reason")))
+}
+
+// Tells the UPDATE_WEBHOOKS about a retraction or restoration that has
+// already been saved.
+func notifyWebhooks(c *cli.Context, webhooks internal.Webhooks, notification internal.UpdateNotification) error {
+	if len(webhooks) == 0 {
+		return nil
+	}
+	if err := webhooks.Notify(c.Context, notification); err != nil {
+		return fmt.Errorf("update %d was %s, but notifying webhooks failed: %v", notification.UpdateID, notification.Action, err)
+	}
+	fmt.Printf("Notified %d webhooks\n", len(webhooks))
+	return nil
+}
+
+func updateHistory(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	update, err := updateArg(c, db)
+	if err != nil {
+		return err
+	}
+	events, err := db.UpdateEvents(update.ID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tBY\tREASON")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", event.CreatedAt.Format(time.DateTime), event.Action, event.Actor, event.Reason)
+	}
+	return w.Flush()
+}
+
+func listIngestRuns(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	runs, err := db.ListIngestRuns(internal.IngestRunFilter{
+		ElectionID: c.String("election"),
+		Outcome:    internal.IngestOutcome(c.String("outcome")),
+		Limit:      c.Int("limit"),
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tELECTION\tJURISDICTION\tOUTCOME\tATTEMPTS\tHTTP\tBYTES\tROWS\tWARNINGS\tERROR")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			run.ID,
+			run.StartedAt.Format(time.DateTime),
+			run.ElectionID,
+			run.JurisdictionType,
+			run.Outcome,
+			run.Attempts,
+			run.HTTPStatus,
+			run.Bytes,
+			run.Rows,
+			len(run.Warnings),
+			run.Error,
+		)
+	}
+	return w.Flush()
+}
+
+func pruneIngestRuns(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	count, err := db.PruneIngestRuns(time.Now().Add(-c.Duration("older-than")))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d ingest runs\n", count)
+	return nil
+}
+
+func showIngestRun(c *cli.Context) error {
+	id, err := strconv.ParseUint(c.Args().Get(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("run id is required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	run, err := db.GetIngestRun(uint(id))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Source:\t%s\n", run.Source)
+	fmt.Fprintf(w, "Election:\t%s\n", run.ElectionID)
+	fmt.Fprintf(w, "Jurisdiction:\t%s\n", run.JurisdictionType)
+	fmt.Fprintf(w, "Started:\t%s\n", run.StartedAt.Format(time.DateTime))
+	fmt.Fprintf(w, "Duration:\t%s\n", run.Duration())
+	if run.Attempts > 1 {
+		fmt.Fprintf(w, "Attempts:\t%d, last at %s\n", run.Attempts, run.LastSeenAt.Format(time.DateTime))
+	}
+	fmt.Fprintf(w, "HTTP status:\t%d\n", run.HTTPStatus)
+	fmt.Fprintf(w, "Bytes:\t%d\n", run.Bytes)
+	fmt.Fprintf(w, "Hash:\t%s\n", run.Hash)
+	fmt.Fprintf(w, "Rows:\t%d in %d contests\n", run.Rows, run.Contests)
+	fmt.Fprintf(w, "Outcome:\t%s\n", run.Outcome)
+	if run.UpdateID != nil {
+		fmt.Fprintf(w, "Update:\t%d\n", *run.UpdateID)
+	}
+	if run.Error != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", run.Error)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, warning := range run.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	for _, recount := range run.Recounts {
+		fmt.Printf("Recount: %s\n", recount)
+	}
+	return nil
+}
+
+func listCandidates(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	candidates, err := db.ListCandidates(strings.Join(c.Args().Slice(), " "))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tNAME\tCONTESTS\tALIASES")
+	for _, candidate := range candidates {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", candidate.Slug, candidate.Name, len(candidate.BallotResponses), strings.Join(candidate.Aliases, ", "))
+	}
+	return w.Flush()
+}
+
+func showCandidate(c *cli.Context) error {
+	slug := c.Args().Get(0)
+	if slug == "" {
+		return fmt.Errorf("candidate slug is required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	candidate, err := db.FindCandidate(slug)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%s)\n", candidate.Name, candidate.Slug)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESPONSE ID\tELECTION\tBALLOT TITLE\tNAME ON BALLOT")
+	for _, response := range candidate.BallotResponses {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", response.ID, response.ElectionID, response.Contest.BallotTitle, response.Name)
+	}
+	return w.Flush()
+}
+
+func mergeCandidates(c *cli.Context) error {
+	from, into := c.Args().Get(0), c.Args().Get(1)
+	if from == "" || into == "" {
+		return fmt.Errorf("two candidate slugs are required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.MergeCandidates(from, into); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %s into %s\n", from, into)
+	return nil
+}
+
+func splitCandidate(c *cli.Context) error {
+	slug := c.Args().Get(0)
+	if slug == "" {
+		return fmt.Errorf("candidate slug is required")
+	}
+	var ids []uint
+	for _, arg := range c.Args().Tail() {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ballot response id %q", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	split, err := db.SplitCandidate(slug, ids)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Moved %d ballot responses from %s to %s\n", len(ids), slug, split.Slug)
+	return nil
+}
+
+func districtTypeNames() string {
+	names := make([]string, len(internal.DistrictTypes))
+	for i, t := range internal.DistrictTypes {
+		names[i] = strings.ToLower(string(t))
+	}
+	return strings.Join(names, ", ")
+}
+
+func listDistricts(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	districts, err := db.ListDistricts()
+	if err != nil {
+		return err
+	}
+	names := make(map[uint]string)
+	for _, district := range districts {
+		names[district.ID] = district.Name
+	}
+	terms := internal.SearchTerms(strings.Join(c.Args().Slice(), " "))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tPARENT")
+	for _, district := range districts {
+		name := strings.ToLower(district.Name)
+		if !slices.ContainsFunc(terms, func(term string) bool { return !strings.Contains(name, term) }) {
+			parent := ""
+			if district.ParentID != nil {
+				parent = names[*district.ParentID]
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", district.Name, district.Type, parent)
+		}
+	}
+	return w.Flush()
+}
+
+func setDistrictType(c *cli.Context) error {
+	name := c.Args().Get(0)
+	if name == "" || c.Args().Len() != 2 {
+		return fmt.Errorf("a district name and type are required")
+	}
+	t, err := internal.ParseDistrictType(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.SetDistrictType(name, t); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now a %s district\n", name, t)
+	return nil
+}
+
+func setDistrictParent(c *cli.Context) error {
+	name, parent := c.Args().Get(0), c.Args().Get(1)
+	if name == "" || (parent == "") != c.Bool("clear") {
+		return fmt.Errorf("a district name and either a parent or --clear are required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.SetDistrictParent(name, parent); err != nil {
+		return err
+	}
+	if parent == "" {
+		fmt.Printf("Cleared the parent of %s\n", name)
+	} else {
+		fmt.Printf("%s is now part of %s\n", name, parent)
+	}
+	return nil
+}
+
+func listParties(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	parties, err := db.ListParties()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tABBREVIATION\tCOLOR\tALIASES")
+	for _, party := range parties {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", party.Name, party.Abbreviation, party.Color, strings.Join(party.Aliases, ", "))
+	}
+	return w.Flush()
+}
+
+func mergeParties(c *cli.Context) error {
+	from, into := c.Args().Get(0), c.Args().Get(1)
+	if from == "" || into == "" {
+		return fmt.Errorf("the party to merge and the party to merge it into are required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.MergeParties(from, into); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %s into %s\n", from, into)
+	return nil
+}
+
+func updateParty(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("a party name is required")
+	}
+	if c.String("abbreviation") == "" && c.String("color") == "" {
+		return fmt.Errorf("--abbreviation or --color is required")
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.UpdateParty(name, c.String("abbreviation"), c.String("color")); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s\n", name)
+	return nil
+}
+
+var boundaryKindFlag = &cli.StringFlag{
+	Name:     "kind",
+	Usage:    "Kind of boundaries (precinct, legislative or county)",
+	Aliases:  []string{"k"},
+	Required: true,
+}
+
+func listBoundaries(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	counts, err := db.BoundaryCounts(slug)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tAREAS")
+	for _, kind := range internal.BoundaryKinds {
+		fmt.Fprintf(w, "%s\t%d\n", kind, counts[kind])
+	}
+	return w.Flush()
+}
+
+func loadBoundaries(c *cli.Context) error {
+	slug, path := c.Args().Get(0), c.Args().Get(1)
+	if slug == "" || path == "" {
+		return fmt.Errorf("election slug and GeoJSON file are required")
+	}
+	kind, err := internal.ParseBoundaryKind(c.String("kind"))
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	boundaries, err := internal.ParseBoundaries(file, kind, c.String("name-property"))
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if _, err := db.FindElection(slug); err != nil {
+		return err
+	}
+	if err := db.LoadBoundaries(slug, kind, boundaries); err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d %s boundaries for %s\n", len(boundaries), kind, slug)
+	return nil
+}
+
+func deleteBoundaries(c *cli.Context) error {
+	slug, err := slugArg(c)
+	if err != nil {
+		return err
+	}
+	kind, err := internal.ParseBoundaryKind(c.String("kind"))
+	if err != nil {
+		return err
+	}
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	if err := db.DeleteBoundaries(slug, kind); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted the %s boundaries of %s\n", kind, slug)
+	return nil
+}
+
+func backtest(c *cli.Context) error {
+	db, err := openDB(c)
+	if err != nil {
+		return err
+	}
+	var elections []internal.Election
+	if c.Args().Present() {
+		for _, slug := range c.Args().Slice() {
+			election, err := db.FindElection(slug)
+			if err != nil {
+				return err
+			}
+			elections = append(elections, *election)
+		}
+	} else if elections, err = db.ListElections(true); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ELECTION\tSTATUS\tPROJECTIONS\tCORRECT WINNER\tIN 95% INTERVAL\tMEAN ERROR")
+	for _, election := range elections {
+		scores, err := internal.Backtest(db, election)
+		if err != nil {
+			return err
+		}
+		for _, score := range scores {
+			if score.Projections == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%.1f%%\t%.1f%%\t%d\n",
+				election.ID,
+				score.Status,
+				score.Projections,
+				float64(score.CorrectWinner)*100/float64(score.Projections),
+				float64(score.WithinInterval)*100/float64(score.Projections),
+				score.AbsoluteError/score.Projections,
+			)
+		}
+	}
+	return w.Flush()
+}
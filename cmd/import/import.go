@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -19,25 +20,24 @@ func main() {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "db",
-				Usage:    "PostgreSQL database URL",
+				Usage:    "Database URL (postgres://... or sqlite://path/to/file.db)",
 				EnvVars:  []string{"PG_URL"},
 				Required: true,
 			},
-			&cli.StringFlag{
-				Name:     "date",
-				Usage:    "Election date (YYYY-MM-DD)",
-				Aliases:  []string{"d"},
-				Required: true,
-			},
 			&cli.BoolFlag{
 				Name:    "overwrite",
-				Usage:   "Overwrite existing data for this election. Note: Deletes election with matching name.",
+				Usage:   "Overwrite existing data for this election. Note: Deletes all contests and updates already loaded for the election.",
 				Aliases: []string{"o"},
 			},
 			&cli.StringFlag{
-				Name:     "name",
-				Usage:    "Name of the election (2024 Primary)",
-				Aliases:  []string{"n"},
+				Name:  "loader",
+				Usage: "How to load tallies: copy (PostgreSQL COPY, SQLite always uses gorm) or gorm (row by row)",
+				Value: "copy",
+			},
+			&cli.StringFlag{
+				Name:     "election",
+				Usage:    "Slug of a registered election (see `elections create`)",
+				Aliases:  []string{"e"},
 				Required: true,
 			},
 		},
@@ -56,12 +56,11 @@ func runImport(c *cli.Context) error {
 		return fmt.Errorf("directory path is required")
 	}
 	dbURL := c.String("db")
-	electionName := c.String("name")
-	electionDateStr := c.String("date")
+	electionSlug := c.String("election")
 	overwrite := c.Bool("overwrite")
-	electionDate, err := time.Parse("2006-01-02", electionDateStr)
-	if err != nil {
-		return fmt.Errorf("failed to parse election date: %v", err)
+	loader := c.String("loader")
+	if loader != "copy" && loader != "gorm" {
+		return fmt.Errorf("unknown loader %s", loader)
 	}
 
 	// Initialize database connection
@@ -75,25 +74,17 @@ func runImport(c *cli.Context) error {
 		return fmt.Errorf("failed to migrate schema: %v", err)
 	}
 
-	election := internal.Election{
-		ID: internal.GetElectionKey(electionName),
+	election, err := db.FindElection(electionSlug)
+	if err != nil {
+		return err
 	}
 	if overwrite {
-		db.Limit(1).Find(&election)
-		if election.Name != "" {
-			fmt.Printf("🗑️ Deleting election with name %s\n and ID %s\n", election.Name, election.ID)
-			db.Unscoped().Delete(&election)
-		} else {
-			fmt.Printf("No election with name %s found\n", electionName)
+		fmt.Printf("🗑️ Deleting existing results for election %s\n", election.ID)
+		if err := db.ClearElectionResults(*election); err != nil {
+			return err
 		}
 	}
 
-	election.Name = electionName
-	election.ElectionDate = electionDate
-
-	// Create an election object
-	db.FirstOrCreate(&election, election)
-
 	// Process CSV files
 	files, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -106,10 +97,12 @@ func runImport(c *cli.Context) error {
 
 			// Determine jurisdiction type
 			var jType internal.JurisdictionType
-			if strings.Contains(file.Name(), "allstate") {
+			if strings.Contains(file.Name(), "allstate") || strings.Contains(file.Name(), "allcounties") {
 				jType = internal.StateJurisdiction
 			} else if strings.Contains(file.Name(), "webresults") {
 				jType = internal.CountyJurisdiction
+			} else if strings.Contains(file.Name(), "precinct") {
+				jType = internal.PrecinctJurisdiction
 			} else {
 				return fmt.Errorf("unknown jurisdiction type from filename: %s", file.Name())
 			}
@@ -119,8 +112,10 @@ func runImport(c *cli.Context) error {
 			// Extract date from filename
 			datePart := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
 			datePart = strings.TrimSuffix(datePart, "_allstate")
+			datePart = strings.TrimSuffix(datePart, "_allcounties")
 			datePart = strings.TrimSuffix(datePart, "-final")
 			datePart = strings.TrimPrefix(datePart, "webresults-")
+			datePart = strings.TrimPrefix(datePart, "precinct-results-")
 			date, err := time.Parse("20060102", datePart)
 			if err != nil {
 				log.Printf("Failed to parse date from filename %s: %v", file.Name(), err)
@@ -129,40 +124,49 @@ func runImport(c *cli.Context) error {
 
 			fmt.Printf("Detected date: %s\n", date)
 
-			// Open and parse CSV file
-			f, err := os.Open(filepath.Join(dirPath, file.Name()))
-			if err != nil {
-				log.Printf("Failed to open file %s: %v", file.Name(), err)
-				continue
+			path := filepath.Join(dirPath, file.Name())
+			open := func() (io.ReadCloser, error) { return os.Open(path) }
+			load := func(records []internal.GenericVoteRecord, hash string) (*internal.Update, error) {
+				existing, err := db.FindUpdate(hash, *election)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check for existing update: %v", err)
+				}
+				if existing != nil && !overwrite {
+					fmt.Printf("Hash %s already exists. Skipping file: %s\n", hash, file.Name())
+					return nil, nil
+				} else if existing != nil && overwrite {
+					fmt.Printf("Hash %s already exists, overwriting now. %s\n", hash, file.Name())
+					if err := db.DeleteUpdate(*existing); err != nil {
+						return nil, fmt.Errorf("failed to delete existing update: %v", err)
+					}
+				}
+
+				// Precinct results only have the one loader
+				if loader == "copy" || jType == internal.PrecinctJurisdiction {
+					if err := db.LoadUpdate(records, hash, date, *election); err != nil {
+						return nil, fmt.Errorf("failed to load file: %v", err)
+					}
+				} else {
+					// Load the responses
+					if err := db.LoadBallotResponses(records, *election); err != nil {
+						return nil, fmt.Errorf("failed to load ballot responses: %v", err)
+					}
+
+					// Update vote tallies
+					if err := db.UpdateVoteTallies(records, hash, date, *election); err != nil {
+						return nil, fmt.Errorf("failed to update vote tallies: %v", err)
+					}
+				}
+				return db.FindUpdate(hash, *election)
 			}
-			defer f.Close()
 
-			records, hash, err := internal.Parse(f, jType)
-			if err != nil {
-				log.Printf("Failed to parse CSV file %s: %v", file.Name(), err)
-				continue
-			}
-
-			exists, updateID := db.UpdateHashExists(hash)
-			if exists && !overwrite {
-				fmt.Printf("Hash %s already exists. Skipping file: %s\n", hash, file.Name())
-				continue
-			} else if exists && overwrite {
-				fmt.Printf("Hash %s already exists, overwriting now. %s\n", hash, file.Name())
-				db.DeleteUpdate(updateID)
-			}
-
-			// Load the responses
-			err = db.LoadBallotResponses(records, election)
-			if err != nil {
-				log.Printf("Failed to load ballot responses: %v", err)
+			// Every file is recorded as an IngestRun, see `elections runs`
+			run := internal.NewIngestRun(path, jType, *election)
+			if err := internal.Ingest(db, run, open, load); err != nil {
+				log.Printf("Failed to import file %s: %v", file.Name(), err)
 				continue
 			}
-
-			// Update vote tallies
-			err = db.UpdateVoteTallies(records, hash, date, election)
-			if err != nil {
-				log.Printf("Failed to update vote tallies for file %s: %v", file.Name(), err)
+			if run.Outcome == internal.UnchangedOutcome {
 				continue
 			}
 
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/danielhep/go-elections/internal"
+	"github.com/gorilla/mux"
+)
+
+// Adds the admin pages under /admin, behind HTTP basic auth with the given
+// password. The username is ignored.
+func addAdminRoutes(r *mux.Router, store internal.Store, password string) {
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, given, ok := r.BasicAuth()
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	admin.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+		filter := internal.IngestRunFilter{
+			ElectionID: r.URL.Query().Get("election"),
+			Outcome:    internal.IngestOutcome(r.URL.Query().Get("outcome")),
+		}
+		runs, err := store.ListIngestRuns(filter)
+		if err != nil {
+			http.Error(w, "Error fetching ingest runs", http.StatusInternalServerError)
+			return
+		}
+		err = ingestRunsPage(runs, filter).Render(r.Context(), w)
+		if err != nil {
+			http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+
+	admin.HandleFunc("/runs/{runID}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["runID"], 10, 64)
+		if err != nil {
+			http.Error(w, "Run not found", http.StatusNotFound)
+			return
+		}
+		run, err := store.GetIngestRun(uint(id))
+		if err != nil {
+			http.Error(w, "Run not found", http.StatusNotFound)
+			return
+		}
+		err = ingestRunPage(*run).Render(r.Context(), w)
+		if err != nil {
+			http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+
+	admin.HandleFunc("/boundaries", func(w http.ResponseWriter, r *http.Request) {
+		renderBoundariesPage(w, r, store, "", "")
+	}).Methods("GET")
+
+	// Loads an uploaded GeoJSON file of boundaries, replacing the election's
+	// boundaries of the same kind
+	admin.HandleFunc("/boundaries", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(maxBoundaryUpload); err != nil {
+			renderBoundariesPage(w, r, store, "", fmt.Sprintf("Error reading upload: %v", err))
+			return
+		}
+		electionID := r.FormValue("election")
+		if _, err := store.FindElection(electionID); err != nil {
+			renderBoundariesPage(w, r, store, "", fmt.Sprintf("Election %s not found", electionID))
+			return
+		}
+		kind, err := internal.ParseBoundaryKind(r.FormValue("kind"))
+		if err != nil {
+			renderBoundariesPage(w, r, store, "", err.Error())
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			renderBoundariesPage(w, r, store, "", "A GeoJSON file is required")
+			return
+		}
+		defer file.Close()
+		boundaries, err := internal.ParseBoundaries(file, kind, r.FormValue("name_property"))
+		if err == nil {
+			err = store.LoadBoundaries(electionID, kind, boundaries)
+		}
+		if err != nil {
+			renderBoundariesPage(w, r, store, "", err.Error())
+			return
+		}
+		renderBoundariesPage(w, r, store, fmt.Sprintf("Loaded %d %s boundaries for %s", len(boundaries), kind, electionID), "")
+	}).Methods("POST")
+}
+
+// Precinct boundaries for the whole county run to tens of megabytes.
+const maxBoundaryUpload = 128 << 20
+
+func renderBoundariesPage(w http.ResponseWriter, r *http.Request, store internal.Store, message string, errorMessage string) {
+	elections, err := store.ListElections(true)
+	if err != nil {
+		http.Error(w, "Error fetching elections", http.StatusInternalServerError)
+		return
+	}
+	counts := make(map[string]map[internal.BoundaryKind]int)
+	for _, election := range elections {
+		if counts[election.ID], err = store.BoundaryCounts(election.ID); err != nil {
+			http.Error(w, "Error fetching boundaries", http.StatusInternalServerError)
+			return
+		}
+	}
+	if errorMessage != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	err = boundariesPage(elections, counts, message, errorMessage).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danielhep/go-elections/internal"
+	"github.com/gorilla/mux"
+)
+
+// The JSON API under /api/v1. Responses use the api* types below rather than
+// the gorm models so that schema changes don't leak into the API; see
+// openapi.yaml for the documented shapes.
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+type apiElection struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Date   string `json:"date"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+type apiContest struct {
+	Key           string   `json:"key"`
+	ElectionID    string   `json:"election_id"`
+	BallotTitle   string   `json:"ballot_title"`
+	District      string   `json:"district"`
+	Jurisdictions []string `json:"jurisdictions"`
+	Category      string   `json:"category"`
+	Level         string   `json:"level"`
+}
+
+type apiResult struct {
+	Candidate    string    `json:"candidate"`
+	Party        *string   `json:"party"`
+	Votes        int       `json:"votes"`
+	Percent      float64   `json:"percent"`
+	Rank         int       `json:"rank"`
+	MarginToNext int       `json:"margin_to_next"`
+	Jurisdiction string    `json:"jurisdiction"`
+	UpdateID     uint      `json:"update_id"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+type apiContestDetail struct {
+	apiContest
+	Results    []apiResult    `json:"results"`
+	Projection *apiProjection `json:"projection"`
+}
+
+type apiProjection struct {
+	Status             string `json:"status"`
+	Leader             string `json:"leader"`
+	Trailer            string `json:"trailer"`
+	Winner             string `json:"winner"`
+	CurrentMargin      int    `json:"current_margin"`
+	BallotsOutstanding int    `json:"ballots_outstanding"`
+	Final              bool   `json:"final"`
+	Margin             int    `json:"margin"`
+	// Nil when the ballots left to count are unknown
+	MarginLow       *int    `json:"margin_low"`
+	MarginHigh      *int    `json:"margin_high"`
+	MarginPerBallot float64 `json:"margin_per_ballot"`
+}
+
+type apiTally struct {
+	Candidate string  `json:"candidate"`
+	Party     *string `json:"party"`
+	Votes     int     `json:"votes"`
+	Percent   float64 `json:"percent"`
+}
+
+type apiHistoryEntry struct {
+	UpdateID     uint       `json:"update_id"`
+	Timestamp    time.Time  `json:"timestamp"`
+	Jurisdiction string     `json:"jurisdiction"`
+	Tallies      []apiTally `json:"tallies"`
+}
+
+type apiUpdate struct {
+	ID           uint      `json:"id"`
+	ElectionID   string    `json:"election_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Jurisdiction string    `json:"jurisdiction"`
+	Hash         string    `json:"hash"`
+}
+
+type apiPagination struct {
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+type apiList[T any] struct {
+	Data       []T           `json:"data"`
+	Pagination apiPagination `json:"pagination"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func toAPIElection(election internal.Election) apiElection {
+	return apiElection{
+		ID:     election.ID,
+		Name:   election.Name,
+		Date:   election.ElectionDate.Format("2006-01-02"),
+		Type:   string(election.Type),
+		Status: string(election.Status),
+	}
+}
+
+func toAPIContest(contest internal.Contest) apiContest {
+	jurisdictions := []string(contest.Jurisdictions)
+	if jurisdictions == nil {
+		jurisdictions = []string{}
+	}
+	return apiContest{
+		Key:           contest.ContestKey,
+		ElectionID:    contest.ElectionID,
+		BallotTitle:   contest.BallotTitle,
+		District:      contest.District,
+		Jurisdictions: jurisdictions,
+		Category:      string(contest.Category),
+		Level:         string(contest.Level),
+	}
+}
+
+// Rounds a percentage to the two decimals the pages show.
+func roundPercent(percent float64) float64 {
+	return math.Round(percent*100) / 100
+}
+
+func toAPIResult(result internal.ContestResult) apiResult {
+	return apiResult{
+		Candidate:    result.BallotResponse.Name,
+		Party:        result.BallotResponse.Party,
+		Votes:        result.Votes,
+		Percent:      roundPercent(result.Percent),
+		Rank:         result.Rank,
+		MarginToNext: result.MarginToNext,
+		Jurisdiction: string(result.JurisdictionType),
+		UpdateID:     result.UpdateID,
+		Timestamp:    result.Timestamp,
+	}
+}
+
+func toAPIProjection(projection *internal.Projection) *apiProjection {
+	if projection == nil {
+		return nil
+	}
+	ret := &apiProjection{
+		Status:             string(projection.Status),
+		Leader:             projection.Leader.Name,
+		Trailer:            projection.Trailer.Name,
+		Winner:             projection.Winner().Name,
+		CurrentMargin:      projection.LeaderVotes - projection.TrailerVotes,
+		BallotsOutstanding: projection.BallotsOutstanding,
+		Final:              projection.Final,
+		Margin:             projection.Margin,
+		MarginPerBallot:    projection.MarginPerBallot,
+	}
+	if projection.HasInterval() {
+		ret.MarginLow = &projection.MarginLow
+		ret.MarginHigh = &projection.MarginHigh
+	}
+	return ret
+}
+
+func toAPIUpdate(update internal.Update) apiUpdate {
+	return apiUpdate{
+		ID:           update.ID,
+		ElectionID:   update.ElectionID,
+		Timestamp:    update.Timestamp,
+		Jurisdiction: string(update.JurisdictionType),
+		Hash:         update.Hash,
+	}
+}
+
+// Groups the candidates' tallies into one entry per update, oldest first. Only
+// updates in which the contest changed have tallies.
+func contestHistory(candidates []internal.BallotResponse, jType internal.JurisdictionType) []apiHistoryEntry {
+	entries := make(map[uint]*apiHistoryEntry)
+	for _, candidate := range candidates {
+		for _, tally := range candidate.VoteTallies {
+			if jType != "" && tally.Update.JurisdictionType != jType {
+				continue
+			}
+			entry, ok := entries[tally.UpdateID]
+			if !ok {
+				entry = &apiHistoryEntry{
+					UpdateID:     tally.UpdateID,
+					Timestamp:    tally.Update.Timestamp,
+					Jurisdiction: string(tally.Update.JurisdictionType),
+				}
+				entries[tally.UpdateID] = entry
+			}
+			entry.Tallies = append(entry.Tallies, apiTally{
+				Candidate: candidate.Name,
+				Party:     candidate.Party,
+				Votes:     tally.Votes,
+				Percent:   roundPercent(float64(tally.VotePercentage)),
+			})
+		}
+	}
+	history := []apiHistoryEntry{}
+	for _, entry := range entries {
+		slices.SortFunc(entry.Tallies, func(a, b apiTally) int { return b.Votes - a.Votes })
+		history = append(history, *entry)
+	}
+	slices.SortFunc(history, func(a, b apiHistoryEntry) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		return int(a.UpdateID) - int(b.UpdateID)
+	})
+	return history
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, "Error writing response", http.StatusInternalServerError)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+// Reads the page and per_page query parameters.
+func pageParams(r *http.Request) (page int, perPage int, err error) {
+	page, perPage = 1, defaultPerPage
+	if v := r.URL.Query().Get("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+	}
+	if v := r.URL.Query().Get("per_page"); v != "" {
+		if perPage, err = strconv.Atoi(v); err != nil || perPage < 1 || perPage > maxPerPage {
+			return 0, 0, fmt.Errorf("per_page must be between 1 and %d", maxPerPage)
+		}
+	}
+	return page, perPage, nil
+}
+
+func paginate[T any](items []T, page int, perPage int) apiList[T] {
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	return apiList[T]{
+		Data:       items[start:end],
+		Pagination: apiPagination{Page: page, PerPage: perPage, Total: len(items)},
+	}
+}
+
+// Reads the jurisdiction query parameter, which is matched case-insensitively.
+func jurisdictionParam(r *http.Request) (internal.JurisdictionType, error) {
+	v := r.URL.Query().Get("jurisdiction")
+	switch {
+	case v == "":
+		return "", nil
+	case strings.EqualFold(v, string(internal.StateJurisdiction)):
+		return internal.StateJurisdiction, nil
+	case strings.EqualFold(v, string(internal.CountyJurisdiction)):
+		return internal.CountyJurisdiction, nil
+	case strings.EqualFold(v, string(internal.PrecinctJurisdiction)):
+		return internal.PrecinctJurisdiction, nil
+	}
+	return "", fmt.Errorf("unknown jurisdiction %s", v)
+}
+
+// Adds the JSON API routes under /api/v1.
+func addAPIRoutes(r *mux.Router, store internal.Store) {
+	api := r.PathPrefix("/api/v1").Subrouter()
+
+	api.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		if _, err := w.Write(openAPISpec); err != nil {
+			http.Error(w, "Error writing response", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+
+	api.HandleFunc("/elections", func(w http.ResponseWriter, r *http.Request) {
+		page, perPage, err := pageParams(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		elections, err := store.ListElections(r.URL.Query().Get("include_archived") == "true")
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error fetching elections")
+			return
+		}
+		data := make([]apiElection, len(elections))
+		for i, election := range elections {
+			data[i] = toAPIElection(election)
+		}
+		writeJSON(w, http.StatusOK, paginate(data, page, perPage))
+	}).Methods("GET")
+
+	api.HandleFunc("/elections/{electionID}", func(w http.ResponseWriter, r *http.Request) {
+		election, err := store.FindElection(mux.Vars(r)["electionID"])
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "election not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPIElection(*election))
+	}).Methods("GET")
+
+	api.HandleFunc("/elections/{electionID}/contests", func(w http.ResponseWriter, r *http.Request) {
+		page, perPage, err := pageParams(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		jType, err := jurisdictionParam(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		district := r.URL.Query().Get("district")
+		filter, err := contestFilterParams(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		electionID := mux.Vars(r)["electionID"]
+		if _, err := store.FindElection(electionID); err != nil {
+			writeAPIError(w, http.StatusNotFound, "election not found")
+			return
+		}
+		contests, err := store.ListContests(electionID)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error fetching contests")
+			return
+		}
+		slices.SortFunc(contests, func(a, b internal.Contest) int { return strings.Compare(a.ContestKey, b.ContestKey) })
+		data := []apiContest{}
+		for _, contest := range contests {
+			if district != "" && !strings.EqualFold(contest.District, district) {
+				continue
+			}
+			if jType != "" && !slices.Contains(contest.Jurisdictions, string(jType)) {
+				continue
+			}
+			if !filter.Matches(contest) {
+				continue
+			}
+			data = append(data, toAPIContest(contest))
+		}
+		writeJSON(w, http.StatusOK, paginate(data, page, perPage))
+	}).Methods("GET")
+
+	api.HandleFunc("/elections/{electionID}/contests/{contestKey}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		contest, err := store.FindContest(vars["electionID"], vars["contestKey"])
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "contest not found")
+			return
+		}
+		results, err := store.CurrentResults(contest.ID)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error fetching results")
+			return
+		}
+		candidates, err := store.ContestCandidates(contest.ID)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error fetching candidates")
+			return
+		}
+		detail := apiContestDetail{
+			apiContest: toAPIContest(*contest),
+			Results:    []apiResult{},
+			Projection: toAPIProjection(internal.ProjectContest(candidates, contest.Election)),
+		}
+		for _, result := range results {
+			detail.Results = append(detail.Results, toAPIResult(result))
+		}
+		writeJSON(w, http.StatusOK, detail)
+	}).Methods("GET")
+
+	api.HandleFunc("/elections/{electionID}/contests/{contestKey}/history", func(w http.ResponseWriter, r *http.Request) {
+		page, perPage, err := pageParams(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		jType, err := jurisdictionParam(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		vars := mux.Vars(r)
+		contest, err := store.FindContest(vars["electionID"], vars["contestKey"])
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "contest not found")
+			return
+		}
+		candidates, err := store.ContestCandidates(contest.ID)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error fetching vote tallies")
+			return
+		}
+		writeJSON(w, http.StatusOK, paginate(contestHistory(candidates, jType), page, perPage))
+	}).Methods("GET")
+
+	api.HandleFunc("/elections/{electionID}/updates", func(w http.ResponseWriter, r *http.Request) {
+		page, perPage, err := pageParams(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		jType, err := jurisdictionParam(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		electionID := mux.Vars(r)["electionID"]
+		if _, err := store.FindElection(electionID); err != nil {
+			writeAPIError(w, http.StatusNotFound, "election not found")
+			return
+		}
+		updates, err := store.ListUpdates(electionID)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "error fetching updates")
+			return
+		}
+		// Retracted updates stay hidden, as on the pages
+		data := []apiUpdate{}
+		for _, update := range updates {
+			if update.RetractedAt != nil || (jType != "" && update.JurisdictionType != jType) {
+				continue
+			}
+			data = append(data, toAPIUpdate(update))
+		}
+		writeJSON(w, http.StatusOK, paginate(data, page, perPage))
+	}).Methods("GET")
+
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not found")
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danielhep/go-elections/internal"
+)
+
+func TestJurisdictionParam(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    internal.JurisdictionType
+		wantErr bool
+	}{
+		{"", "", false},
+		{"?jurisdiction=state", internal.StateJurisdiction, false},
+		{"?jurisdiction=County", internal.CountyJurisdiction, false},
+		{"?jurisdiction=Precinct", internal.PrecinctJurisdiction, false},
+		{"?jurisdiction=city", "", true},
+	}
+	for _, test := range tests {
+		got, err := jurisdictionParam(httptest.NewRequest(http.MethodGet, "/api/v1/elections"+test.query, nil))
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("jurisdictionParam(%q) = %q, %v; want %q, error %v", test.query, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestRoundPercent(t *testing.T) {
+	tests := []struct {
+		percent float64
+		want    float64
+	}{
+		{52.345678, 52.35},
+		{47.654321, 47.65},
+		{100, 100},
+		{float64(float32(33.333332)), 33.33},
+	}
+	for _, test := range tests {
+		if got := roundPercent(test.percent); got != test.want {
+			t.Errorf("roundPercent(%v) = %v, want %v", test.percent, got, test.want)
+		}
+	}
+}
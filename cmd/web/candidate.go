@@ -0,0 +1,54 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/danielhep/go-elections/internal"
+)
+
+// candidateRun is one contest a candidate ran in, with where they stand in it.
+type candidateRun struct {
+	Response internal.BallotResponse
+	// The candidate's current result, nil if the contest has none yet
+	Result *internal.ContestResult
+	// Number of candidates in the contest
+	Field int
+}
+
+// Returns the candidate's contests with their current results, newest
+// election first.
+func candidateRuns(store internal.Store, candidate internal.Candidate) ([]candidateRun, error) {
+	runs := make([]candidateRun, len(candidate.BallotResponses))
+	for i, response := range candidate.BallotResponses {
+		results, err := store.CurrentResults(response.ContestID)
+		if err != nil {
+			return nil, err
+		}
+		runs[i] = candidateRun{Response: response, Field: len(results)}
+		for _, result := range results {
+			if result.BallotResponseID == response.ID {
+				runs[i].Result = &result
+				break
+			}
+		}
+	}
+	slices.SortStableFunc(runs, func(a, b candidateRun) int {
+		return cmp.Or(
+			b.Response.Contest.Election.ElectionDate.Compare(a.Response.Contest.Election.ElectionDate),
+			cmp.Compare(a.Response.Contest.BallotTitle, b.Response.Contest.BallotTitle),
+		)
+	})
+	return runs, nil
+}
+
+// Returns the parties a candidate has run under, in order of first use.
+func candidateParties(runs []candidateRun) []string {
+	var parties []string
+	for _, run := range slices.Backward(runs) {
+		if party := partyName(run.Response.Party); party != "" && !slices.Contains(parties, party) {
+			parties = append(parties, party)
+		}
+	}
+	return parties
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/danielhep/go-elections/internal"
+	"github.com/gorilla/mux"
+)
+
+// exportRow is the shape of every download, whichever source file the
+// numbers came from.
+type exportRow struct {
+	ElectionID   string    `json:"election_id"`
+	ContestKey   string    `json:"contest_key"`
+	BallotTitle  string    `json:"ballot_title"`
+	District     string    `json:"district"`
+	Category     string    `json:"category"`
+	Level        string    `json:"level"`
+	UpdateID     uint      `json:"update_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	Jurisdiction string    `json:"jurisdiction"`
+	Candidate    string    `json:"candidate"`
+	Party        string    `json:"party"`
+	Votes        int       `json:"votes"`
+	Percent      float64   `json:"percent"`
+}
+
+var exportHeader = []string{"election_id", "contest_key", "ballot_title", "district", "category", "level", "update_id", "timestamp", "jurisdiction", "candidate", "party", "votes", "percent"}
+
+func (row exportRow) csvRecord() []string {
+	return []string{
+		row.ElectionID,
+		row.ContestKey,
+		row.BallotTitle,
+		row.District,
+		row.Category,
+		row.Level,
+		strconv.FormatUint(uint64(row.UpdateID), 10),
+		row.Timestamp.Format(time.RFC3339),
+		row.Jurisdiction,
+		row.Candidate,
+		row.Party,
+		strconv.Itoa(row.Votes),
+		strconv.FormatFloat(row.Percent, 'f', 2, 64),
+	}
+}
+
+func partyName(party *string) string {
+	if party == nil {
+		return ""
+	}
+	return *party
+}
+
+// Returns one row per candidate per update in which the contest changed,
+// oldest update first.
+func contestHistoryRows(contest internal.Contest, candidates []internal.BallotResponse) []exportRow {
+	rows := []exportRow{}
+	for _, candidate := range candidates {
+		for _, tally := range candidate.VoteTallies {
+			rows = append(rows, exportRow{
+				ElectionID:   contest.ElectionID,
+				ContestKey:   contest.ContestKey,
+				BallotTitle:  contest.BallotTitle,
+				District:     contest.District,
+				Category:     string(contest.Category),
+				Level:        string(contest.Level),
+				UpdateID:     tally.UpdateID,
+				Timestamp:    tally.Update.Timestamp,
+				Jurisdiction: string(tally.Update.JurisdictionType),
+				Candidate:    candidate.Name,
+				Party:        partyName(candidate.Party),
+				Votes:        tally.Votes,
+				Percent:      float64(tally.VotePercentage),
+			})
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b exportRow) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		if a.UpdateID != b.UpdateID {
+			return int(a.UpdateID) - int(b.UpdateID)
+		}
+		return b.Votes - a.Votes
+	})
+	return rows
+}
+
+func latestResultRows(results []internal.ContestResult) []exportRow {
+	rows := make([]exportRow, len(results))
+	for i, result := range results {
+		rows[i] = exportRow{
+			ElectionID:   result.ElectionID,
+			ContestKey:   result.Contest.ContestKey,
+			BallotTitle:  result.Contest.BallotTitle,
+			District:     result.Contest.District,
+			Category:     string(result.Contest.Category),
+			Level:        string(result.Contest.Level),
+			UpdateID:     result.UpdateID,
+			Timestamp:    result.Timestamp,
+			Jurisdiction: string(result.JurisdictionType),
+			Candidate:    result.BallotResponse.Name,
+			Party:        partyName(result.BallotResponse.Party),
+			Votes:        result.Votes,
+			Percent:      result.Percent,
+		}
+	}
+	return rows
+}
+
+// Writes rows as a CSV or JSON attachment named filename.format.
+func writeExport(w http.ResponseWriter, rows []exportRow, filename string, format string) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	if format == "json" {
+		writeJSON(w, http.StatusOK, rows)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportHeader); err != nil {
+		http.Error(w, "Error writing response", http.StatusInternalServerError)
+		return
+	}
+	for _, row := range rows {
+		if err := writer.Write(row.csvRecord()); err != nil {
+			return
+		}
+	}
+	writer.Flush()
+}
+
+// Adds the CSV and JSON download routes.
+func addExportRoutes(r *mux.Router, store internal.Store) {
+	r.HandleFunc("/{electionID}/results.{format:csv|json}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		election, err := store.FindElection(vars["electionID"])
+		if err != nil {
+			http.Error(w, "Election not found", http.StatusNotFound)
+			return
+		}
+		filter, err := contestFilterParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		results, err := store.ElectionResults(election.ID)
+		if err != nil {
+			http.Error(w, "Error fetching results", http.StatusInternalServerError)
+			return
+		}
+		results = slices.DeleteFunc(results, func(result internal.ContestResult) bool { return !filter.Matches(result.Contest) })
+		writeExport(w, latestResultRows(results), election.ID+"_results", vars["format"])
+	}).Methods("GET")
+
+	r.HandleFunc("/{electionID}/contest/{contestKey}/history.{format:csv|json}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		contest, err := store.FindContest(vars["electionID"], vars["contestKey"])
+		if err != nil {
+			http.Error(w, "Contest not found", http.StatusNotFound)
+			return
+		}
+		candidates, err := store.ContestCandidates(contest.ID)
+		if err != nil {
+			http.Error(w, "Error fetching vote tallies", http.StatusInternalServerError)
+			return
+		}
+		writeExport(w, contestHistoryRows(*contest, candidates), contest.ElectionID+"_"+contest.ContestKey, vars["format"])
+	}).Methods("GET")
+}
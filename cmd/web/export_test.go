@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielhep/go-elections/internal"
+	"github.com/gorilla/mux"
+)
+
+func exportTestRouter(t *testing.T) *mux.Router {
+	store := internal.NewMemoryStore()
+	date := time.Date(2024, time.November, 5, 0, 0, 0, 0, time.UTC)
+	election := internal.Election{ID: "2024_general", Name: "2024 General", ElectionDate: date, Type: internal.GeneralElection}
+	if err := store.CreateElection(&election); err != nil {
+		t.Fatal(err)
+	}
+	record := func(title string, candidate string, party string, votes int) internal.GenericVoteRecord {
+		return internal.GenericVoteRecord{DistrictName: "King County", BallotTitle: title, BallotResponse: candidate, PartyPreference: party, Votes: votes, JurisdictionType: internal.CountyJurisdiction}
+	}
+	for i, records := range [][]internal.GenericVoteRecord{
+		{record("Mayor", `Smith, "Al"`, "Independent, Reform", 100), record("Mayor", "Bob Jones", "", 50), record("Proposition No. 1", "Yes", "", 10)},
+		{record("Mayor", `Smith, "Al"`, "Independent, Reform", 150), record("Mayor", "Bob Jones", "", 150), record("Proposition No. 1", "Yes", "", 10)},
+	} {
+		if err := store.LoadUpdate(records, string(rune('a'+i)), date.Add(time.Duration(i+1)*time.Hour), election); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := mux.NewRouter()
+	addRoutes(r, store, nil)
+	return r
+}
+
+func getExport(t *testing.T, r *mux.Router, path string, contentType string, filename string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", path, w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != contentType {
+		t.Errorf("GET %s Content-Type = %q, want %q", path, got, contentType)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="`+filename+`"`; got != want {
+		t.Errorf("GET %s Content-Disposition = %q, want %q", path, got, want)
+	}
+	return w
+}
+
+// Returns the candidate and votes columns of each row after checking the
+// header.
+func readExportCSV(t *testing.T, body string) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %v\n%s", err, body)
+	}
+	if len(records) == 0 || !slices.Equal(records[0], exportHeader) {
+		t.Fatalf("CSV header = %v, want %v", records, exportHeader)
+	}
+	candidate := slices.Index(exportHeader, "candidate")
+	votes := slices.Index(exportHeader, "votes")
+	var rows [][]string
+	for _, record := range records[1:] {
+		if len(record) != len(exportHeader) {
+			t.Errorf("CSV row %v has %d columns, want %d", record, len(record), len(exportHeader))
+			continue
+		}
+		rows = append(rows, []string{record[candidate], record[votes]})
+	}
+	return rows
+}
+
+func TestExportContestHistoryCSV(t *testing.T) {
+	r := exportTestRouter(t)
+	w := getExport(t, r, "/2024_general/contest/Mayor-King_County/history.csv", "text/csv", "2024_general_Mayor-King_County.csv")
+	body := w.Body.String()
+	if !strings.Contains(body, `"Smith, ""Al"""`) || !strings.Contains(body, `"Independent, Reform"`) {
+		t.Errorf("commas and quotes not escaped:\n%s", body)
+	}
+	got := readExportCSV(t, body)
+	want := [][]string{
+		{`Smith, "Al"`, "100"}, {"Bob Jones", "50"},
+		{`Smith, "Al"`, "150"}, {"Bob Jones", "150"},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("history rows = %q, want %q", got, want)
+	}
+}
+
+func TestExportElectionResults(t *testing.T) {
+	r := exportTestRouter(t)
+	w := getExport(t, r, "/2024_general/results.csv?category=measure", "text/csv", "2024_general_results.csv")
+	if got, want := readExportCSV(t, w.Body.String()), [][]string{{"Yes", "10"}}; !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("measure rows = %q, want %q", got, want)
+	}
+
+	w = getExport(t, r, "/2024_general/results.json", "application/json", "2024_general_results.json")
+	var rows []map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want 3", len(rows))
+	}
+	for _, row := range rows {
+		if len(row) != len(exportHeader) {
+			t.Errorf("row %v has %d fields, want %d", row, len(row), len(exportHeader))
+		}
+		for _, column := range exportHeader {
+			if _, ok := row[column]; !ok {
+				t.Errorf("row %v has no %s", row, column)
+			}
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/2024_general/results.csv?category=tribal", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GET with an unknown category = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/danielhep/go-elections/internal"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+//go:embed schema.graphql
+var graphqlSchema string
+
+// Limits that keep public queries cheap. Depth and the most a query can cost
+// are checked before it runs, and its cost is counted again while it runs;
+// see graphqlcost.go for what things cost.
+const (
+	maxQueryDepth  = 8
+	maxQueryCost   = 10000
+	maxQueryBytes  = 16 << 10
+	maxListLength  = 100
+	maxParallelism = 10
+)
+
+type costKey struct{}
+
+// Counts objects or a store call against the query's cost budget.
+func charge(ctx context.Context, n int) error {
+	cost, ok := ctx.Value(costKey{}).(*atomic.Int64)
+	if !ok {
+		return nil
+	}
+	if cost.Add(int64(n)) > maxQueryCost {
+		return fmt.Errorf("query is too complex, it would cost more than %d", maxQueryCost)
+	}
+	return nil
+}
+
+// Applies first/offset arguments, capping first at maxListLength.
+func pageOf[T any](items []T, first int32, offset int32) []T {
+	start := min(max(int(offset), 0), len(items))
+	end := min(start+min(max(int(first), 0), maxListLength), len(items))
+	return items[start:end]
+}
+
+type rootResolver struct {
+	store internal.Store
+}
+
+func (r *rootResolver) Elections(ctx context.Context, args struct{ IncludeArchived bool }) ([]*electionResolver, error) {
+	if err := charge(ctx, listCost); err != nil {
+		return nil, err
+	}
+	elections, err := r.store.ListElections(args.IncludeArchived)
+	if err != nil {
+		return nil, err
+	}
+	if err := charge(ctx, len(elections)); err != nil {
+		return nil, err
+	}
+	ret := make([]*electionResolver, len(elections))
+	for i, election := range elections {
+		ret[i] = &electionResolver{store: r.store, election: election}
+	}
+	return ret, nil
+}
+
+func (r *rootResolver) Election(ctx context.Context, args struct{ ID graphql.ID }) (*electionResolver, error) {
+	if err := charge(ctx, findCost); err != nil {
+		return nil, err
+	}
+	election, err := r.store.FindElection(string(args.ID))
+	if err != nil {
+		return nil, nil
+	}
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+	return &electionResolver{store: r.store, election: *election}, nil
+}
+
+type electionResolver struct {
+	store    internal.Store
+	election internal.Election
+}
+
+func (r *electionResolver) ID() graphql.ID { return graphql.ID(r.election.ID) }
+func (r *electionResolver) Name() string   { return r.election.Name }
+func (r *electionResolver) Date() string   { return r.election.ElectionDate.Format("2006-01-02") }
+func (r *electionResolver) Type() string   { return string(r.election.Type) }
+func (r *electionResolver) Status() string { return string(r.election.Status) }
+
+func (r *electionResolver) Contests(ctx context.Context, args struct {
+	District     *string
+	Jurisdiction *string
+	Category     *string
+	Level        *string
+	First        int32
+	Offset       int32
+}) ([]*contestResolver, error) {
+	if err := charge(ctx, listCost); err != nil {
+		return nil, err
+	}
+	contests, err := r.store.ListContests(r.election.ID)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(contests, func(a, b internal.Contest) int { return strings.Compare(a.ContestKey, b.ContestKey) })
+	contests = slices.DeleteFunc(contests, func(contest internal.Contest) bool {
+		return (args.District != nil && !strings.EqualFold(contest.District, *args.District)) ||
+			(args.Jurisdiction != nil && !slices.Contains(contest.Jurisdictions, *args.Jurisdiction)) ||
+			(args.Category != nil && string(contest.Category) != *args.Category) ||
+			(args.Level != nil && string(contest.Level) != *args.Level)
+	})
+	contests = pageOf(contests, args.First, args.Offset)
+	if err := charge(ctx, len(contests)); err != nil {
+		return nil, err
+	}
+	ret := make([]*contestResolver, len(contests))
+	for i, contest := range contests {
+		ret[i] = &contestResolver{store: r.store, contest: contest}
+	}
+	return ret, nil
+}
+
+func (r *electionResolver) Contest(ctx context.Context, args struct{ Key string }) (*contestResolver, error) {
+	if err := charge(ctx, findCost); err != nil {
+		return nil, err
+	}
+	contest, err := r.store.FindContest(r.election.ID, args.Key)
+	if err != nil {
+		return nil, nil
+	}
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+	return &contestResolver{store: r.store, contest: *contest}, nil
+}
+
+func (r *electionResolver) Updates(ctx context.Context, args struct {
+	Jurisdiction *string
+	First        int32
+	Offset       int32
+}) ([]*updateResolver, error) {
+	if err := charge(ctx, listCost); err != nil {
+		return nil, err
+	}
+	updates, err := r.store.ListUpdates(r.election.ID)
+	if err != nil {
+		return nil, err
+	}
+	updates = slices.DeleteFunc(updates, func(update internal.Update) bool {
+		return update.RetractedAt != nil ||
+			(args.Jurisdiction != nil && string(update.JurisdictionType) != *args.Jurisdiction)
+	})
+	updates = pageOf(updates, args.First, args.Offset)
+	if err := charge(ctx, len(updates)); err != nil {
+		return nil, err
+	}
+	ret := make([]*updateResolver, len(updates))
+	for i, update := range updates {
+		ret[i] = &updateResolver{update: update}
+	}
+	return ret, nil
+}
+
+// Resolves a contest, loading its candidates and current results once however
+// many of the fields that need them are selected.
+type contestResolver struct {
+	store      internal.Store
+	contest    internal.Contest
+	once       sync.Once
+	candidates []internal.BallotResponse
+	results    []internal.ContestResult
+	err        error
+}
+
+func (r *contestResolver) load(ctx context.Context) error {
+	r.once.Do(func() {
+		if r.err = charge(ctx, contestLoadCost); r.err != nil {
+			return
+		}
+		if r.candidates, r.err = r.store.ContestCandidates(r.contest.ID); r.err != nil {
+			return
+		}
+		if r.results, r.err = r.store.CurrentResults(r.contest.ID); r.err != nil {
+			return
+		}
+		sortCandidatesByRank(r.candidates, r.results)
+	})
+	return r.err
+}
+
+func (r *contestResolver) candidateResolver(candidate internal.BallotResponse) *ballotResponseResolver {
+	ret := &ballotResponseResolver{candidate: candidate}
+	for i, result := range r.results {
+		if result.BallotResponseID == candidate.ID {
+			ret.result = &r.results[i]
+		}
+	}
+	return ret
+}
+
+func (r *contestResolver) Key() string         { return r.contest.ContestKey }
+func (r *contestResolver) BallotTitle() string { return r.contest.BallotTitle }
+func (r *contestResolver) District() string    { return r.contest.District }
+func (r *contestResolver) Category() string    { return string(r.contest.Category) }
+func (r *contestResolver) Level() string       { return string(r.contest.Level) }
+
+func (r *contestResolver) Jurisdictions() []string {
+	if r.contest.Jurisdictions == nil {
+		return []string{}
+	}
+	return r.contest.Jurisdictions
+}
+
+func (r *contestResolver) Election(ctx context.Context) (*electionResolver, error) {
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+	return &electionResolver{store: r.store, election: r.contest.Election}, nil
+}
+
+func (r *contestResolver) Candidates(ctx context.Context) ([]*ballotResponseResolver, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	if err := charge(ctx, len(r.candidates)); err != nil {
+		return nil, err
+	}
+	ret := make([]*ballotResponseResolver, len(r.candidates))
+	for i, candidate := range r.candidates {
+		ret[i] = r.candidateResolver(candidate)
+	}
+	return ret, nil
+}
+
+func (r *contestResolver) Leader(ctx context.Context) (*ballotResponseResolver, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	if len(r.results) == 0 {
+		return nil, nil
+	}
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+	for _, candidate := range r.candidates {
+		if candidate.ID == r.results[0].BallotResponseID {
+			return r.candidateResolver(candidate), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *contestResolver) Margin(ctx context.Context) (*int32, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	if len(r.results) < 2 {
+		return nil, nil
+	}
+	margin := int32(r.results[0].MarginToNext)
+	return &margin, nil
+}
+
+func (r *contestResolver) TotalVotes(ctx context.Context) (int32, error) {
+	if err := r.load(ctx); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, result := range r.results {
+		total += result.Votes
+	}
+	return int32(total), nil
+}
+
+func (r *contestResolver) ResultsJurisdiction(ctx context.Context) (*string, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	if len(r.results) == 0 {
+		return nil, nil
+	}
+	jType := string(r.results[0].JurisdictionType)
+	return &jType, nil
+}
+
+func (r *contestResolver) Projection(ctx context.Context) (*projectionResolver, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	projection := internal.ProjectContest(r.candidates, r.contest.Election)
+	if projection == nil {
+		return nil, nil
+	}
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+	return &projectionResolver{contest: r, projection: *projection}, nil
+}
+
+type projectionResolver struct {
+	contest    *contestResolver
+	projection internal.Projection
+}
+
+func (r *projectionResolver) Status() string { return string(r.projection.Status) }
+
+func (r *projectionResolver) Leader() *ballotResponseResolver {
+	return r.contest.candidateResolver(r.projection.Leader)
+}
+
+func (r *projectionResolver) Trailer() *ballotResponseResolver {
+	return r.contest.candidateResolver(r.projection.Trailer)
+}
+
+func (r *projectionResolver) Winner() *ballotResponseResolver {
+	return r.contest.candidateResolver(r.projection.Winner())
+}
+
+func (r *projectionResolver) CurrentMargin() int32 {
+	return int32(r.projection.LeaderVotes - r.projection.TrailerVotes)
+}
+
+func (r *projectionResolver) BallotsOutstanding() int32 {
+	return int32(r.projection.BallotsOutstanding)
+}
+
+func (r *projectionResolver) Final() bool              { return r.projection.Final }
+func (r *projectionResolver) Margin() int32            { return int32(r.projection.Margin) }
+func (r *projectionResolver) MarginPerBallot() float64 { return r.projection.MarginPerBallot }
+
+func (r *projectionResolver) MarginLow() *int32 {
+	if !r.projection.HasInterval() {
+		return nil
+	}
+	low := int32(r.projection.MarginLow)
+	return &low
+}
+
+func (r *projectionResolver) MarginHigh() *int32 {
+	if !r.projection.HasInterval() {
+		return nil
+	}
+	high := int32(r.projection.MarginHigh)
+	return &high
+}
+
+type ballotResponseResolver struct {
+	candidate internal.BallotResponse
+	// Nil if the candidate has no current results
+	result *internal.ContestResult
+}
+
+func (r *ballotResponseResolver) ID() graphql.ID {
+	return graphql.ID(fmt.Sprint(r.candidate.ID))
+}
+func (r *ballotResponseResolver) Name() string   { return r.candidate.Name }
+func (r *ballotResponseResolver) Party() *string { return r.candidate.Party }
+
+func (r *ballotResponseResolver) LatestVotes() *int32 {
+	if r.result == nil {
+		return nil
+	}
+	votes := int32(r.result.Votes)
+	return &votes
+}
+
+func (r *ballotResponseResolver) LatestPercent() *float64 {
+	if r.result == nil {
+		return nil
+	}
+	percent := roundPercent(r.result.Percent)
+	return &percent
+}
+
+func (r *ballotResponseResolver) Rank() *int32 {
+	if r.result == nil {
+		return nil
+	}
+	rank := int32(r.result.Rank)
+	return &rank
+}
+
+func (r *ballotResponseResolver) Tallies(ctx context.Context, args struct {
+	Jurisdiction *string
+	First        int32
+	Offset       int32
+}) ([]*voteTallyResolver, error) {
+	tallies := slices.Clone(r.candidate.VoteTallies)
+	tallies = slices.DeleteFunc(tallies, func(tally internal.VoteTally) bool {
+		return args.Jurisdiction != nil && string(tally.Update.JurisdictionType) != *args.Jurisdiction
+	})
+	slices.SortFunc(tallies, func(a, b internal.VoteTally) int {
+		if c := a.Update.Timestamp.Compare(b.Update.Timestamp); c != 0 {
+			return c
+		}
+		return int(a.UpdateID) - int(b.UpdateID)
+	})
+	tallies = pageOf(tallies, args.First, args.Offset)
+	if err := charge(ctx, len(tallies)); err != nil {
+		return nil, err
+	}
+	ret := make([]*voteTallyResolver, len(tallies))
+	for i, tally := range tallies {
+		ret[i] = &voteTallyResolver{tally: tally}
+	}
+	return ret, nil
+}
+
+type voteTallyResolver struct {
+	tally internal.VoteTally
+}
+
+func (r *voteTallyResolver) Votes() int32     { return int32(r.tally.Votes) }
+func (r *voteTallyResolver) Percent() float64 { return roundPercent(float64(r.tally.VotePercentage)) }
+
+func (r *voteTallyResolver) Update(ctx context.Context) (*updateResolver, error) {
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+	return &updateResolver{update: r.tally.Update}, nil
+}
+
+type updateResolver struct {
+	update internal.Update
+}
+
+func (r *updateResolver) ID() graphql.ID {
+	return graphql.ID(fmt.Sprint(r.update.ID))
+}
+func (r *updateResolver) Timestamp() graphql.Time { return graphql.Time{Time: r.update.Timestamp} }
+func (r *updateResolver) Jurisdiction() string    { return string(r.update.JurisdictionType) }
+func (r *updateResolver) Hash() string            { return r.update.Hash }
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Serves the GraphQL API over GET (query parameter) and POST (JSON body).
+func graphqlHandler(store internal.Store) http.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &rootResolver{store: store},
+		graphql.MaxDepth(maxQueryDepth),
+		graphql.MaxParallelism(maxParallelism),
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		if r.Method == http.MethodGet {
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+			if v := r.URL.Query().Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					http.Error(w, "Invalid variables", http.StatusBadRequest)
+					return
+				}
+			}
+		} else {
+			r.Body = http.MaxBytesReader(w, r.Body, maxQueryBytes)
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if len(req.Query) > maxQueryBytes {
+			http.Error(w, "Query is too long", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Invalid queries are left to Exec, which reports what's wrong with them
+		if errs := schema.Validate(req.Query); len(errs) == 0 {
+			cost, err := queryCost(schema.ASTSchema(), req.Query, req.OperationName, req.Variables)
+			if err == nil && cost > maxQueryCost {
+				err = fmt.Errorf("query is too complex, it could cost %d, more than %d", cost, maxQueryCost)
+			}
+			if err != nil {
+				writeJSON(w, http.StatusOK, &graphql.Response{Errors: []*gqlerrors.QueryError{gqlerrors.Errorf("%v", err)}})
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), costKey{}, new(atomic.Int64))
+		response := schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+		writeJSON(w, http.StatusOK, response)
+	})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danielhep/go-elections/internal"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// Returns a memory store with an election that has a county update and a
+// precinct update.
+func precinctTestStore(t *testing.T) internal.Store {
+	t.Helper()
+	store := internal.NewMemoryStore()
+	date := time.Date(2024, time.November, 5, 0, 0, 0, 0, time.UTC)
+	election := internal.Election{ID: "2024_general", Name: "2024 General", ElectionDate: date, Type: internal.GeneralElection}
+	if err := store.CreateElection(&election); err != nil {
+		t.Fatal(err)
+	}
+	county := []internal.GenericVoteRecord{{
+		DistrictName:     "City of Seattle",
+		BallotTitle:      "Mayor",
+		BallotResponse:   "Alice",
+		Votes:            150,
+		JurisdictionType: internal.CountyJurisdiction,
+	}}
+	if err := store.LoadUpdate(county, "county", date.Add(time.Hour), election); err != nil {
+		t.Fatal(err)
+	}
+	precinct := []internal.GenericVoteRecord{{
+		BallotTitle:      "Mayor",
+		BallotResponse:   "Alice",
+		Votes:            40,
+		JurisdictionType: internal.PrecinctJurisdiction,
+		Precinct:         internal.Precinct{Name: "SEA 11-1234", LegislativeDistrict: "43"},
+	}}
+	if err := store.LoadUpdate(precinct, "precinct", date.Add(2*time.Hour), election); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestGraphQLPrecinctUpdates(t *testing.T) {
+	handler := graphqlHandler(precinctTestStore(t))
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"all updates", `{ election(id: "2024_general") { updates { jurisdiction hash } } }`, []string{"County", "Precinct"}},
+		{"precinct updates", `{ election(id: "2024_general") { updates(jurisdiction: Precinct) { jurisdiction hash } } }`, []string{"Precinct"}},
+		{"county updates", `{ election(id: "2024_general") { updates(jurisdiction: County) { jurisdiction hash } } }`, []string{"County"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, _ := json.Marshal(graphqlRequest{Query: test.query})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+			var response struct {
+				Data struct {
+					Election struct {
+						Updates []struct{ Jurisdiction string }
+					}
+				}
+				Errors []struct{ Message string }
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Errors) > 0 {
+				t.Fatalf("errors: %v", response.Errors)
+			}
+			var got []string
+			for _, update := range response.Data.Election.Updates {
+				got = append(got, update.Jurisdiction)
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("jurisdictions = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryCost(t *testing.T) {
+	schema := graphql.MustParseSchema(graphqlSchema, &rootResolver{})
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		want      int
+	}{
+		{"one election", `{ election(id: "x") { name } }`, nil, findCost + 1},
+		{
+			"default page of contests",
+			`{ election(id: "x") { contests { ballotTitle leader { name } } } }`, nil,
+			findCost + 1 + listCost + 50*(1+1+contestLoadCost),
+		},
+		{
+			"fields sharing a load",
+			`{ election(id: "x") { contest(key: "k") { margin totalVotes candidates { name } } } }`, nil,
+			findCost + 1 + findCost + 1 + contestLoadCost + 10,
+		},
+		{
+			"nested contests",
+			`{ election(id: "x") { contests(first: 100) { election { contests(first: 100) { key } } } } }`, nil,
+			findCost + 1 + listCost + 100*(1+1+listCost+100),
+		},
+		{
+			"first over the cap",
+			`{ election(id: "x") { updates(first: 1000) { hash } } }`, nil,
+			findCost + 1 + listCost + maxListLength,
+		},
+		{
+			"variable default",
+			`query Q($n: Int = 5) { elections { contests(first: $n) { key } } }`, nil,
+			listCost + 20*(1+listCost+5),
+		},
+		{
+			"variable",
+			`query Q($n: Int = 5) { elections { contests(first: $n) { key } } }`, map[string]any{"n": float64(10)},
+			listCost + 20*(1+listCost+10),
+		},
+		{
+			"fragments",
+			`{ election(id: "x") { ...f ... on Election { name } } } fragment f on Election { updates(first: 3) { hash } }`, nil,
+			findCost + 1 + listCost + 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if errs := schema.Validate(test.query); len(errs) > 0 {
+				t.Fatalf("invalid query: %v", errs)
+			}
+			got, err := queryCost(schema.ASTSchema(), test.query, "", test.variables)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("queryCost = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// Counts the contests loaded from the store.
+type countingStore struct {
+	internal.Store
+	loads int
+}
+
+func (s *countingStore) ListContests(electionID string) ([]internal.Contest, error) {
+	s.loads++
+	return s.Store.ListContests(electionID)
+}
+
+func (s *countingStore) ContestCandidates(contestID uint) ([]internal.BallotResponse, error) {
+	s.loads++
+	return s.Store.ContestCandidates(contestID)
+}
+
+func TestGraphQLRejectsCostlyQueries(t *testing.T) {
+	store := &countingStore{Store: precinctTestStore(t)}
+	handler := graphqlHandler(store)
+	query := `{ election(id: "2024_general") { contests(first: 100) { election { contests(first: 100) { key } } } } }`
+	body, _ := json.Marshal(graphqlRequest{Query: query})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if !strings.Contains(rec.Body.String(), "too complex") {
+		t.Errorf("response = %s, want a too complex error", rec.Body.String())
+	}
+	if store.loads != 0 {
+		t.Errorf("store was queried %d times for a rejected query", store.loads)
+	}
+
+	body, _ = json.Marshal(graphqlRequest{Query: `{ election(id: "2024_general") { contests { key totalVotes } } }`})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if strings.Contains(rec.Body.String(), "errors") {
+		t.Errorf("response = %s, want no errors", rec.Body.String())
+	}
+}
+
+func TestGraphQLChargesBeforeLoading(t *testing.T) {
+	store := &countingStore{Store: precinctTestStore(t)}
+	election := &electionResolver{store: store, election: internal.Election{ID: "2024_general"}}
+	spent := new(atomic.Int64)
+	spent.Store(maxQueryCost)
+	ctx := context.WithValue(context.Background(), costKey{}, spent)
+	if _, err := election.Contests(ctx, struct {
+		District     *string
+		Jurisdiction *string
+		Category     *string
+		Level        *string
+		First        int32
+		Offset       int32
+	}{First: 50}); err == nil {
+		t.Error("Contests succeeded over budget")
+	}
+	contest := &contestResolver{store: store}
+	if _, err := contest.TotalVotes(ctx); err == nil {
+		t.Error("TotalVotes succeeded over budget")
+	}
+	if store.loads != 0 {
+		t.Errorf("store was queried %d times over budget", store.loads)
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/graph-gophers/graphql-go/types"
+)
+
+// A query's cost is one per object it resolves, plus a fixed weight for every
+// field that goes to the store. Resolvers charge the weight before calling the
+// store and the objects once they have them. Before a query runs, its cost is
+// worked out from the query text assuming every list is as long as it may be,
+// and queries over maxQueryCost are rejected without touching the store.
+const (
+	// Looking up one election or contest
+	findCost = 1
+	// Listing the elections, or an election's contests or updates
+	listCost = 10
+	// Loading a contest's candidates with every tally, and its results
+	contestLoadCost = 20
+)
+
+// Store-backed fields and what they're charged on top of their objects.
+var fieldWeights = map[string]int{
+	"Query.elections":   listCost,
+	"Query.election":    findCost,
+	"Election.contests": listCost,
+	"Election.contest":  findCost,
+	"Election.updates":  listCost,
+}
+
+// Contest fields that need the contest's candidates and results, which are
+// loaded once per contest.
+var contestLoadFields = []string{"candidates", "leader", "margin", "totalVotes", "resultsJurisdiction", "projection"}
+
+// Lengths assumed for lists without a first argument.
+var listSizes = map[string]int{
+	"Query.elections":    20,
+	"Contest.candidates": 10,
+}
+
+// Returns the most a query can cost. The query must have passed validation
+// against schema.
+func queryCost(schema *types.Schema, query string, operationName string, variables map[string]any) (int, error) {
+	doc, err := parseCostDocument(query)
+	if err != nil {
+		return 0, err
+	}
+	var op *costOperation
+	for i := range doc.operations {
+		if operationName == "" || doc.operations[i].name == operationName {
+			op = &doc.operations[i]
+			break
+		}
+	}
+	if op == nil {
+		return 0, fmt.Errorf("operation %q not found", operationName)
+	}
+	root, ok := schema.EntryPoints["query"]
+	if !ok {
+		return 0, fmt.Errorf("schema has no query type")
+	}
+	vars := make(map[string]any)
+	for name, value := range op.defaults {
+		vars[name] = value
+	}
+	for name, value := range variables {
+		vars[name] = value
+	}
+	e := costEstimator{schema: schema, fragments: doc.fragments, variables: vars}
+	return e.selectionCost(root.TypeName(), op.selections, 0), nil
+}
+
+type costEstimator struct {
+	schema    *types.Schema
+	fragments map[string]costFragment
+	variables map[string]any
+}
+
+func (e *costEstimator) selectionCost(typeName string, selections []costSelection, depth int) int {
+	if depth > maxQueryDepth {
+		return 0
+	}
+	object, ok := e.schema.Types[typeName].(*types.ObjectTypeDefinition)
+	if !ok {
+		return 0
+	}
+	cost := 0
+	loads := false
+	for _, selection := range e.flatten(selections, 0) {
+		def := object.Fields.Get(selection.name)
+		if def == nil {
+			continue
+		}
+		if typeName == "Contest" && slices.Contains(contestLoadFields, selection.name) {
+			loads = true
+		}
+		cost += e.fieldCost(typeName, def, selection, depth)
+	}
+	if loads {
+		cost += contestLoadCost
+	}
+	return cost
+}
+
+func (e *costEstimator) fieldCost(typeName string, def *types.FieldDefinition, selection costSelection, depth int) int {
+	key := typeName + "." + def.Name
+	cost := fieldWeights[key]
+	named, list := unwrapType(def.Type)
+	if _, ok := e.schema.Types[named].(*types.ObjectTypeDefinition); !ok {
+		return cost
+	}
+	count := 1
+	if list {
+		count = e.listSize(key, def, selection)
+	}
+	return cost + count*(1+e.selectionCost(named, selection.selections, depth+1))
+}
+
+// Returns the most items a list field can return: its first argument, capped
+// at maxListLength, or the size assumed for lists that aren't paginated.
+func (e *costEstimator) listSize(key string, def *types.FieldDefinition, selection costSelection) int {
+	arg := def.Arguments.Get("first")
+	if arg == nil {
+		if size, ok := listSizes[key]; ok {
+			return size
+		}
+		return maxListLength
+	}
+	first := maxListLength
+	if value, ok := selection.args["first"]; ok {
+		if name, isVariable := value.(costVariable); isVariable {
+			value = e.variables[string(name)]
+		}
+		if n, ok := costInt(value); ok {
+			first = n
+		}
+	} else if arg.Default != nil {
+		if n, ok := costInt(arg.Default.Deserialize(nil)); ok {
+			first = n
+		}
+	}
+	return min(max(first, 0), maxListLength)
+}
+
+// Expands fragment spreads and inline fragments into the fields they select.
+func (e *costEstimator) flatten(selections []costSelection, depth int) []costSelection {
+	var fields []costSelection
+	for _, selection := range selections {
+		switch {
+		case selection.fragment != "":
+			if fragment, ok := e.fragments[selection.fragment]; ok && depth <= maxQueryDepth {
+				fields = append(fields, e.flatten(fragment.selections, depth+1)...)
+			}
+		case selection.name == "":
+			fields = append(fields, e.flatten(selection.selections, depth+1)...)
+		default:
+			fields = append(fields, selection)
+		}
+	}
+	return fields
+}
+
+func unwrapType(t types.Type) (name string, list bool) {
+	for {
+		switch u := t.(type) {
+		case *types.NonNull:
+			t = u.OfType
+		case *types.List:
+			list = true
+			t = u.OfType
+		default:
+			return t.String(), list
+		}
+	}
+}
+
+func costInt(value any) (int, bool) {
+	switch n := value.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+type costDocument struct {
+	operations []costOperation
+	fragments  map[string]costFragment
+}
+
+type costOperation struct {
+	name       string
+	defaults   map[string]any
+	selections []costSelection
+}
+
+type costFragment struct {
+	selections []costSelection
+}
+
+// A field (name set), fragment spread (fragment set) or inline fragment
+// (neither set).
+type costSelection struct {
+	name       string
+	fragment   string
+	args       map[string]any
+	selections []costSelection
+}
+
+// A $variable used as an argument.
+type costVariable string
+
+type costToken struct {
+	kind  byte // 'n' name, 'i' int, 'f' float, 's' string, 'v' variable, or the punctuator
+	value string
+}
+
+// Splits a query into tokens, dropping whitespace, commas and comments.
+func lexCostQuery(query string) ([]costToken, error) {
+	var tokens []costToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(query[i:], "\uFEFF"):
+			i += len("\uFEFF")
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "..."):
+			tokens = append(tokens, costToken{kind: '.'})
+			i += 3
+		case strings.ContainsRune("!():=@[]{}|&", rune(c)):
+			tokens = append(tokens, costToken{kind: c})
+			i++
+		case c == '$':
+			j := scanName(query, i+1)
+			tokens = append(tokens, costToken{kind: 'v', value: query[i+1 : j]})
+			i = j
+		case c == '_' || isLetter(c):
+			j := scanName(query, i)
+			tokens = append(tokens, costToken{kind: 'n', value: query[i:j]})
+			i = j
+		case c == '-' || isDigit(c):
+			j := i + 1
+			kind := byte('i')
+			for j < len(query) && (isDigit(query[j]) || strings.IndexByte(".eE+-", query[j]) >= 0) {
+				if !isDigit(query[j]) {
+					kind = 'f'
+				}
+				j++
+			}
+			tokens = append(tokens, costToken{kind: kind, value: query[i:j]})
+			i = j
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(strings.ReplaceAll(query[i+3:], `\"""`, "xxxx"), `"""`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, costToken{kind: 's'})
+			i += 3 + end + 3
+		case c == '"':
+			j := i + 1
+			for j < len(query) && query[j] != '"' {
+				if query[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(query) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, costToken{kind: 's'})
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+func scanName(query string, i int) int {
+	for i < len(query) && (query[i] == '_' || isLetter(query[i]) || isDigit(query[i])) {
+		i++
+	}
+	return i
+}
+
+type costParser struct {
+	tokens []costToken
+	pos    int
+}
+
+func parseCostDocument(query string) (*costDocument, error) {
+	tokens, err := lexCostQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &costParser{tokens: tokens}
+	doc := &costDocument{fragments: make(map[string]costFragment)}
+	for !p.done() {
+		switch {
+		case p.peek('{'):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, costOperation{selections: selections})
+		case p.peekName("fragment"):
+			p.pos++
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			// on Type
+			p.pos += 2
+			if err := p.directives(); err != nil {
+				return nil, err
+			}
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.fragments[name] = costFragment{selections: selections}
+		case p.peekName("query") || p.peekName("mutation") || p.peekName("subscription"):
+			p.pos++
+			op := costOperation{defaults: make(map[string]any)}
+			if p.peek('n') {
+				op.name = p.tokens[p.pos].value
+				p.pos++
+			}
+			if err := p.variableDefinitions(op.defaults); err != nil {
+				return nil, err
+			}
+			if err := p.directives(); err != nil {
+				return nil, err
+			}
+			if op.selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	return doc, nil
+}
+
+func (p *costParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *costParser) peek(kind byte) bool {
+	return !p.done() && p.tokens[p.pos].kind == kind
+}
+
+func (p *costParser) peekName(name string) bool {
+	return p.peek('n') && p.tokens[p.pos].value == name
+}
+
+func (p *costParser) unexpected() error {
+	if p.done() {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected token %q", string(p.tokens[p.pos].kind)+p.tokens[p.pos].value)
+}
+
+func (p *costParser) expect(kind byte) error {
+	if !p.peek(kind) {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+func (p *costParser) name() (string, error) {
+	if !p.peek('n') {
+		return "", p.unexpected()
+	}
+	p.pos++
+	return p.tokens[p.pos-1].value, nil
+}
+
+func (p *costParser) variableDefinitions(defaults map[string]any) error {
+	if !p.peek('(') {
+		return nil
+	}
+	p.pos++
+	for !p.peek(')') {
+		if !p.peek('v') {
+			return p.unexpected()
+		}
+		name := p.tokens[p.pos].value
+		p.pos++
+		if err := p.expect(':'); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.peek('=') {
+			p.pos++
+			value, err := p.value()
+			if err != nil {
+				return err
+			}
+			defaults[name] = value
+		}
+		if err := p.directives(); err != nil {
+			return err
+		}
+	}
+	p.pos++
+	return nil
+}
+
+func (p *costParser) skipType() error {
+	if p.peek('[') {
+		p.pos++
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect(']'); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek('!') {
+		p.pos++
+	}
+	return nil
+}
+
+func (p *costParser) directives() error {
+	for p.peek('@') {
+		p.pos++
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if _, err := p.arguments(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *costParser) arguments() (map[string]any, error) {
+	args := make(map[string]any)
+	if !p.peek('(') {
+		return args, nil
+	}
+	p.pos++
+	for !p.peek(')') {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	p.pos++
+	return args, nil
+}
+
+// Parses a value, returning ints and variables and nil for anything else.
+func (p *costParser) value() (any, error) {
+	if p.done() {
+		return nil, p.unexpected()
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case 'i':
+		n, err := strconv.Atoi(token.value)
+		if err != nil {
+			return nil, nil
+		}
+		return n, nil
+	case 'v':
+		return costVariable(token.value), nil
+	case 'f', 's', 'n':
+		return nil, nil
+	case '[':
+		for !p.peek(']') {
+			if _, err := p.value(); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+		return nil, nil
+	case '{':
+		for !p.peek('}') {
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			if _, err := p.value(); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+		return nil, nil
+	}
+	p.pos--
+	return nil, p.unexpected()
+}
+
+func (p *costParser) selectionSet() ([]costSelection, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var selections []costSelection
+	for !p.peek('}') {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.pos++
+	return selections, nil
+}
+
+func (p *costParser) selection() (costSelection, error) {
+	var selection costSelection
+	var err error
+	if p.peek('.') {
+		p.pos++
+		if p.peek('n') && !p.peekName("on") {
+			selection.fragment = p.tokens[p.pos].value
+			p.pos++
+			return selection, p.directives()
+		}
+		if p.peekName("on") {
+			p.pos += 2
+		}
+		if err := p.directives(); err != nil {
+			return selection, err
+		}
+		selection.selections, err = p.selectionSet()
+		return selection, err
+	}
+	if selection.name, err = p.name(); err != nil {
+		return selection, err
+	}
+	if p.peek(':') {
+		p.pos++
+		if selection.name, err = p.name(); err != nil {
+			return selection, err
+		}
+	}
+	if selection.args, err = p.arguments(); err != nil {
+		return selection, err
+	}
+	if err := p.directives(); err != nil {
+		return selection, err
+	}
+	if p.peek('{') {
+		selection.selections, err = p.selectionSet()
+	}
+	return selection, err
+}
@@ -39,7 +39,15 @@ func layout(title string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</title><script src=\"https://cdn.tailwindcss.com\"></script><script src=\"https://cdn.jsdelivr.net/npm/alpinejs@3.x.x/dist/cdn.min.js\"></script><script src=\"https://cdn.jsdelivr.net/npm/chart.js\"></script><script src=\"https://unpkg.com/htmx.org@2.0.2\"></script></head><body class=\"min-h-screen bg-gray-100\"><header class=\"bg-white shadow\"><div class=\"max-w-7xl mx-auto py-6 px-4 sm:px-6 lg:px-8\"><h1 class=\"text-3xl font-bold text-gray-900\"><a href=\"/\">King County Election Data Dashboard</a></h1></div></header><main><div class=\"max-w-7xl mx-auto py-6 px-4 sm:px-6 lg:px-8\">")
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</title><link rel=\"stylesheet\" href=\"/static/vendor/tailwind.css\"><script defer src=\"/static/vendor/alpine.min.js\"></script><script src=\"/static/vendor/chart.umd.min.js\"></script><script src=\"/static/vendor/htmx.min.js\"></script></head><body class=\"min-h-screen bg-gray-100\"><header class=\"bg-white shadow\"><div class=\"max-w-7xl mx-auto py-6 px-4 sm:px-6 lg:px-8 flex flex-col md:flex-row md:items-center md:justify-between gap-4\"><h1 class=\"text-3xl font-bold text-gray-900\"><a href=\"/\">King County Election Data Dashboard</a></h1>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = searchBox("").Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString("</div></header><main><div class=\"max-w-7xl mx-auto py-6 px-4 sm:px-6 lg:px-8\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/danielhep/go-elections/internal"
+	"github.com/gorilla/mux"
+)
+
+const mapWidth = 600.0
+
+// resultsMap is a contest's results map of one kind of area, projected to
+// SVG paths so it renders without any map tiles or scripts.
+type resultsMap struct {
+	Kind   internal.BoundaryKind
+	Width  float64
+	Height float64
+	Areas  []mapArea
+	// Areas with results, out of all of the areas
+	Reporting int
+}
+
+type mapArea struct {
+	Name    string
+	Path    string
+	Fill    string
+	Opacity float64
+	Title   string
+}
+
+// Margin bands the areas are shaded by, from the closest up. An area is as
+// opaque as the first band its leader's margin is under.
+var marginBands = []struct {
+	Under   float64
+	Label   string
+	Opacity float64
+}{
+	{5, "Under 5 pts", 0.35},
+	{15, "5–15 pts", 0.6},
+	{30, "15–30 pts", 0.8},
+	{math.Inf(1), "Over 30 pts", 1},
+}
+
+func marginOpacity(margin float64) float64 {
+	for _, band := range marginBands {
+		if margin < band.Under {
+			return band.Opacity
+		}
+	}
+	return 1
+}
+
+// Returns a contest's results joined with an election's boundaries of one
+// kind, or nil when there are no boundaries or no results to map.
+func contestResultsMap(store internal.Store, contest internal.Contest, candidates []internal.BallotResponse, kind internal.BoundaryKind) (*internal.FeatureCollection, error) {
+	areas, err := internal.AreaResults(store, contest.ID, kind)
+	if err != nil || len(areas) == 0 {
+		return nil, err
+	}
+	boundaries, err := store.Boundaries(contest.ElectionID, kind)
+	if err != nil || len(boundaries) == 0 {
+		return nil, err
+	}
+	collection := internal.ResultsMap(boundaries, kind, areas, candidates)
+	return &collection, nil
+}
+
+// Returns the results maps of a contest for each kind of boundaries the
+// election has. candidates are expected in rank order, which picks their
+// colors unless their parties do.
+func contestMaps(store internal.Store, contest internal.Contest, candidates []internal.BallotResponse) ([]resultsMap, error) {
+	counts, err := store.BoundaryCounts(contest.ElectionID)
+	if err != nil {
+		return nil, err
+	}
+	colors := make(map[string]string)
+	for i, color := range candidateColorsFor(candidates) {
+		colors[candidates[i].Name] = color
+	}
+	var maps []resultsMap
+	for _, kind := range internal.BoundaryKinds {
+		if counts[kind] == 0 {
+			continue
+		}
+		collection, err := contestResultsMap(store, contest, candidates, kind)
+		if err != nil {
+			return nil, err
+		}
+		if collection == nil {
+			continue
+		}
+		m, err := projectMap(*collection, colors)
+		if err != nil {
+			return nil, err
+		}
+		m.Kind = kind
+		maps = append(maps, m)
+	}
+	return maps, nil
+}
+
+// Returns the kind of the map picked by the map query parameter, the first
+// map's when it isn't set or the contest has no map of that kind.
+func selectedMapKind(r *http.Request, maps []resultsMap) (internal.BoundaryKind, error) {
+	if len(maps) == 0 {
+		return "", nil
+	}
+	if v := r.URL.Query().Get("map"); v != "" {
+		kind, err := internal.ParseBoundaryKind(v)
+		if err != nil {
+			return "", err
+		}
+		for _, m := range maps {
+			if m.Kind == kind {
+				return kind, nil
+			}
+		}
+	}
+	return maps[0].Kind, nil
+}
+
+type geometry struct {
+	Type        string
+	Coordinates json.RawMessage
+}
+
+// Returns a Polygon or MultiPolygon geometry's rings as polygons.
+func (g geometry) polygons() ([][][][]float64, error) {
+	switch g.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return nil, err
+		}
+		return [][][][]float64{polygon}, nil
+	case "MultiPolygon":
+		var polygons [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+		return polygons, nil
+	}
+	return nil, fmt.Errorf("unsupported geometry %s", g.Type)
+}
+
+// Projects a results map's features into SVG paths, fitting them to
+// mapWidth. Longitudes are scaled by the cosine of the map's middle latitude,
+// which is close enough at the scale of a county or state.
+func projectMap(collection internal.FeatureCollection, colors map[string]string) (resultsMap, error) {
+	shapes := make([][][][][]float64, len(collection.Features))
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i, feature := range collection.Features {
+		var g geometry
+		if err := json.Unmarshal(feature.Geometry, &g); err != nil {
+			return resultsMap{}, fmt.Errorf("error reading the geometry of %v: %v", feature.Properties["name"], err)
+		}
+		polygons, err := g.polygons()
+		if err != nil {
+			return resultsMap{}, fmt.Errorf("error reading the geometry of %v: %v", feature.Properties["name"], err)
+		}
+		shapes[i] = polygons
+		for _, polygon := range polygons {
+			for _, ring := range polygon {
+				for _, point := range ring {
+					if len(point) < 2 {
+						continue
+					}
+					minX, maxX = math.Min(minX, point[0]), math.Max(maxX, point[0])
+					minY, maxY = math.Min(minY, point[1]), math.Max(maxY, point[1])
+				}
+			}
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return resultsMap{}, fmt.Errorf("boundaries have no coordinates")
+	}
+
+	xScale := math.Cos((minY + maxY) / 2 * math.Pi / 180)
+	spanX, spanY := math.Max((maxX-minX)*xScale, 1e-9), math.Max(maxY-minY, 1e-9)
+	scale := mapWidth / spanX
+	m := resultsMap{Width: mapWidth, Height: math.Ceil(spanY * scale)}
+	project := func(point []float64) (float64, float64) {
+		x := (point[0] - minX) * xScale * scale
+		y := (maxY - point[1]) * scale
+		return math.Round(x*10) / 10, math.Round(y*10) / 10
+	}
+
+	for i, feature := range collection.Features {
+		var path strings.Builder
+		for _, polygon := range shapes[i] {
+			for _, ring := range polygon {
+				lastX, lastY := math.NaN(), math.NaN()
+				for _, point := range ring {
+					if len(point) < 2 {
+						continue
+					}
+					x, y := project(point)
+					if x == lastX && y == lastY {
+						continue
+					}
+					if math.IsNaN(lastX) {
+						path.WriteString("M")
+					} else {
+						path.WriteString("L")
+					}
+					fmt.Fprintf(&path, "%g %g", x, y)
+					lastX, lastY = x, y
+				}
+				path.WriteString("Z")
+			}
+		}
+
+		name := fmt.Sprint(feature.Properties["name"])
+		area := mapArea{Name: name, Path: path.String(), Fill: "#e5e7eb", Opacity: 1, Title: name + ": no results"}
+		leader, hasLeader := feature.Properties["leader"].(string)
+		margin, _ := feature.Properties["margin"].(float64)
+		total, _ := feature.Properties["total"].(int)
+		if hasLeader {
+			m.Reporting++
+			area.Fill = colors[leader]
+			if area.Fill == "" {
+				area.Fill = "#9ca3af"
+			}
+			area.Opacity = marginOpacity(margin)
+			area.Title = fmt.Sprintf("%s: %s +%.1f pts, %s votes", name, leader, margin, printFormattedNumber(total))
+		}
+		m.Areas = append(m.Areas, area)
+	}
+	return m, nil
+}
+
+// Adds the routes serving results maps as GeoJSON, each area with the
+// contest's results in its properties.
+func addMapRoutes(r *mux.Router, store internal.Store) {
+	r.HandleFunc("/{electionID}/contest/{contestKey}/map/{kind:[a-z]+}.geojson", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		kind, err := internal.ParseBoundaryKind(vars["kind"])
+		if err != nil {
+			http.Error(w, "Map not found", http.StatusNotFound)
+			return
+		}
+		contest, err := store.FindContest(vars["electionID"], vars["contestKey"])
+		if err != nil {
+			http.Error(w, "Contest not found", http.StatusNotFound)
+			return
+		}
+		candidates, err := store.ContestCandidates(contest.ID)
+		if err != nil {
+			http.Error(w, "Error fetching vote tallies", http.StatusInternalServerError)
+			return
+		}
+		collection, err := contestResultsMap(store, *contest, candidates, kind)
+		if err != nil {
+			http.Error(w, "Error fetching map", http.StatusInternalServerError)
+			return
+		}
+		if collection == nil {
+			http.Error(w, "Map not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/geo+json")
+		if err := json.NewEncoder(w).Encode(collection); err != nil {
+			http.Error(w, "Error writing response", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danielhep/go-elections/internal"
+)
+
+var testMaps = []resultsMap{
+	{Kind: internal.PrecinctBoundaries, Width: 600, Height: 400, Areas: []mapArea{{Name: "SEA 11-1234", Path: "M0 0L1 1Z", Fill: "#2563EB", Opacity: 1}}},
+	{Kind: internal.LegislativeBoundaries, Width: 600, Height: 400, Areas: []mapArea{{Name: "43", Path: "M0 0L2 2Z", Fill: "#DC2626", Opacity: 1}}},
+}
+
+func TestSelectedMapKind(t *testing.T) {
+	tests := []struct {
+		query   string
+		maps    []resultsMap
+		want    internal.BoundaryKind
+		wantErr bool
+	}{
+		{"", testMaps, internal.PrecinctBoundaries, false},
+		{"?map=legislative", testMaps, internal.LegislativeBoundaries, false},
+		{"?map=county", testMaps, internal.PrecinctBoundaries, false},
+		{"?map=state", testMaps, "", true},
+		{"?map=legislative", nil, "", false},
+	}
+	for _, test := range tests {
+		got, err := selectedMapKind(httptest.NewRequest(http.MethodGet, "/2024_general/contest/Mayor"+test.query, nil), test.maps)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("selectedMapKind(%q) = %q, %v; want %q, error %v", test.query, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestResultsMapsWithoutScripts(t *testing.T) {
+	contest := internal.Contest{BallotTitle: "Mayor", ContestKey: "Mayor-City_of_Seattle", ElectionID: "2024_general"}
+	candidates := []internal.BallotResponse{{Name: "Alice"}, {Name: "Bob"}}
+	var html strings.Builder
+	if err := resultsMaps(contest, candidates, testMaps, internal.LegislativeBoundaries).Render(context.Background(), &html); err != nil {
+		t.Fatal(err)
+	}
+	page := html.String()
+	for _, want := range []string{`href="?map=precinct#results-map"`, `d="M0 0L2 2Z"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("map is missing %s", want)
+		}
+	}
+	for _, unwanted := range []string{`d="M0 0L1 1Z"`, "x-data", "x-show", "@click"} {
+		if strings.Contains(page, unwanted) {
+			t.Errorf("map contains %s", unwanted)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+/** @type {import('tailwindcss').Config} */
+module.exports = {
+  // Classes are only picked up where they're written out in full
+  content: ["./*.templ", "./*.go"],
+};
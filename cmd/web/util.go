@@ -1,34 +1,175 @@
 package main
 
 import (
-	"sort"
-	"time"
+	"net/http"
+	"net/url"
+	"slices"
+	"unicode"
 
 	"github.com/danielhep/go-elections/internal"
 )
 
-func sortCandidatesByLatestVotes(candidates []internal.BallotResponse) {
-	sort.Slice(candidates, func(i, j int) bool {
-		latestVotesI := getLatestVotes(candidates[i])
-		latestVotesJ := getLatestVotes(candidates[j])
-		return latestVotesI > latestVotesJ
+// Colors of the candidates in charts and maps, in rank order.
+var candidateColors = []string{"#FF6384", "#36A2EB", "#FFCE56", "#4BC0C0", "#9966FF", "#FF9F40"}
+
+func candidateColor(rank int) string {
+	return candidateColors[rank%len(candidateColors)]
+}
+
+// Color of the write-in line in races colored by party.
+const unaffiliatedColor = "#9CA3AF"
+
+// Returns the colors of candidates in rank order: their parties' colors when
+// each has a party of a different color, so a partisan race reads blue
+// against red, and colors by rank otherwise. One candidate without a party,
+// usually the write-ins, is grey.
+func candidateColorsFor(candidates []internal.BallotResponse) []string {
+	colors := make([]string, len(candidates))
+	seen := make(map[string]bool)
+	unaffiliated := 0
+	for i, candidate := range candidates {
+		party := candidate.CanonicalParty
+		if party == nil {
+			unaffiliated++
+			colors[i] = unaffiliatedColor
+			continue
+		}
+		if party.Color == "" || seen[party.Color] {
+			unaffiliated = len(candidates)
+			break
+		}
+		seen[party.Color] = true
+		colors[i] = party.Color
+	}
+	if unaffiliated > 1 || len(seen) == 0 {
+		for i := range candidates {
+			colors[i] = candidateColor(i)
+		}
+	}
+	return colors
+}
+
+// Orders candidates by their rank in the contest's current results. Candidates
+// without results are placed last.
+func sortCandidatesByRank(candidates []internal.BallotResponse, results []internal.ContestResult) {
+	ranks := make(map[uint]int)
+	for _, result := range results {
+		ranks[result.BallotResponseID] = result.Rank
+	}
+	rank := func(candidate internal.BallotResponse) int {
+		if r, ok := ranks[candidate.ID]; ok {
+			return r
+		}
+		return len(results) + 1
+	}
+	slices.SortStableFunc(candidates, func(a, b internal.BallotResponse) int {
+		return rank(a) - rank(b)
+	})
+}
+
+// Returns the visible updates from the jurisdictions the contest's tallies
+// come from, newest first, starting at the first one with tallies for it.
+// Updates in which the contest didn't change are included, since only changes
+// are stored.
+func contestUpdates(updates []internal.Update, candidates []internal.BallotResponse) []internal.Update {
+	first := make(map[internal.JurisdictionType]internal.Update)
+	for _, candidate := range candidates {
+		for _, tally := range candidate.VoteTallies {
+			earliest, ok := first[tally.Update.JurisdictionType]
+			if !ok || updateBefore(tally.Update, earliest) {
+				first[tally.Update.JurisdictionType] = tally.Update
+			}
+		}
+	}
+	var ret []internal.Update
+	for _, update := range updates {
+		earliest, ok := first[update.JurisdictionType]
+		if update.RetractedAt != nil || !ok || updateBefore(update, earliest) {
+			continue
+		}
+		ret = append(ret, update)
+	}
+	slices.SortFunc(ret, func(a, b internal.Update) int {
+		if updateBefore(a, b) {
+			return 1
+		}
+		return -1
 	})
+	return ret
 }
 
-func getLatestVotes(candidate internal.BallotResponse) int {
-	if len(candidate.VoteTallies) == 0 {
-		return 0
+// Whether a was published before b, ties broken by ID.
+func updateBefore(a internal.Update, b internal.Update) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
 	}
+	return a.ID < b.ID
+}
+
+type textSegment struct {
+	Text  string
+	Match bool
+}
 
-	latestUpdate := time.Time{}
-	latestVotes := 0
+// Splits text into segments, marking the ones that match a search term.
+// Matching ignores case.
+func highlight(text string, terms []string) []textSegment {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	matched := make([]bool, len(runes))
+	for _, term := range terms {
+		termRunes := []rune(term)
+		for i := 0; i+len(termRunes) <= len(lower); i++ {
+			if slices.Equal(lower[i:i+len(termRunes)], termRunes) {
+				for j := range termRunes {
+					matched[i+j] = true
+				}
+			}
+		}
+	}
 
-	for _, tally := range candidate.VoteTallies {
-		if tally.Update.Timestamp.After(latestUpdate) {
-			latestUpdate = tally.Update.Timestamp
-			latestVotes = tally.Votes
+	var segments []textSegment
+	for i, r := range runes {
+		if len(segments) == 0 || segments[len(segments)-1].Match != matched[i] {
+			segments = append(segments, textSegment{Match: matched[i]})
 		}
+		segments[len(segments)-1].Text += string(r)
 	}
+	return segments
+}
 
-	return latestVotes
+// Reads the category and level query parameters contests are filtered by.
+func contestFilterParams(r *http.Request) (internal.ContestFilter, error) {
+	var filter internal.ContestFilter
+	var err error
+	if category := r.URL.Query().Get("category"); category != "" {
+		if filter.Category, err = internal.ParseContestCategory(category); err != nil {
+			return filter, err
+		}
+	}
+	if level := r.URL.Query().Get("level"); level != "" {
+		if filter.Level, err = internal.ParseContestLevel(level); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// Returns the query string selecting a filter's contests, or "" for all of
+// them.
+func contestFilterQuery(filter internal.ContestFilter) string {
+	values := url.Values{}
+	if filter.Category != "" {
+		values.Set("category", string(filter.Category))
+	}
+	if filter.Level != "" {
+		values.Set("level", string(filter.Level))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
 }
@@ -0,0 +1,18 @@
+#!/bin/sh
+# Fetches the front end libraries into images/vendor, which is embedded and
+# served under /static/, and builds the Tailwind stylesheet from the classes
+# the templates use. Run with `go generate ./cmd/web` after changing a version
+# or a template's classes, and commit the results.
+set -eu
+cd "$(dirname "$0")"
+
+HTMX_VERSION=2.0.2
+ALPINE_VERSION=3.14.1
+CHARTJS_VERSION=4.4.4
+
+out=images/vendor
+mkdir -p "$out"
+curl -fsSL -o "$out/htmx.min.js" "https://cdn.jsdelivr.net/npm/htmx.org@$HTMX_VERSION/dist/htmx.min.js"
+curl -fsSL -o "$out/alpine.min.js" "https://cdn.jsdelivr.net/npm/alpinejs@$ALPINE_VERSION/dist/cdn.min.js"
+curl -fsSL -o "$out/chart.umd.min.js" "https://cdn.jsdelivr.net/npm/chart.js@$CHARTJS_VERSION/dist/chart.umd.min.js"
+tailwindcss --config tailwind.config.js --input tailwind.css --output "$out/tailwind.css" --minify
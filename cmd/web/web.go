@@ -6,12 +6,15 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"sort"
+	"slices"
 
 	"github.com/danielhep/go-elections/internal"
 	"github.com/gorilla/mux"
 )
 
+// Images and the front end libraries in images/vendor, served under /static/
+//
+//go:generate sh vendor.sh
 //go:embed images
 var staticFiles embed.FS
 
@@ -27,12 +30,89 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	recountRules, err := internal.RecountRulesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid RECOUNT_RULES: %v", err)
+	}
+
 	r := mux.NewRouter()
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		addAdminRoutes(r, db, password)
+	} else {
+		log.Println("ADMIN_PASSWORD is not set, admin pages are disabled")
+	}
+
+	staticFS, err := fs.Sub(staticFiles, "images")
+	if err != nil {
+		log.Fatal(err)
+	}
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
+	addRoutes(r, db, recountRules)
+
+	// Start the server
+	log.Println("Starting server on :8080")
+	log.Fatal(http.ListenAndServe(":8080", r))
+}
+
+// Adds the page routes on top of a Store, after any admin and static routes.
+// Contests are flagged when their margin falls under one of recountRules.
+func addRoutes(r *mux.Router, store internal.Store, recountRules []internal.RecountRule) {
+	// Fixed routes come before the /{electionID} ones so that they win, their
+	// first path segments are reserved election slugs
+	addAPIRoutes(r, store)
+	r.Handle("/graphql", graphqlHandler(store)).Methods("GET", "POST")
+
+	// Candidate profile route
+	r.HandleFunc("/candidate/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		candidate, err := store.FindCandidate(mux.Vars(r)["slug"])
+		if err != nil {
+			http.Error(w, "Candidate not found", http.StatusNotFound)
+			return
+		}
+		runs, err := candidateRuns(store, *candidate)
+		if err != nil {
+			http.Error(w, "Error fetching results", http.StatusInternalServerError)
+			return
+		}
+		err = candidatePage(*candidate, runs).Render(r.Context(), w)
+		if err != nil {
+			http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+
+	// Search, as a page or as the htmx partial behind the search box
+	r.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		results, err := store.Search(query)
+		if err != nil {
+			http.Error(w, "Error searching", http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("HX-Request") == "true" {
+			err = searchResults(query, results).Render(r.Context(), w)
+		} else {
+			err = searchPage(query, results).Render(r.Context(), w)
+		}
+		if err != nil {
+			http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("OK"))
+		if err != nil {
+			http.Error(w, "Error writing response", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
+
+	addExportRoutes(r, store)
+	addMapRoutes(r, store)
 
 	// Root page route
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		var elections []internal.Election
-		if err := db.Order("election_date DESC").Find(&elections).Error; err != nil {
+		elections, err := store.ListElections(false)
+		if err != nil {
 			http.Error(w, "Error fetching elections", http.StatusInternalServerError)
 			return
 		}
@@ -46,17 +126,51 @@ func main() {
 	r.HandleFunc("/{electionID}/", func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		electionID := vars["electionID"]
-		var contests []internal.Contest
-		if err := db.Where("election_id = ?", electionID).Preload("Election").Find(&contests).Error; err != nil {
+		election, err := store.FindElection(electionID)
+		if err != nil {
+			http.Error(w, "Election not found", http.StatusNotFound)
+			return
+		}
+		filter, err := contestFilterParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		contests, err := store.ListContests(electionID)
+		if err != nil {
 			http.Error(w, "Error fetching contests", http.StatusInternalServerError)
 			return
 		}
-		var election internal.Election
-		if err := db.Where("id = ?", electionID).First(&election).Error; err != nil {
-			http.Error(w, "Election not found", http.StatusNotFound)
+		filters := contestFilters{
+			Selected:   filter,
+			Categories: make(map[internal.ContestCategory]int),
+			Levels:     make(map[internal.ContestLevel]int),
+		}
+		for _, contest := range contests {
+			filters.Categories[contest.Category]++
+			filters.Levels[contest.Level]++
+		}
+		contests = slices.DeleteFunc(contests, func(contest internal.Contest) bool { return !filter.Matches(contest) })
+		results, err := store.ElectionResults(electionID)
+		if err != nil {
+			http.Error(w, "Error fetching results", http.StatusInternalServerError)
+			return
+		}
+		recounts := make(map[uint]internal.ContestMargin)
+		for _, race := range internal.CloseRaces(results, recountRules, election.TopTwo) {
+			recounts[race.Contest.ID] = race
+		}
+		var topTwo map[uint]internal.TopTwo
+		if election.TopTwo {
+			topTwo = internal.ElectionTopTwo(results)
+		}
+		districts, err := store.ListDistricts()
+		if err != nil {
+			http.Error(w, "Error fetching districts", http.StatusInternalServerError)
 			return
 		}
-		err = electionPage(election, contests).Render(r.Context(), w)
+		sections := internal.GroupContestsByDistrict(contests, districts)
+		err = electionPage(*election, sections, filters, recounts, topTwo).Render(r.Context(), w)
 		if err != nil {
 			http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		}
@@ -68,61 +182,115 @@ func main() {
 		contestKey := vars["contestKey"]
 		electionID := vars["electionID"]
 
-		contest := internal.Contest{
-			ElectionID: electionID,
-			ContestKey: contestKey,
-		}
-		if err := db.Preload("Election").First(&contest, contest).Error; err != nil {
+		contest, err := store.FindContest(electionID, contestKey)
+		if err != nil {
 			http.Error(w, "Contest not found", http.StatusNotFound)
 			return
 		}
 
-		var candidates []internal.BallotResponse
-		if err := db.Where("contest_id = ?", contest.ID).
-			Preload("VoteTallies").
-			Preload("VoteTallies.Update").
-			Find(&candidates).Error; err != nil {
+		candidates, err := store.ContestCandidates(contest.ID)
+		if err != nil {
 			http.Error(w, "Error fetching vote tallies", http.StatusInternalServerError)
 			return
 		}
-		// Sort candidates by their latest vote count
-		sortCandidatesByLatestVotes(candidates)
+		// Sort candidates by their current rank
+		results, err := store.CurrentResults(contest.ID)
+		if err != nil {
+			http.Error(w, "Error fetching results", http.StatusInternalServerError)
+			return
+		}
+		sortCandidatesByRank(candidates, results)
+		recount := internal.CheckRecount(results, recountRules, contest.Election.TopTwo)
+		if recount != nil {
+			recount.Contest = *contest
+		}
+		var topTwo *internal.TopTwo
+		settled := false
+		if contest.Election.TopTwo {
+			topTwo = internal.CheckTopTwo(results)
+			outstanding, ok := internal.OutstandingBallots(candidates, contest.Election.ExpectedTurnout)
+			settled = topTwo != nil && (contest.Election.CertifiedAt != nil || ok && topTwo.Settled(outstanding))
+		}
 
-		// Get the countyUpdates sorted
-		var countyUpdates []internal.Update
-		var stateUpdate *internal.Update
-		for _, voteTally := range candidates[0].VoteTallies {
-			if voteTally.Update.JurisdictionType == internal.StateJurisdiction {
-				stateUpdate = &voteTally.Update
-			} else {
-				countyUpdates = append(countyUpdates, voteTally.Update)
-			}
+		electionUpdates, err := store.ListUpdates(contest.ElectionID)
+		if err != nil {
+			http.Error(w, "Error fetching updates", http.StatusInternalServerError)
+			return
 		}
-		sort.Slice(countyUpdates, func(a, b int) bool {
-			return countyUpdates[b].Timestamp.Before(countyUpdates[a].Timestamp)
-		})
+		updates := contestUpdates(electionUpdates, candidates)
 
-		err = contestPage(contest, candidates, countyUpdates, stateUpdate).Render(r.Context(), w)
+		countyTallies, err := store.CountyTallies(contest.ID)
+		if err != nil {
+			http.Error(w, "Error fetching county results", http.StatusInternalServerError)
+			return
+		}
+		counties, countyTotal := internal.GroupCountyTallies(countyTallies)
+		precinctTallies, err := store.PrecinctTallies(contest.ID)
+		if err != nil {
+			http.Error(w, "Error fetching precinct results", http.StatusInternalServerError)
+			return
+		}
+		precincts := internal.GroupPrecinctTallies(precinctTallies)
+		maps, err := contestMaps(store, *contest, candidates)
+		if err != nil {
+			http.Error(w, "Error fetching results maps", http.StatusInternalServerError)
+			return
+		}
+		mapKind, err := selectedMapKind(r, maps)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		drops := internal.BallotDrops(candidates)
+		slices.Reverse(drops)
+		outlook := internal.LateBallotNeeds(candidates, contest.Election.ExpectedTurnout)
+		projection := internal.ProjectContest(candidates, contest.Election)
+
+		err = contestPage(*contest, candidates, updates, counties, countyTotal, precincts, maps, mapKind, drops, outlook, projection, recount, topTwo, settled).Render(r.Context(), w)
 		if err != nil {
 			http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		}
 	}).Methods("GET")
 
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, err := w.Write([]byte("OK"))
+	// Contests within a recount margin, closest first
+	r.HandleFunc("/{electionID}/close-races", func(w http.ResponseWriter, r *http.Request) {
+		election, err := store.FindElection(mux.Vars(r)["electionID"])
 		if err != nil {
-			http.Error(w, "Error writing response", http.StatusInternalServerError)
+			http.Error(w, "Election not found", http.StatusNotFound)
+			return
+		}
+		results, err := store.ElectionResults(election.ID)
+		if err != nil {
+			http.Error(w, "Error fetching results", http.StatusInternalServerError)
+			return
+		}
+		err = closeRacesPage(*election, internal.CloseRaces(results, recountRules, election.TopTwo), recountRules).Render(r.Context(), w)
+		if err != nil {
+			http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		}
 	}).Methods("GET")
 
-	staticFS, err := fs.Sub(staticFiles, "images")
-	if err != nil {
-		log.Fatal(err)
-	}
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
-
-	// Start the server
-	log.Println("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	r.HandleFunc("/{electionID}/parties", func(w http.ResponseWriter, r *http.Request) {
+		election, err := store.FindElection(mux.Vars(r)["electionID"])
+		if err != nil {
+			http.Error(w, "Election not found", http.StatusNotFound)
+			return
+		}
+		results, err := store.ElectionResults(election.ID)
+		if err != nil {
+			http.Error(w, "Error fetching results", http.StatusInternalServerError)
+			return
+		}
+		districts, err := store.ListDistricts()
+		if err != nil {
+			http.Error(w, "Error fetching districts", http.StatusInternalServerError)
+			return
+		}
+		overall, byType := internal.TallyPartyVotes(results, districts)
+		err = partiesPage(*election, overall, byType).Render(r.Context(), w)
+		if err != nil {
+			http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		}
+	}).Methods("GET")
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielhep/go-elections/internal"
+	"github.com/gorilla/mux"
+)
+
+func TestFixedRoutesBeforeElectionRoutes(t *testing.T) {
+	store := internal.NewMemoryStore()
+	date := time.Date(2024, time.November, 5, 0, 0, 0, 0, time.UTC)
+	election := internal.Election{ID: "2024_general", Name: "2024 General", ElectionDate: date, Type: internal.GeneralElection}
+	if err := store.CreateElection(&election); err != nil {
+		t.Fatal(err)
+	}
+	// A candidate whose slug matches the last segment of /{electionID}/parties
+	records := []internal.GenericVoteRecord{{
+		DistrictName:     "City of Seattle",
+		BallotTitle:      "Mayor",
+		BallotResponse:   "Parties",
+		Votes:            150,
+		JurisdictionType: internal.CountyJurisdiction,
+	}}
+	if err := store.LoadUpdate(records, "county", date.Add(time.Hour), election); err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	addRoutes(r, store, nil)
+
+	for _, path := range []string{"/candidate/parties", "/2024_general/parties", "/search?q=mayor"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestContestPageListsUnchangedUpdates(t *testing.T) {
+	store := internal.NewMemoryStore()
+	date := time.Date(2024, time.November, 5, 0, 0, 0, 0, time.UTC)
+	election := internal.Election{ID: "2024_general", Name: "2024 General", ElectionDate: date, Type: internal.GeneralElection}
+	if err := store.CreateElection(&election); err != nil {
+		t.Fatal(err)
+	}
+	record := func(title string, candidate string, votes int) internal.GenericVoteRecord {
+		return internal.GenericVoteRecord{DistrictName: "King County", BallotTitle: title, BallotResponse: candidate, Votes: votes, JurisdictionType: internal.CountyJurisdiction}
+	}
+	// The council race doesn't change in the second update, so it has no tallies
+	// from it
+	for i, records := range [][]internal.GenericVoteRecord{
+		{record("Mayor", "Alice", 100), record("Council", "Bob", 4321)},
+		{record("Mayor", "Alice", 120), record("Council", "Bob", 4321)},
+	} {
+		if err := store.LoadUpdate(records, fmt.Sprint(i), date.Add(time.Duration(i+1)*time.Hour), election); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := mux.NewRouter()
+	addRoutes(r, store, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/2024_general/contest/Council-King_County", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET = %d %s", w.Code, w.Body.String())
+	}
+	page := w.Body.String()
+	if rows := strings.Count(page, "This row is from King County data."); rows != 2 {
+		t.Errorf("%d update rows, want 2", rows)
+	}
+	if votes := strings.Count(page, "4,321"); votes < 2 {
+		t.Errorf("votes carried into the unchanged update %d times, want 2", votes)
+	}
+}
+
+func TestContestPageWithoutCandidates(t *testing.T) {
+	contest := internal.Contest{BallotTitle: "Mayor", ContestKey: "Mayor-King_County", ElectionID: "2024_general"}
+	var html strings.Builder
+	err := contestPage(contest, nil, nil, nil, internal.CountyResult{}, nil, nil, "", nil, nil, nil, nil, nil, false).Render(context.Background(), &html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), "No results have been loaded for this contest yet.") {
+		t.Error("contest page without candidates has no empty state")
+	}
+}
+
+func TestLayoutUsesVendoredAssets(t *testing.T) {
+	var b strings.Builder
+	if err := layout("Test").Render(context.Background(), &b); err != nil {
+		t.Fatal(err)
+	}
+	page := b.String()
+	for _, external := range []string{`src="http`, `href="http`} {
+		if strings.Contains(page, external) {
+			t.Errorf("layout loads an asset from another site: %s", page)
+		}
+	}
+	for _, asset := range []string{"tailwind.css", "alpine.min.js", "chart.umd.min.js", "htmx.min.js"} {
+		if !strings.Contains(page, "/static/vendor/"+asset) {
+			t.Errorf("layout doesn't load /static/vendor/%s", asset)
+		}
+	}
+}
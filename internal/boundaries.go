@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+type BoundaryKind string
+
+const (
+	PrecinctBoundaries    BoundaryKind = "precinct"
+	LegislativeBoundaries BoundaryKind = "legislative"
+	CountyBoundaries      BoundaryKind = "county"
+)
+
+var BoundaryKinds = []BoundaryKind{PrecinctBoundaries, LegislativeBoundaries, CountyBoundaries}
+
+func ParseBoundaryKind(s string) (BoundaryKind, error) {
+	if kind := BoundaryKind(s); slices.Contains(BoundaryKinds, kind) {
+		return kind, nil
+	}
+	return "", fmt.Errorf("unknown boundary kind %q (expected precinct, legislative or county)", s)
+}
+
+// Boundary is the shape of one area an election's results can be mapped by.
+// Name is matched against the precinct, legislative district or county of
+// the results.
+type Boundary struct {
+	gorm.Model
+	ElectionID string       `gorm:"uniqueIndex:idx_boundary_election_kind_name"`
+	Kind       BoundaryKind `gorm:"uniqueIndex:idx_boundary_election_kind_name"`
+	Name       string       `gorm:"uniqueIndex:idx_boundary_election_kind_name"`
+	// GeoJSON Polygon or MultiPolygon geometry
+	Geometry string
+}
+
+// Feature and FeatureCollection are the parts of GeoJSON read from boundary
+// files and written by ResultsMap.
+type Feature struct {
+	Type       string          `json:"type"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Reads the areas of a GeoJSON FeatureCollection, naming each by its
+// nameProperty. Features that aren't polygons are rejected.
+func ParseBoundaries(r io.Reader, kind BoundaryKind, nameProperty string) ([]Boundary, error) {
+	var collection FeatureCollection
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("error reading GeoJSON: %v", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a GeoJSON FeatureCollection, got %q", collection.Type)
+	}
+	var boundaries []Boundary
+	seen := make(map[string]bool)
+	for i, feature := range collection.Features {
+		value, ok := feature.Properties[nameProperty]
+		if !ok || value == nil {
+			return nil, fmt.Errorf("feature %d has no %s property", i, nameProperty)
+		}
+		name := strings.TrimSpace(fmt.Sprint(value))
+		var geometry struct{ Type string }
+		if err := json.Unmarshal(feature.Geometry, &geometry); err != nil {
+			return nil, fmt.Errorf("feature %s has invalid geometry: %v", name, err)
+		}
+		if geometry.Type != "Polygon" && geometry.Type != "MultiPolygon" {
+			return nil, fmt.Errorf("feature %s is a %s, expected a Polygon or MultiPolygon", name, geometry.Type)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("more than one feature is named %s", name)
+		}
+		seen[name] = true
+		boundaries = append(boundaries, Boundary{Kind: kind, Name: name, Geometry: string(feature.Geometry)})
+	}
+	if len(boundaries) == 0 {
+		return nil, fmt.Errorf("no features to load")
+	}
+	return boundaries, nil
+}
+
+// Replaces an election's boundaries of one kind.
+func (db *DB) LoadBoundaries(electionID string, kind BoundaryKind, boundaries []Boundary) error {
+	for i := range boundaries {
+		boundaries[i].ElectionID, boundaries[i].Kind = electionID, kind
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("election_id = ? AND kind = ?", electionID, kind).Delete(&Boundary{}).Error; err != nil {
+			return fmt.Errorf("error clearing %s boundaries for %s: %v", kind, electionID, err)
+		}
+		if err := tx.CreateInBatches(boundaries, 100).Error; err != nil {
+			return fmt.Errorf("error loading %s boundaries for %s: %v", kind, electionID, err)
+		}
+		return nil
+	})
+}
+
+// Returns an election's boundaries of one kind, ordered by name.
+func (db *DB) Boundaries(electionID string, kind BoundaryKind) ([]Boundary, error) {
+	var boundaries []Boundary
+	if err := db.Where("election_id = ? AND kind = ?", electionID, kind).Order("name").Find(&boundaries).Error; err != nil {
+		return nil, fmt.Errorf("error fetching %s boundaries for %s: %v", kind, electionID, err)
+	}
+	return boundaries, nil
+}
+
+// Returns how many boundaries of each kind an election has.
+func (db *DB) BoundaryCounts(electionID string) (map[BoundaryKind]int, error) {
+	var rows []struct {
+		Kind  BoundaryKind
+		Count int
+	}
+	if err := db.Model(&Boundary{}).Select("kind, count(*) AS count").Where("election_id = ?", electionID).Group("kind").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error counting boundaries for %s: %v", electionID, err)
+	}
+	counts := make(map[BoundaryKind]int)
+	for _, row := range rows {
+		counts[row.Kind] = row.Count
+	}
+	return counts, nil
+}
+
+func (db *DB) DeleteBoundaries(electionID string, kind BoundaryKind) error {
+	if err := db.Unscoped().Where("election_id = ? AND kind = ?", electionID, kind).Delete(&Boundary{}).Error; err != nil {
+		return fmt.Errorf("error deleting %s boundaries for %s: %v", kind, electionID, err)
+	}
+	return nil
+}
+
+// AreaResult is a contest's votes in one area of a map.
+type AreaResult struct {
+	Name string
+	// Votes of each candidate, keyed by ballot response ID
+	Votes map[uint]int
+	Total int
+}
+
+// Returns the candidate with the most votes in the area and their lead over
+// the next candidate in percentage points. ok is false without votes.
+func (a AreaResult) Leader() (leaderID uint, margin float64, ok bool) {
+	if a.Total <= 0 {
+		return 0, 0, false
+	}
+	ids := make([]uint, 0, len(a.Votes))
+	for id := range a.Votes {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(x, y uint) int { return cmp.Or(a.Votes[y]-a.Votes[x], cmp.Compare(x, y)) })
+	second := 0
+	if len(ids) > 1 {
+		second = a.Votes[ids[1]]
+	}
+	return ids[0], float64(a.Votes[ids[0]]-second) * 100 / float64(a.Total), true
+}
+
+// Returns the key results and boundaries of an area are matched by: county
+// names without "County", district numbers without leading zeros or labels,
+// and precinct names in lowercase.
+func areaKey(kind BoundaryKind, name string) string {
+	switch kind {
+	case CountyBoundaries:
+		if county := countyName(name); county != "" {
+			return strings.ToLower(county)
+		}
+	case LegislativeBoundaries:
+		digits := strings.TrimLeft(strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, name), "0")
+		if digits != "" {
+			return digits
+		}
+	}
+	return matchKey(name)
+}
+
+// Returns a contest's results in each area of a kind, keyed by areaKey.
+// Precincts and counties come from the latest precinct and per-county
+// results, and legislative districts add up the precincts in them.
+func AreaResults(store Store, contestID uint, kind BoundaryKind) (map[string]AreaResult, error) {
+	areas := make(map[string]AreaResult)
+	add := func(name string, ballotResponseID uint, votes int) {
+		key := areaKey(kind, name)
+		area, ok := areas[key]
+		if !ok {
+			area = AreaResult{Name: name, Votes: make(map[uint]int)}
+		}
+		area.Votes[ballotResponseID] += votes
+		area.Total += votes
+		areas[key] = area
+	}
+	switch kind {
+	case CountyBoundaries:
+		tallies, err := store.CountyTallies(contestID)
+		if err != nil {
+			return nil, err
+		}
+		for _, tally := range tallies {
+			add(tally.County, tally.BallotResponseID, tally.Votes)
+		}
+	case PrecinctBoundaries, LegislativeBoundaries:
+		tallies, err := store.PrecinctTallies(contestID)
+		if err != nil {
+			return nil, err
+		}
+		for _, tally := range tallies {
+			name := tally.Precinct.Name
+			if kind == LegislativeBoundaries {
+				if tally.Precinct.LegislativeDistrict == "" {
+					continue
+				}
+				name = tally.Precinct.LegislativeDistrict
+			}
+			add(name, tally.BallotResponseID, tally.Votes)
+		}
+	default:
+		return nil, fmt.Errorf("unknown boundary kind %q", kind)
+	}
+	return areas, nil
+}
+
+// Joins boundaries with a contest's results in each area into a GeoJSON
+// FeatureCollection. Each feature's properties hold the area's name, the
+// votes of each candidate by name, the total, and the leader with their
+// margin in percentage points, which are null for areas without results.
+func ResultsMap(boundaries []Boundary, kind BoundaryKind, areas map[string]AreaResult, candidates []BallotResponse) FeatureCollection {
+	names := make(map[uint]string)
+	for _, candidate := range candidates {
+		names[candidate.ID] = candidate.Name
+	}
+	collection := FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+	for _, boundary := range boundaries {
+		properties := map[string]any{"name": boundary.Name, "total": 0, "leader": nil, "margin": nil}
+		if area, ok := areas[areaKey(kind, boundary.Name)]; ok {
+			votes := make(map[string]int)
+			for id, n := range area.Votes {
+				votes[names[id]] = n
+			}
+			properties["votes"] = votes
+			properties["total"] = area.Total
+			if leaderID, margin, ok := area.Leader(); ok {
+				properties["leader"] = names[leaderID]
+				properties["margin"] = margin
+			}
+		}
+		collection.Features = append(collection.Features, Feature{
+			Type:       "Feature",
+			Geometry:   json.RawMessage(boundary.Geometry),
+			Properties: properties,
+		})
+	}
+	return collection
+}
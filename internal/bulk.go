@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// Columns of the temporary table the parsed records are copied into.
+var stagingColumns = []string{"contest_key", "ballot_title", "district", "ballot_response", "party", "votes", "vote_percentage", "ballots_counted", "registered_voters", "county"}
+
+// Loads the contests, candidates and vote tallies for a new update, links its
+// candidates and parties, classifies its contests and stores its districts,
+// all in a single transaction. Records are staged with COPY into a temporary
+// table and then merged into the real tables with set-based SQL, which is
+// much faster than LoadBallotResponses followed by UpdateVoteTallies on large
+// files.
+func (db *DB) BulkLoadUpdate(data []GenericVoteRecord, hash string, timestamp time.Time, election Election) error {
+	if len(data) == 0 {
+		return fmt.Errorf("no data to process")
+	}
+	jType := data[0].JurisdictionType
+	rows := make([][]any, len(data))
+	for i, record := range data {
+		if record.JurisdictionType != jType {
+			return fmt.Errorf("error, found inconsistent jurisdiction types while updating vote tallies")
+		}
+		rows[i] = []any{
+			getContestKey(record.BallotTitle, record.DistrictName),
+			record.BallotTitle,
+			record.DistrictName,
+			record.BallotResponse,
+			record.PartyPreference,
+			record.Votes,
+			record.VotePercentage,
+			record.BallotsCounted,
+			record.RegisteredVoters,
+			record.County,
+		}
+	}
+
+	totals, _ := splitCountyRecords(data)
+	ctx := context.Background()
+	return db.Connection(func(conn *gorm.DB) error {
+		sqlConn, ok := conn.Statement.ConnPool.(*sql.Conn)
+		if !ok {
+			return fmt.Errorf("bulk loading requires a dedicated connection")
+		}
+		return conn.Transaction(func(tx *gorm.DB) error {
+			// Only store the tallies of contests that changed since the
+			// previous update, as of this transaction. County records are
+			// stored whole.
+			changed, err := newUpdateRecords(tx, totals, jType, timestamp, election)
+			if err != nil {
+				return err
+			}
+			changedKeys := slices.Collect(maps.Keys(votesFromRecords(changed)))
+			// COPY needs the pgx connection under the transaction, which runs
+			// its statements in that same transaction
+			err = sqlConn.Raw(func(driverConn any) error {
+				stdlibConn, ok := driverConn.(*stdlib.Conn)
+				if !ok {
+					return fmt.Errorf("bulk loading requires a PostgreSQL connection")
+				}
+				return bulkLoad(ctx, stdlibConn.Conn(), rows, changedKeys, hash, timestamp, jType, election)
+			})
+			if err != nil {
+				return err
+			}
+			// New ballot responses are linked to candidates and parties, and new
+			// contests classified, like in LoadBallotResponses
+			if err := linkCandidates(tx, election.ID); err != nil {
+				return err
+			}
+			if err := linkParties(tx, election.ID); err != nil {
+				return err
+			}
+			if _, err := classifyContests(tx, election.ID, false); err != nil {
+				return err
+			}
+			return storeDistricts(tx, data)
+		})
+	})
+}
+
+func bulkLoad(ctx context.Context, conn *pgx.Conn, rows [][]any, changedKeys []string, hash string, timestamp time.Time, jType JurisdictionType, election Election) error {
+	if _, err := conn.Exec(ctx, `
+		CREATE TEMP TABLE staged_records (
+			contest_key text NOT NULL,
+			ballot_title text NOT NULL,
+			district text NOT NULL,
+			ballot_response text NOT NULL,
+			party text NOT NULL,
+			votes bigint NOT NULL,
+			vote_percentage real NOT NULL,
+			ballots_counted bigint NOT NULL,
+			registered_voters bigint NOT NULL,
+			county text NOT NULL
+		) ON COMMIT DROP`); err != nil {
+		return fmt.Errorf("error creating staging table: %v", err)
+	}
+	copied, err := conn.CopyFrom(ctx, pgx.Identifier{"staged_records"}, stagingColumns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return fmt.Errorf("error copying records: %v", err)
+	}
+	log.Printf("Staged %v %s records", copied, jType)
+
+	now := time.Now()
+	contests, err := conn.Exec(ctx, `
+		INSERT INTO contests (created_at, updated_at, ballot_title, district, contest_key, election_id)
+		SELECT DISTINCT ON (contest_key) $1::timestamptz, $1::timestamptz, ballot_title, district, contest_key, $2
+		FROM staged_records
+		ORDER BY contest_key
+		ON CONFLICT (election_id, contest_key) DO UPDATE
+		SET ballot_title = EXCLUDED.ballot_title, district = EXCLUDED.district, updated_at = EXCLUDED.updated_at, deleted_at = NULL`,
+		now, election.ID)
+	if err != nil {
+		return fmt.Errorf("error merging contests: %v", err)
+	}
+
+	candidates, err := conn.Exec(ctx, `
+		INSERT INTO ballot_responses (created_at, updated_at, name, party, contest_id, election_id)
+		SELECT DISTINCT ON (c.id, s.ballot_response) $1::timestamptz, $1::timestamptz, s.ballot_response, s.party, c.id, $2
+		FROM staged_records s
+		JOIN contests c ON c.election_id = $2 AND c.contest_key = s.contest_key
+		ORDER BY c.id, s.ballot_response
+		ON CONFLICT (contest_id, name) DO UPDATE
+		SET party = EXCLUDED.party, updated_at = EXCLUDED.updated_at, deleted_at = NULL`,
+		now, election.ID)
+	if err != nil {
+		return fmt.Errorf("error merging candidates: %v", err)
+	}
+
+	if _, err := conn.Exec(ctx, `
+		UPDATE contests
+		SET jurisdictions = array_append(coalesce(jurisdictions, '{}'), $2::text)
+		WHERE election_id = $1
+		AND contest_key IN (SELECT contest_key FROM staged_records WHERE county = '')
+		AND NOT $2::text = ANY(coalesce(jurisdictions, '{}'))`,
+		election.ID, string(jType)); err != nil {
+		return fmt.Errorf("error updating jurisdictions: %v", err)
+	}
+
+	var updateID uint
+	if err := conn.QueryRow(ctx, `
+		INSERT INTO updates (created_at, updated_at, timestamp, hash, jurisdiction_type, election_id)
+		VALUES ($1, $1, $2, $3, $4, $5)
+		RETURNING id`,
+		now, timestamp, hash, string(jType), election.ID).Scan(&updateID); err != nil {
+		return fmt.Errorf("error creating update: %v", err)
+	}
+
+	tallies, err := conn.Exec(ctx, `
+		INSERT INTO vote_tallies (created_at, updated_at, ballot_response_id, update_id, contest_id, votes, vote_percentage, ballots_counted, registered_voters)
+		SELECT $1::timestamptz, $1::timestamptz, b.id, $2, c.id, s.votes, s.vote_percentage, s.ballots_counted, s.registered_voters
+		FROM staged_records s
+		JOIN contests c ON c.election_id = $3 AND c.contest_key = s.contest_key
+		JOIN ballot_responses b ON b.contest_id = c.id AND b.name = s.ballot_response
+		WHERE s.county = '' AND s.contest_key = ANY($4::text[])`,
+		now, updateID, election.ID, changedKeys)
+	if err != nil {
+		return fmt.Errorf("error creating vote tallies: %v", err)
+	}
+
+	countyTallies, err := conn.Exec(ctx, `
+		INSERT INTO county_tallies (update_id, contest_id, ballot_response_id, county, votes)
+		SELECT $1, c.id, b.id, s.county, s.votes
+		FROM staged_records s
+		JOIN contests c ON c.election_id = $2 AND c.contest_key = s.contest_key
+		JOIN ballot_responses b ON b.contest_id = c.id AND b.name = s.ballot_response
+		WHERE s.county <> ''`,
+		updateID, election.ID)
+	if err != nil {
+		return fmt.Errorf("error creating county tallies: %v", err)
+	}
+
+	deleteSQL, insertSQL := contestResultsSQL(updateContestsScope)
+	if _, err := conn.Exec(ctx, pgPlaceholders(deleteSQL), string(jType), updateID); err != nil {
+		return fmt.Errorf("error clearing contest results: %v", err)
+	}
+	if _, err := conn.Exec(ctx, pgPlaceholders(insertSQL), string(jType), updateID); err != nil {
+		return fmt.Errorf("error computing contest results: %v", err)
+	}
+
+	log.Printf("Merged %v contests, %v candidates, %v vote tallies and %v county tallies for %s update %v",
+		contests.RowsAffected(), candidates.RowsAffected(), tallies.RowsAffected(), countyTallies.RowsAffected(), jType, updateID)
+	return nil
+}
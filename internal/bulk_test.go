@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The bundled statewide results file the loaders are compared on.
+const benchmarkStateFile = "../csvstate/20240806_allstate(3).csv"
+
+// Compares the ways of loading an update. The PostgreSQL loaders, row by row
+// through gorm and with COPY, only run when TEST_PG_URL is set:
+//
+//	TEST_PG_URL=postgres://localhost/elections_test go test ./internal -run '^$' -bench LoadUpdate
+func BenchmarkLoadUpdate(b *testing.B) {
+	f, err := os.Open(benchmarkStateFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	records, hash, err := Parse(f, StateJurisdiction)
+	f.Close()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	type loadFunc func(store Store, election Election) error
+	loadUpdate := func(store Store, election Election) error {
+		return store.LoadUpdate(records, hash, time.Now(), election)
+	}
+	loadRows := func(store Store, election Election) error {
+		db := store.(*DB)
+		if err := db.LoadBallotResponses(records, election); err != nil {
+			return err
+		}
+		return db.UpdateVoteTallies(records, hash, time.Now(), election)
+	}
+	openPostgres := func(b *testing.B) Store {
+		url := os.Getenv("TEST_PG_URL")
+		if url == "" {
+			b.Skip("TEST_PG_URL is not set")
+		}
+		db, err := NewDB(url)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := db.MigrateSchema(); err != nil {
+			b.Fatal(err)
+		}
+		return db
+	}
+	benchmarks := []struct {
+		name string
+		open func(b *testing.B) Store
+		load loadFunc
+	}{
+		{"memory", func(b *testing.B) Store { return NewMemoryStore() }, loadUpdate},
+		{"sqlite", func(b *testing.B) Store {
+			db, err := NewDB("sqlite://" + filepath.Join(b.TempDir(), "elections.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := db.MigrateSchema(); err != nil {
+				b.Fatal(err)
+			}
+			return db
+		}, loadUpdate},
+		{"postgres/gorm", openPostgres, loadRows},
+		{"postgres/copy", openPostgres, loadUpdate},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			store := bm.open(b)
+			for i := range b.N {
+				// Each load goes into its own scratch election, deleted again
+				b.StopTimer()
+				election := Election{
+					ID:           fmt.Sprintf("benchmark_%d_%d", time.Now().UnixNano(), i),
+					Name:         "Load benchmark",
+					ElectionDate: time.Now(),
+					Type:         SpecialElection,
+					Status:       ArchivedElection,
+				}
+				if err := store.CreateElection(&election); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				err := bm.load(store, election)
+				b.StopTimer()
+				if deleteErr := store.DeleteElection(election.ID); deleteErr != nil {
+					b.Fatal(deleteErr)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(len(records))*float64(b.N)/b.Elapsed().Seconds(), "records/s")
+		})
+	}
+}
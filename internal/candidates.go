@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Candidate is a person across elections. Ballot responses are linked to a
+// candidate by the slug of their name as they are loaded; merging and
+// splitting candidates fixes the cases where that guess is wrong.
+type Candidate struct {
+	gorm.Model
+	Slug string `gorm:"uniqueIndex"`
+	Name string
+	// Slugs of candidates merged into this one, so that later elections link
+	// their ballot responses here too
+	Aliases         StringArray
+	BallotResponses []BallotResponse
+}
+
+// Ballot responses that are measure choices or placeholders rather than
+// people, compared lowercase.
+var nonCandidateResponses = []string{
+	"yes", "no", "approved", "rejected", "maintained", "repealed",
+	"levy yes", "levy no", "bonds yes", "bonds no", "write-in", "write in",
+}
+
+func isCandidateName(name string) bool {
+	return !slices.Contains(nonCandidateResponses, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// Returns the URL slug of a name: lowercase words joined by dashes.
+func candidateSlug(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// Returns slug, or slug with a numeric suffix if taken is true for it.
+func uniqueSlug(slug string, taken func(string) bool) string {
+	candidate := slug
+	for i := 2; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+	return candidate
+}
+
+// Maps every slug and alias to its candidate's ID.
+func candidateSlugs(candidates []Candidate) map[string]uint {
+	slugs := make(map[string]uint)
+	for _, candidate := range candidates {
+		slugs[candidate.Slug] = candidate.ID
+		for _, alias := range candidate.Aliases {
+			slugs[alias] = candidate.ID
+		}
+	}
+	return slugs
+}
+
+// Links an election's unlinked ballot responses to the candidate with the
+// same slug, creating candidates as needed. Responses that aren't people are
+// marked as such, which leaves only those new to the update being loaded.
+func linkCandidates(tx *gorm.DB, electionID string) error {
+	var responses []BallotResponse
+	if err := tx.Select("id, name").Where("election_id = ? AND candidate_id IS NULL AND NOT not_candidate", electionID).
+		Find(&responses).Error; err != nil {
+		return fmt.Errorf("error fetching unlinked candidates for %s: %v", electionID, err)
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	var notCandidates []uint
+	var names []string
+	for _, response := range responses {
+		if slug := candidateSlug(response.Name); slug != "" && isCandidateName(response.Name) {
+			names = append(names, slug)
+		} else {
+			notCandidates = append(notCandidates, response.ID)
+		}
+	}
+	for batch := range slices.Chunk(notCandidates, 500) {
+		if err := tx.Model(&BallotResponse{}).Where("id IN ?", batch).Update("not_candidate", true).Error; err != nil {
+			return fmt.Errorf("error marking measure choices: %v", err)
+		}
+	}
+	// Only the candidates these responses could link to: those with the same
+	// slug and those with aliases
+	var candidates []Candidate
+	for batch := range slices.Chunk(names, 500) {
+		var found []Candidate
+		if err := tx.Where("slug IN ?", batch).Find(&found).Error; err != nil {
+			return fmt.Errorf("error fetching candidates: %v", err)
+		}
+		candidates = append(candidates, found...)
+	}
+	var aliased []Candidate
+	if err := tx.Where("aliases IS NOT NULL AND aliases <> '{}'").Find(&aliased).Error; err != nil {
+		return fmt.Errorf("error fetching merged candidates: %v", err)
+	}
+	slugs := candidateSlugs(append(candidates, aliased...))
+
+	links := make(map[uint][]uint)
+	for _, response := range responses {
+		slug := candidateSlug(response.Name)
+		if slug == "" || !isCandidateName(response.Name) {
+			continue
+		}
+		id, ok := slugs[slug]
+		if !ok {
+			candidate := Candidate{Slug: slug, Name: response.Name}
+			if err := tx.Create(&candidate).Error; err != nil {
+				return fmt.Errorf("error creating candidate %s: %v", slug, err)
+			}
+			id = candidate.ID
+			slugs[slug] = id
+		}
+		links[id] = append(links[id], response.ID)
+	}
+	for id, responseIDs := range links {
+		if err := tx.Model(&BallotResponse{}).Where("id IN ?", responseIDs).Update("candidate_id", id).Error; err != nil {
+			return fmt.Errorf("error linking candidate %v: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Links the ballot responses of every election, for databases loaded before
+// candidates existed.
+func (db *DB) backfillCandidates() error {
+	var electionIDs []string
+	if err := db.Model(&BallotResponse{}).Where("candidate_id IS NULL AND NOT not_candidate").Distinct().Pluck("election_id", &electionIDs).Error; err != nil {
+		return fmt.Errorf("error finding unlinked candidates: %v", err)
+	}
+	for _, electionID := range electionIDs {
+		if err := linkCandidates(db.DB, electionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes candidates left without ballot responses after their elections
+// were deleted.
+func deleteOrphanedCandidates(tx *gorm.DB) error {
+	orphaned := tx.Model(&BallotResponse{}).Select("1").Where("ballot_responses.candidate_id = candidates.id")
+	if err := tx.Unscoped().Where("NOT EXISTS (?)", orphaned).Delete(&Candidate{}).Error; err != nil {
+		return fmt.Errorf("error deleting orphaned candidates: %v", err)
+	}
+	return nil
+}
+
+// Lists candidates whose name contains every word of query, or all of them
+// if it is empty, ordered by name.
+func (db *DB) ListCandidates(query string) ([]Candidate, error) {
+	tx := db.Preload("BallotResponses").Order("name")
+	for _, term := range SearchTerms(query) {
+		tx = tx.Where("LOWER(name) LIKE ?", "%"+term+"%")
+	}
+	var candidates []Candidate
+	if err := tx.Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("error listing candidates: %v", err)
+	}
+	return candidates, nil
+}
+
+// Finds a candidate by slug, or by the slug of a candidate merged into it,
+// with every ballot response's contest, election and vote tallies.
+func (db *DB) FindCandidate(slug string) (*Candidate, error) {
+	var candidates []Candidate
+	if err := db.Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("error fetching candidates: %v", err)
+	}
+	id, ok := candidateSlugs(candidates)[slug]
+	if !ok {
+		return nil, fmt.Errorf("candidate %s not found", slug)
+	}
+	var candidate Candidate
+	if err := db.Preload("BallotResponses.Contest.Election").
+		Preload("BallotResponses.VoteTallies", "update_id NOT IN (?)", db.Model(&Update{}).Select("id").Where("retracted_at IS NOT NULL")).
+		Preload("BallotResponses.VoteTallies.Update").
+		Preload("BallotResponses.CanonicalParty").
+		First(&candidate, id).Error; err != nil {
+		return nil, fmt.Errorf("error fetching candidate %s: %v", slug, err)
+	}
+	return &candidate, nil
+}
+
+// Moves every ballot response of one candidate to another and removes it. The
+// removed candidate's slug keeps working as an alias.
+func (db *DB) MergeCandidates(fromSlug string, intoSlug string) error {
+	if fromSlug == intoSlug {
+		return fmt.Errorf("cannot merge %s into itself", fromSlug)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var from, into Candidate
+		if err := tx.Where("slug = ?", fromSlug).First(&from).Error; err != nil {
+			return fmt.Errorf("candidate %s not found: %v", fromSlug, err)
+		}
+		if err := tx.Where("slug = ?", intoSlug).First(&into).Error; err != nil {
+			return fmt.Errorf("candidate %s not found: %v", intoSlug, err)
+		}
+		if err := tx.Model(&BallotResponse{}).Where("candidate_id = ?", from.ID).Update("candidate_id", into.ID).Error; err != nil {
+			return fmt.Errorf("error moving ballot responses: %v", err)
+		}
+		into.Aliases = append(append(into.Aliases, from.Slug), from.Aliases...)
+		if err := tx.Model(&into).Update("aliases", into.Aliases).Error; err != nil {
+			return fmt.Errorf("error updating aliases of %s: %v", intoSlug, err)
+		}
+		if err := tx.Unscoped().Delete(&from).Error; err != nil {
+			return fmt.Errorf("error deleting candidate %s: %v", fromSlug, err)
+		}
+		return nil
+	})
+}
+
+// Moves some of a candidate's ballot responses to a new candidate, named after
+// the first of them, and returns it.
+func (db *DB) SplitCandidate(slug string, ballotResponseIDs []uint) (*Candidate, error) {
+	var split Candidate
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var candidate Candidate
+		if err := tx.Where("slug = ?", slug).Preload("BallotResponses").First(&candidate).Error; err != nil {
+			return fmt.Errorf("candidate %s not found: %v", slug, err)
+		}
+		moved, err := splitResponses(candidate, ballotResponseIDs)
+		if err != nil {
+			return err
+		}
+		var candidates []Candidate
+		if err := tx.Find(&candidates).Error; err != nil {
+			return fmt.Errorf("error fetching candidates: %v", err)
+		}
+		slugs := candidateSlugs(candidates)
+		split = Candidate{
+			Slug: uniqueSlug(candidateSlug(moved[0].Name), func(s string) bool { _, ok := slugs[s]; return ok }),
+			Name: moved[0].Name,
+		}
+		if err := tx.Create(&split).Error; err != nil {
+			return fmt.Errorf("error creating candidate: %v", err)
+		}
+		if err := tx.Model(&BallotResponse{}).Where("id IN ?", ballotResponseIDs).Update("candidate_id", split.ID).Error; err != nil {
+			return fmt.Errorf("error moving ballot responses: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &split, nil
+}
+
+// Returns the candidate's ballot responses with the given IDs, checking that
+// they all belong to it and that at least one stays behind.
+func splitResponses(candidate Candidate, ballotResponseIDs []uint) ([]BallotResponse, error) {
+	if len(ballotResponseIDs) == 0 {
+		return nil, fmt.Errorf("no ballot responses to split off")
+	}
+	var moved []BallotResponse
+	for _, id := range slices.Compact(slices.Sorted(slices.Values(ballotResponseIDs))) {
+		i := slices.IndexFunc(candidate.BallotResponses, func(r BallotResponse) bool { return r.ID == id })
+		if i < 0 {
+			return nil, fmt.Errorf("ballot response %v does not belong to %s", id, candidate.Slug)
+		}
+		moved = append(moved, candidate.BallotResponses[i])
+	}
+	if len(moved) == len(candidate.BallotResponses) {
+		return nil, fmt.Errorf("cannot split off every ballot response of %s", candidate.Slug)
+	}
+	return moved, nil
+}
@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ContestCategory is the kind of office a contest fills, or whether it is a
+// ballot measure.
+type ContestCategory string
+
+const (
+	FederalContest     ContestCategory = "federal"
+	StatewideContest   ContestCategory = "statewide"
+	LegislativeContest ContestCategory = "legislative"
+	JudicialContest    ContestCategory = "judicial"
+	LocalContest       ContestCategory = "local"
+	MeasureContest     ContestCategory = "measure"
+)
+
+var ContestCategories = []ContestCategory{FederalContest, StatewideContest, LegislativeContest, JudicialContest, LocalContest, MeasureContest}
+
+func ParseContestCategory(s string) (ContestCategory, error) {
+	for _, c := range ContestCategories {
+		if strings.EqualFold(s, string(c)) {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown contest category %q", s)
+}
+
+// ContestLevel is the level of government a contest is decided at.
+type ContestLevel string
+
+const (
+	FederalLevel ContestLevel = "federal"
+	StateLevel   ContestLevel = "state"
+	CountyLevel  ContestLevel = "county"
+	// Cities, school districts and special purpose districts
+	LocalLevel ContestLevel = "local"
+)
+
+var ContestLevels = []ContestLevel{FederalLevel, StateLevel, CountyLevel, LocalLevel}
+
+func ParseContestLevel(s string) (ContestLevel, error) {
+	for _, l := range ContestLevels {
+		if strings.EqualFold(s, string(l)) {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown contest level %q", s)
+}
+
+// ContestRule classifies the contests whose ballot title or district matches
+// its pattern. A rule can set the category, the level or both.
+type ContestRule struct {
+	// "title" or "district"
+	Field    string
+	Pattern  *regexp.Regexp
+	Category ContestCategory
+	Level    ContestLevel
+}
+
+func (rule ContestRule) matches(title string, district string) bool {
+	if rule.Field == "district" {
+		return rule.Pattern.MatchString(district)
+	}
+	return rule.Pattern.MatchString(title)
+}
+
+func contestRule(field string, pattern string, category ContestCategory, level ContestLevel) ContestRule {
+	return ContestRule{Field: field, Pattern: regexp.MustCompile(`(?i)` + pattern), Category: category, Level: level}
+}
+
+// Rules for Washington's contests, checked after the ones in CONTEST_RULES.
+var DefaultContestRules = []ContestRule{
+	contestRule("title", `\b(proposition|prop\.|initiative|referendum|advisory vote|amendment|measure|levy|bonds?|charter|annexation|resolution|ordinance)\b`, MeasureContest, ""),
+	contestRule("title", `\b(court|judge|justice)\b`, JudicialContest, ""),
+	contestRule("district", `\bcourt\b`, JudicialContest, ""),
+	contestRule("title", `\b(united states|u\.s\.|congress|congressional|president)\b`, FederalContest, FederalLevel),
+	contestRule("district", `^(federal|congressional district\b)`, FederalContest, FederalLevel),
+	contestRule("title", `\b(state senator|state representative|legislat)`, LegislativeContest, StateLevel),
+	contestRule("district", `\blegislative district\b`, LegislativeContest, StateLevel),
+	contestRule("title", `^(governor|lieutenant governor|secretary of state|state treasurer|state auditor|attorney general|commissioner of public lands|superintendent of public instruction|insurance commissioner)$`, StatewideContest, StateLevel),
+	contestRule("district", `^(state of washington|statewide|washington)$`, StatewideContest, StateLevel),
+	contestRule("district", `\b(state supreme court|supreme court|court of appeals)\b`, "", StateLevel),
+	contestRule("district", `\b(city|town|municipal|school|fire|port|water|sewer|hospital|parks?|library|cemetery|transit|utility|flood|drainage|irrigation)\b`, "", LocalLevel),
+	contestRule("district", `\b(county|counties|superior court|district court)\b`, "", CountyLevel),
+}
+
+// Parses rules written as category:level:field:pattern and separated by
+// semicolons, for example "judicial::title:Tribunal;measure:local:title:^Bond".
+// Either the category or the level can be left empty, the field is title or
+// district, and the pattern is a case-insensitive regular expression.
+func ParseContestRules(s string) ([]ContestRule, error) {
+	var rules []ContestRule
+	for _, field := range strings.Split(s, ";") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(field), ":", 4)
+		if len(parts) != 4 || parts[3] == "" || (parts[0] == "" && parts[1] == "") {
+			return nil, fmt.Errorf("invalid contest rule %q: expected category:level:field:pattern", field)
+		}
+		rule := ContestRule{Field: strings.ToLower(parts[2])}
+		if rule.Field != "title" && rule.Field != "district" {
+			return nil, fmt.Errorf("invalid field in contest rule %q: expected title or district", field)
+		}
+		var err error
+		if parts[0] != "" {
+			if rule.Category, err = ParseContestCategory(parts[0]); err != nil {
+				return nil, err
+			}
+		}
+		if parts[1] != "" {
+			if rule.Level, err = ParseContestLevel(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+		if rule.Pattern, err = regexp.Compile(`(?i)` + parts[3]); err != nil {
+			return nil, fmt.Errorf("invalid pattern in contest rule %q: %v", field, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Returns the rules set in the CONTEST_RULES environment variable followed by
+// the default rules.
+func ContestRulesFromEnv() ([]ContestRule, error) {
+	rules, err := ParseContestRules(os.Getenv("CONTEST_RULES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONTEST_RULES: %v", err)
+	}
+	return append(rules, DefaultContestRules...), nil
+}
+
+// Returns the category and level of a contest from the first rules matching
+// its ballot title or district that set them. Contests no rule places are
+// local.
+func ClassifyContest(rules []ContestRule, title string, district string) (ContestCategory, ContestLevel) {
+	var category ContestCategory
+	var level ContestLevel
+	for _, rule := range rules {
+		if category != "" && level != "" {
+			break
+		}
+		if !rule.matches(title, district) {
+			continue
+		}
+		category = cmp.Or(category, rule.Category)
+		level = cmp.Or(level, rule.Level)
+	}
+	return cmp.Or(category, LocalContest), cmp.Or(level, LocalLevel)
+}
+
+// ContestFilter picks contests by category and level. Empty fields match
+// every contest.
+type ContestFilter struct {
+	Category ContestCategory
+	Level    ContestLevel
+}
+
+func (f ContestFilter) Matches(contest Contest) bool {
+	return (f.Category == "" || contest.Category == f.Category) && (f.Level == "" || contest.Level == f.Level)
+}
+
+// Classifies an election's contests with the rules in CONTEST_RULES, only the
+// ones not classified yet unless all is set. Returns the number of contests
+// whose classification changed.
+func classifyContests(tx *gorm.DB, electionID string, all bool) (int, error) {
+	rules, err := ContestRulesFromEnv()
+	if err != nil {
+		return 0, err
+	}
+	query := tx.Where("election_id = ?", electionID)
+	if !all {
+		query = query.Where("category = '' OR category IS NULL")
+	}
+	var contests []Contest
+	if err := query.Find(&contests).Error; err != nil {
+		return 0, fmt.Errorf("error fetching contests for %s: %v", electionID, err)
+	}
+	changed := make(map[ContestFilter][]uint)
+	for _, contest := range contests {
+		category, level := ClassifyContest(rules, contest.BallotTitle, contest.District)
+		if category != contest.Category || level != contest.Level {
+			class := ContestFilter{Category: category, Level: level}
+			changed[class] = append(changed[class], contest.ID)
+		}
+	}
+	count := 0
+	for class, ids := range changed {
+		for chunk := range slices.Chunk(ids, 500) {
+			if err := tx.Model(&Contest{}).Where("id IN ?", chunk).Updates(Contest{Category: class.Category, Level: class.Level}).Error; err != nil {
+				return 0, fmt.Errorf("error classifying contests: %v", err)
+			}
+		}
+		count += len(ids)
+	}
+	return count, nil
+}
+
+// Classifies contests loaded before contests were classified.
+func (db *DB) backfillContestClassification() error {
+	var electionIDs []string
+	if err := db.Model(&Contest{}).Where("category = '' OR category IS NULL").Distinct().Pluck("election_id", &electionIDs).Error; err != nil {
+		return fmt.Errorf("error finding unclassified contests: %v", err)
+	}
+	for _, electionID := range electionIDs {
+		if _, err := classifyContests(db.DB, electionID, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Classifies every contest of an election again, after the rules changed.
+func (db *DB) ClassifyContests(electionID string) (int, error) {
+	var count int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		count, err = classifyContests(tx, electionID, true)
+		return err
+	})
+	return count, err
+}
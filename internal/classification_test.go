@@ -0,0 +1,128 @@
+package internal
+
+import "testing"
+
+func TestParseContestRules(t *testing.T) {
+	tests := []struct {
+		s       string
+		rules   int
+		wantErr bool
+	}{
+		{s: "", rules: 0},
+		{s: " ; ", rules: 0},
+		{s: "judicial::title:Tribunal", rules: 1},
+		{s: "judicial::title:Tribunal;measure:local:DISTRICT:^Bond;", rules: 2},
+		{s: ":county:district:Metro", rules: 1},
+		{s: "Measure:Local:title:a:b", rules: 1},
+		{s: "judicial::title", wantErr: true},
+		{s: "judicial::title:", wantErr: true},
+		{s: "::title:Tribunal", wantErr: true},
+		{s: "judicial::ballot:Tribunal", wantErr: true},
+		{s: "tribal::title:Tribunal", wantErr: true},
+		{s: "judicial:city:title:Tribunal", wantErr: true},
+		{s: "judicial::title:(Tribunal", wantErr: true},
+		{s: "judicial::title:Tribunal;garbage", wantErr: true},
+	}
+	for _, test := range tests {
+		rules, err := ParseContestRules(test.s)
+		if (err != nil) != test.wantErr || len(rules) != test.rules {
+			t.Errorf("ParseContestRules(%q) = %d rules, %v; want %d, error %v", test.s, len(rules), err, test.rules, test.wantErr)
+		}
+	}
+}
+
+func TestContestRulesFromEnv(t *testing.T) {
+	t.Setenv("CONTEST_RULES", "")
+	if rules, err := ContestRulesFromEnv(); err != nil || len(rules) != len(DefaultContestRules) {
+		t.Errorf("ContestRulesFromEnv() without CONTEST_RULES = %d rules, %v; want the defaults", len(rules), err)
+	}
+	t.Setenv("CONTEST_RULES", "judicial::title:Tribunal")
+	rules, err := ContestRulesFromEnv()
+	if err != nil || len(rules) != len(DefaultContestRules)+1 || rules[0].Category != JudicialContest {
+		t.Errorf("ContestRulesFromEnv() = %d rules, %v; want the rule then the defaults", len(rules), err)
+	}
+	t.Setenv("CONTEST_RULES", "judicial::title:(Tribunal")
+	if _, err := ContestRulesFromEnv(); err == nil {
+		t.Error("ContestRulesFromEnv() accepted an invalid pattern")
+	}
+}
+
+func TestClassifyContest(t *testing.T) {
+	custom, err := ParseContestRules("judicial::title:Tribunal;:county:district:^Metro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	customRules := append(custom, DefaultContestRules...)
+	tests := []struct {
+		title    string
+		district string
+		rules    []ContestRule
+		category ContestCategory
+		level    ContestLevel
+	}{
+		{"Proposition No. 1", "City of Seattle", DefaultContestRules, MeasureContest, LocalLevel},
+		{"Charter Amendment No. 1", "King County", DefaultContestRules, MeasureContest, CountyLevel},
+		{"Advisory Vote No. 42", "State of Washington", DefaultContestRules, MeasureContest, StateLevel},
+		{"Congressional District No. 9 U.S. Representative", "Congressional District No. 9", DefaultContestRules, FederalContest, FederalLevel},
+		{"President and Vice President", "Federal", DefaultContestRules, FederalContest, FederalLevel},
+		{"State Representative Pos. 1", "Legislative District No. 43", DefaultContestRules, LegislativeContest, StateLevel},
+		{"Governor", "State of Washington", DefaultContestRules, StatewideContest, StateLevel},
+		{"Lieutenant Governor", "Washington", DefaultContestRules, StatewideContest, StateLevel},
+		{"Justice Position 2", "State Supreme Court", DefaultContestRules, JudicialContest, StateLevel},
+		{"Judge Position 3", "King County Superior Court", DefaultContestRules, JudicialContest, CountyLevel},
+		{"Council Position 1", "City of Seattle", DefaultContestRules, LocalContest, LocalLevel},
+		{"Commissioner Position 2", "Port of Seattle", DefaultContestRules, LocalContest, LocalLevel},
+		{"King County Executive", "King County", DefaultContestRules, LocalContest, CountyLevel},
+		{"Mayor", "Nowhere Special", DefaultContestRules, LocalContest, LocalLevel},
+		{"", "", DefaultContestRules, LocalContest, LocalLevel},
+		{"Mayor", "City of Seattle", nil, LocalContest, LocalLevel},
+		{"PROPOSITION 1", "CITY OF SEATTLE", DefaultContestRules, MeasureContest, LocalLevel},
+		// Custom rules come first, and a rule setting one field leaves the
+		// other to later rules
+		{"Tribunal Member", "City of Seattle", customRules, JudicialContest, LocalLevel},
+		{"Proposition No. 1", "Metro Parks District", customRules, MeasureContest, CountyLevel},
+		{"Tribunal Member", "City of Seattle", DefaultContestRules, LocalContest, LocalLevel},
+	}
+	for _, test := range tests {
+		category, level := ClassifyContest(test.rules, test.title, test.district)
+		if category != test.category || level != test.level {
+			t.Errorf("ClassifyContest(%q, %q) = %s, %s; want %s, %s", test.title, test.district, category, level, test.category, test.level)
+		}
+	}
+}
+
+func TestContestFilterMatches(t *testing.T) {
+	contest := Contest{Category: JudicialContest, Level: CountyLevel}
+	tests := []struct {
+		filter ContestFilter
+		want   bool
+	}{
+		{ContestFilter{}, true},
+		{ContestFilter{Category: JudicialContest}, true},
+		{ContestFilter{Level: CountyLevel}, true},
+		{ContestFilter{Category: JudicialContest, Level: CountyLevel}, true},
+		{ContestFilter{Category: MeasureContest}, false},
+		{ContestFilter{Level: StateLevel}, false},
+		{ContestFilter{Category: JudicialContest, Level: StateLevel}, false},
+	}
+	for _, test := range tests {
+		if got := test.filter.Matches(contest); got != test.want {
+			t.Errorf("%+v.Matches(%+v) = %v, want %v", test.filter, contest, got, test.want)
+		}
+	}
+}
+
+func TestParseContestCategoryAndLevel(t *testing.T) {
+	if category, err := ParseContestCategory("Judicial"); err != nil || category != JudicialContest {
+		t.Errorf("ParseContestCategory(Judicial) = %q, %v", category, err)
+	}
+	if _, err := ParseContestCategory("tribal"); err == nil {
+		t.Error("ParseContestCategory accepted tribal")
+	}
+	if level, err := ParseContestLevel("COUNTY"); err != nil || level != CountyLevel {
+		t.Errorf("ParseContestLevel(COUNTY) = %q, %v", level, err)
+	}
+	if _, err := ParseContestLevel("city"); err == nil {
+		t.Error("ParseContestLevel accepted city")
+	}
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+func (db *DB) ListContests(electionID string) ([]Contest, error) {
+	var contests []Contest
+	if err := db.Where("election_id = ?", electionID).Preload("Election").Find(&contests).Error; err != nil {
+		return nil, fmt.Errorf("error fetching contests for %s: %v", electionID, err)
+	}
+	return contests, nil
+}
+
+func (db *DB) FindContest(electionID string, contestKey string) (*Contest, error) {
+	var contest Contest
+	err := db.Where("election_id = ? AND contest_key = ?", electionID, contestKey).Preload("Election").First(&contest).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("contest %s not found in %s", contestKey, electionID)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching contest %s: %v", contestKey, err)
+	}
+	return &contest, nil
+}
+
+func (db *DB) ContestCandidates(contestID uint) ([]BallotResponse, error) {
+	var candidates []BallotResponse
+	// Tallies from retracted updates are left out
+	if err := db.Where("contest_id = ?", contestID).
+		Preload("VoteTallies", "update_id NOT IN (?)", db.Model(&Update{}).Select("id").Where("retracted_at IS NOT NULL")).
+		Preload("VoteTallies.Update").
+		Preload("Candidate").
+		Preload("CanonicalParty").
+		Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("error fetching candidates for contest %v: %v", contestID, err)
+	}
+	return candidates, nil
+}
@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Washington's counties, as the Secretary of State names them.
+var washingtonCounties = []string{
+	"Adams", "Asotin", "Benton", "Chelan", "Clallam", "Clark", "Columbia",
+	"Cowlitz", "Douglas", "Ferry", "Franklin", "Garfield", "Grant",
+	"Grays Harbor", "Island", "Jefferson", "King", "Kitsap", "Kittitas",
+	"Klickitat", "Lewis", "Lincoln", "Mason", "Okanogan", "Pacific",
+	"Pend Oreille", "Pierce", "San Juan", "Skagit", "Skamania", "Snohomish",
+	"Spokane", "Stevens", "Thurston", "Wahkiakum", "Walla Walla", "Whatcom",
+	"Whitman", "Yakima",
+}
+
+// Returns the county a jurisdiction name refers to ("King" for "King County"),
+// or "" if it isn't a Washington county. The statewide results file uses
+// JurisdictionName for the kind of race instead, which never matches.
+func countyName(jurisdiction string) string {
+	name := strings.TrimSpace(jurisdiction)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, " County"), " county")
+	for _, county := range washingtonCounties {
+		if strings.EqualFold(name, county) {
+			return county
+		}
+	}
+	return ""
+}
+
+// CountyTally is a candidate's votes in one county as of an update, from the
+// state's per-county results. The statewide totals are stored as VoteTallies
+// from the statewide file, these only break them down.
+type CountyTally struct {
+	ID               uint           `gorm:"primaryKey"`
+	UpdateID         uint           `gorm:"index"`
+	Update           Update         `gorm:"constraint:OnDelete:CASCADE"`
+	ContestID        uint           `gorm:"index"`
+	BallotResponseID uint           `gorm:"index"`
+	BallotResponse   BallotResponse `gorm:"constraint:OnDelete:CASCADE"`
+	County           string
+	Votes            int
+}
+
+// Separates the records that break a contest down by county from the totals.
+func splitCountyRecords(records []GenericVoteRecord) (totals []GenericVoteRecord, counties []GenericVoteRecord) {
+	for _, record := range records {
+		if record.County == "" {
+			totals = append(totals, record)
+		} else {
+			counties = append(counties, record)
+		}
+	}
+	return totals, counties
+}
+
+// Stores the county records of an update. contests maps contest keys to
+// contests and candidates maps candidate keys to ballot response IDs.
+func storeCountyTallies(tx *gorm.DB, updateID uint, records []GenericVoteRecord, contests map[string]Contest, candidates map[string]uint) error {
+	var tallies []CountyTally
+	for _, record := range records {
+		contestKey := getContestKey(record.BallotTitle, record.DistrictName)
+		contest, ok := contests[contestKey]
+		if !ok {
+			return fmt.Errorf("contest not found: %s", contestKey)
+		}
+		candidateKey := getCandidateKey(contest.ID, record.BallotResponse)
+		ballotResponseID, ok := candidates[candidateKey]
+		if !ok {
+			return fmt.Errorf("candidate not found: %s", candidateKey)
+		}
+		tallies = append(tallies, CountyTally{
+			UpdateID:         updateID,
+			ContestID:        contest.ID,
+			BallotResponseID: ballotResponseID,
+			County:           record.County,
+			Votes:            record.Votes,
+		})
+	}
+	if len(tallies) == 0 {
+		return nil
+	}
+	fmt.Printf("Loading %v county tallies\n", len(tallies))
+	if err := tx.CreateInBatches(tallies, 500).Error; err != nil {
+		return fmt.Errorf("error creating county tallies: %v", err)
+	}
+	return nil
+}
+
+// Returns a contest's county tallies from the latest update that broke it
+// down by county, leaving out retracted updates.
+func (db *DB) CountyTallies(contestID uint) ([]CountyTally, error) {
+	var latest Update
+	err := db.Joins("JOIN county_tallies ON county_tallies.update_id = updates.id").
+		Where("county_tallies.contest_id = ? AND updates.retracted_at IS NULL", contestID).
+		Order("updates.timestamp DESC, updates.id DESC").
+		First(&latest).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error finding county results for contest %v: %v", contestID, err)
+	}
+	var tallies []CountyTally
+	if err := db.Where("contest_id = ? AND update_id = ?", contestID, latest.ID).
+		Order("county").
+		Find(&tallies).Error; err != nil {
+		return nil, fmt.Errorf("error fetching county results for contest %v: %v", contestID, err)
+	}
+	return tallies, nil
+}
+
+// CountyResult is a contest's votes in one county.
+type CountyResult struct {
+	County string
+	// Votes of each candidate, keyed by ballot response ID
+	Votes map[uint]int
+	Total int
+}
+
+// Returns the candidate's share of the votes in the county, from 0 to 100.
+func (r CountyResult) Percent(ballotResponseID uint) float64 {
+	if r.Total <= 0 {
+		return 0
+	}
+	return float64(r.Votes[ballotResponseID]) * 100 / float64(r.Total)
+}
+
+// Groups county tallies by county, in alphabetical order, and adds them up
+// into a total with County set to "".
+func GroupCountyTallies(tallies []CountyTally) ([]CountyResult, CountyResult) {
+	byCounty := make(map[string]*CountyResult)
+	total := CountyResult{Votes: make(map[uint]int)}
+	for _, tally := range tallies {
+		result, ok := byCounty[tally.County]
+		if !ok {
+			result = &CountyResult{County: tally.County, Votes: make(map[uint]int)}
+			byCounty[tally.County] = result
+		}
+		result.Votes[tally.BallotResponseID] += tally.Votes
+		result.Total += tally.Votes
+		total.Votes[tally.BallotResponseID] += tally.Votes
+		total.Total += tally.Votes
+	}
+	results := make([]CountyResult, 0, len(byCounty))
+	for _, result := range byCounty {
+		results = append(results, *result)
+	}
+	slices.SortFunc(results, func(a, b CountyResult) int { return cmp.Compare(a.County, b.County) })
+	return results, total
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestCountyName(t *testing.T) {
+	tests := map[string]string{
+		"King County":        "King",
+		" king county ":      "King",
+		"PIERCE":             "Pierce",
+		"Grays Harbor":       "Grays Harbor",
+		"Walla Walla County": "Walla Walla",
+		"Statewide":          "",
+		"Congressional":      "",
+		"":                   "",
+	}
+	for jurisdiction, want := range tests {
+		if got := countyName(jurisdiction); got != want {
+			t.Errorf("countyName(%q) = %q, want %q", jurisdiction, got, want)
+		}
+	}
+}
+
+func TestGroupCountyTallies(t *testing.T) {
+	tallies := []CountyTally{
+		{County: "Pierce", BallotResponseID: 1, Votes: 100},
+		{County: "King", BallotResponseID: 1, Votes: 200},
+		{County: "King", BallotResponseID: 2, Votes: 100},
+		{County: "Pierce", BallotResponseID: 2, Votes: 100},
+		{County: "Adams", BallotResponseID: 2, Votes: 0},
+	}
+	counties, total := GroupCountyTallies(tallies)
+	if len(counties) != 3 || counties[0].County != "Adams" || counties[1].County != "King" || counties[2].County != "Pierce" {
+		t.Fatalf("counties = %+v, want Adams, King and Pierce", counties)
+	}
+	king := counties[1]
+	if king.Total != 300 || king.Votes[1] != 200 || king.Votes[2] != 100 || king.Percent(1) != 200.0*100/300 {
+		t.Errorf("King = %+v, want 200 and 100 of 300", king)
+	}
+	if adams := counties[0]; adams.Total != 0 || adams.Percent(2) != 0 {
+		t.Errorf("Adams = %+v with %v%%, want no votes", adams, adams.Percent(2))
+	}
+	if total.County != "" || total.Total != 500 || !maps.Equal(total.Votes, map[uint]int{1: 300, 2: 200}) {
+		t.Errorf("total = %+v, want 300 and 200 of 500", total)
+	}
+	sum := 0
+	for _, county := range counties {
+		sum += county.Total
+	}
+	if sum != total.Total {
+		t.Errorf("counties add up to %d, total is %d", sum, total.Total)
+	}
+
+	counties, total = GroupCountyTallies(nil)
+	if counties == nil || len(counties) != 0 || total.Total != 0 || total.Votes == nil {
+		t.Errorf("GroupCountyTallies(nil) = %#v, %#v; want no counties and an empty total", counties, total)
+	}
+}
+
+func TestStoreCountyTallies(t *testing.T) {
+	record := func(county string, candidate string, votes int) GenericVoteRecord {
+		return GenericVoteRecord{
+			DistrictName:     "State of Washington",
+			BallotTitle:      "Governor",
+			BallotResponse:   candidate,
+			Votes:            votes,
+			JurisdictionType: StateJurisdiction,
+			County:           county,
+		}
+	}
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		loadTestUpdate(t, store, election, "state", 1,
+			record("", "Alice", 300), record("", "Bob", 200),
+			record("King", "Alice", 200), record("King", "Bob", 100),
+			record("Pierce", "Alice", 100), record("Pierce", "Bob", 100))
+
+		contest, err := store.FindContest(election.ID, getContestKey("Governor", "State of Washington"))
+		if err != nil || contest == nil {
+			t.Fatalf("contest not found: %v", err)
+		}
+		tallies, err := store.CountyTallies(contest.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counties, total := GroupCountyTallies(tallies)
+		if len(counties) != 2 || counties[0].County != "King" || counties[1].County != "Pierce" {
+			t.Errorf("counties = %+v, want King and Pierce", counties)
+		}
+		results, err := store.CurrentResults(contest.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stateTotal := make(map[uint]int)
+		for _, result := range results {
+			stateTotal[result.BallotResponseID] = result.Votes
+		}
+		if len(stateTotal) != 2 || !maps.Equal(total.Votes, stateTotal) {
+			t.Errorf("county total = %v, want the state's %v", total.Votes, stateTotal)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 
 	"github.com/gocarina/gocsv"
 )
@@ -22,17 +23,27 @@ func Parse(reader io.ReadCloser, jurisdictionType JurisdictionType) ([]GenericVo
 		if err := gocsv.Unmarshal(teeReader, &stateRecords); err != nil {
 			return nil, "", err
 		}
-		for _, record := range stateRecords {
-			records = append(records, record.ToGeneric())
+		for i, record := range stateRecords {
+			generic := record.ToGeneric()
+			generic.Row = i + 2 // 1-based, after the header
+			records = append(records, generic)
 		}
 	case CountyJurisdiction:
 		var countyRecords []*CountyCSVRecord
 		if err := gocsv.Unmarshal(teeReader, &countyRecords); err != nil {
 			return nil, "", err
 		}
-		for _, record := range countyRecords {
-			records = append(records, record.ToGeneric())
+		for i, record := range countyRecords {
+			generic := record.ToGeneric()
+			generic.Row = i + 2 // 1-based, after the header
+			records = append(records, generic)
 		}
+	case PrecinctJurisdiction:
+		var precinctRows []*PrecinctCSVRecord
+		if err := gocsv.Unmarshal(teeReader, &precinctRows); err != nil {
+			return nil, "", err
+		}
+		records = precinctRecords(precinctRows)
 	default:
 		return nil, "", fmt.Errorf("unknown jurisdiction type: %s", jurisdictionType)
 	}
@@ -73,7 +84,11 @@ func ProcessContests(records []GenericVoteRecord, election Election) ([]Contest,
 			contestMap[contestKey] = contest
 		}
 
-		// Create ballot response and add to Contest
+		// Create ballot response and add to Contest, each response is only
+		// listed once per contest
+		if slices.ContainsFunc(contest.BallotResponses, func(br BallotResponse) bool { return br.Name == record.BallotResponse }) {
+			continue
+		}
 		ballotResponse := BallotResponse{
 			Name:       record.BallotResponse,
 			Party:      &record.PartyPreference,
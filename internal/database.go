@@ -5,10 +5,13 @@ import (
 	"log"
 	"os"
 	"slices"
+	"strings"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -16,7 +19,9 @@ type DB struct {
 	*gorm.DB
 }
 
-func NewDB(pgURL string) (*DB, error) {
+// Opens the database at dbURL. URLs starting with sqlite:// open (or create)
+// a SQLite file, anything else is passed to the PostgreSQL driver.
+func NewDB(dbURL string) (*DB, error) {
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
 		logger.Config{
@@ -24,7 +29,15 @@ func NewDB(pgURL string) (*DB, error) {
 		},
 	)
 
-	db, err := gorm.Open(postgres.Open(pgURL), &gorm.Config{Logger: newLogger})
+	var dialector gorm.Dialector
+	if path, ok := strings.CutPrefix(dbURL, "sqlite://"); ok {
+		// Cascading deletes rely on foreign keys, which SQLite leaves off by default
+		dialector = sqlite.Open(path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	} else {
+		dialector = postgres.Open(dbURL)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: newLogger})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
@@ -33,56 +46,137 @@ func NewDB(pgURL string) (*DB, error) {
 }
 
 func (db *DB) MigrateSchema() error {
-	err := db.AutoMigrate(&Contest{}, &BallotResponse{}, &Update{}, &VoteTally{})
+	// Has to run before AutoMigrate builds the unique contest and candidate
+	// indexes
+	if err := db.repairIdentities(); err != nil {
+		return err
+	}
+	err := db.AutoMigrate(&Election{}, &Contest{}, &Candidate{}, &BallotResponse{}, &Update{}, &VoteTally{}, &CountyTally{}, &Precinct{}, &PrecinctTally{}, &ContestResult{}, &UpdateEvent{}, &IngestRun{}, &Boundary{}, &District{}, &Party{}, &Migration{})
 	if err != nil {
 		return fmt.Errorf("failed to migrate database schema: %v", err)
 	}
+	// Update hashes used to be unique across all elections, they are now
+	// unique per election (idx_update_election_hash)
+	if db.Migrator().HasIndex(&Update{}, "idx_updates_hash") {
+		if err := db.Migrator().DropIndex(&Update{}, "idx_updates_hash"); err != nil {
+			return fmt.Errorf("failed to drop old update hash index: %v", err)
+		}
+	}
+	if err := db.createSearchIndexes(); err != nil {
+		return err
+	}
+	if err := db.backfillElections(); err != nil {
+		return err
+	}
+	if err := db.backfillContestResults(); err != nil {
+		return err
+	}
+	if err := db.runOnce("backfill_candidates", db.backfillCandidates); err != nil {
+		return err
+	}
+	if err := db.backfillDistricts(); err != nil {
+		return err
+	}
+	if err := db.seedParties(); err != nil {
+		return err
+	}
+	if err := db.backfillParties(); err != nil {
+		return err
+	}
+	if err := db.backfillContestClassification(); err != nil {
+		return err
+	}
+	if err := db.backfillIngestRuns(); err != nil {
+		return err
+	}
 	log.Println("Schema migrated successfully")
 	return nil
 }
 
+// A data migration that has already run against this database.
+type Migration struct {
+	Name      string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+// Runs migrate unless the migration called name has already run, and records
+// it as run afterwards. Meant for backfills that would otherwise rescan every
+// row each time the schema is migrated.
+func (db *DB) runOnce(name string, migrate func() error) error {
+	var count int64
+	if err := db.Model(&Migration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return fmt.Errorf("error checking migration %s: %v", name, err)
+	}
+	if count > 0 {
+		return nil
+	}
+	if err := migrate(); err != nil {
+		return err
+	}
+	if err := db.Create(&Migration{Name: name, AppliedAt: time.Now()}).Error; err != nil {
+		return fmt.Errorf("error recording migration %s: %v", name, err)
+	}
+	return nil
+}
+
 func (db *DB) LoadBallotResponses(data []GenericVoteRecord, election Election) error {
 	// Process the data based on jurisdiction type
 	var contests []Contest
 	var err error
 
 	contests, err = ProcessContests(data, election)
-
-	tx := db.Begin()
-	// Ensure rollback if panic occurs
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			panic(r) // re-throw panic after Rollback
-		}
-	}()
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
 	fmt.Printf("Loading %v contests.\n", len(contests))
+	if len(contests) == 0 {
+		return fmt.Errorf("no contests to load")
+	}
 
-	totalCandidates := 0
-	// Insert contests and candidates into the database
-	for _, contest := range contests {
-		if err := tx.FirstOrCreate(&contest, contest).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("error creating contest: %v", err)
+	// Runs as a nested transaction (savepoint) when called from LoadUpdate
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := storeDistricts(tx, data); err != nil {
+			return err
 		}
-		totalCandidates += len(contest.BallotResponses)
-		for _, candidate := range contest.BallotResponses {
-			if err := tx.FirstOrCreate(&candidate, candidate).Error; err != nil {
-				tx.Rollback()
-				return fmt.Errorf("error creating candidate: %v \n under contest %+v", err, contest)
-			}
+		if err := loadBallotResponses(tx, contests); err != nil {
+			return err
 		}
+		_, err := classifyContests(tx, election.ID, false)
+		return err
+	})
+}
+
+func loadBallotResponses(tx *gorm.DB, contests []Contest) error {
+	// Upsert the contests against (election_id, contest_key), which gives us
+	// back the IDs of both new and existing rows. Soft-deleted rows come back
+	// with deleted_at cleared.
+	if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "election_id"}, {Name: "contest_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ballot_title", "district", "updated_at", "deleted_at"}),
+	}).CreateInBatches(&contests, 500).Error; err != nil {
+		return fmt.Errorf("error creating contests: %v", err)
 	}
 
-	fmt.Printf("Total candidates: %v\n", totalCandidates)
+	var candidates []BallotResponse
+	for _, contest := range contests {
+		for _, candidate := range contest.BallotResponses {
+			candidate.ContestID = contest.ID
+			candidates = append(candidates, candidate)
+		}
+	}
+	if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "contest_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"party", "updated_at", "deleted_at"}),
+	}).CreateInBatches(&candidates, 500).Error; err != nil {
+		return fmt.Errorf("error creating candidates: %v", err)
+	}
 
-	// Commit the transaction
-	return tx.Commit().Error
+	fmt.Printf("Total candidates: %v\n", len(candidates))
+	if err := linkCandidates(tx, contests[0].ElectionID); err != nil {
+		return err
+	}
+	return linkParties(tx, contests[0].ElectionID)
 }
 
 // Creates an update entry in the database and then creates a VoteTally entry for
@@ -95,19 +189,18 @@ func (db *DB) UpdateVoteTallies(data []GenericVoteRecord, hash string, timestamp
 	if slices.ContainsFunc(data, func(entry GenericVoteRecord) bool { return entry.JurisdictionType != data[0].JurisdictionType }) {
 		return fmt.Errorf("error, found inconsistent jurisdiction types while updating vote tallies")
 	}
-	// Start a transaction
-	tx := db.Begin()
-	if tx.Error != nil {
-		return tx.Error
-	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return updateVoteTallies(tx, data, jType, hash, timestamp, election)
+	})
+}
 
-	// Ensure rollback if panic occurs
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			panic(r) // re-throw panic after Rollback
-		}
-	}()
+func updateVoteTallies(tx *gorm.DB, data []GenericVoteRecord, jType JurisdictionType, hash string, timestamp time.Time, election Election) error {
+	data, countyRecords := splitCountyRecords(data)
+	// Only store the contests that changed since the previous update
+	data, err := newUpdateRecords(tx, data, jType, timestamp, election)
+	if err != nil {
+		return err
+	}
 
 	// Create a new Update record
 	update := &Update{
@@ -117,27 +210,23 @@ func (db *DB) UpdateVoteTallies(data []GenericVoteRecord, hash string, timestamp
 		ElectionID:       election.ID,
 	}
 	if err := tx.Create(update).Error; err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	// Preload existing contests and candidates
+	// Preload this election's contests and candidates
 	var contests []Contest
 	var candidates []BallotResponse
-	if err := tx.Find(&contests).Error; err != nil {
-		tx.Rollback()
+	if err := tx.Where("election_id = ?", election.ID).Find(&contests).Error; err != nil {
 		return err
 	}
-	if err := tx.Find(&candidates).Error; err != nil {
-		tx.Rollback()
+	if err := tx.Where("election_id = ?", election.ID).Find(&candidates).Error; err != nil {
 		return err
 	}
 
 	// Create maps for quick lookups
 	contestMap := make(map[string]Contest)
 	for _, c := range contests {
-		key := getContestKey(c.BallotTitle, c.District)
-		contestMap[key] = c
+		contestMap[c.ContestKey] = c
 	}
 
 	candidateMap := make(map[string]uint)
@@ -151,13 +240,11 @@ func (db *DB) UpdateVoteTallies(data []GenericVoteRecord, hash string, timestamp
 		contestKey := getContestKey(record.BallotTitle, record.DistrictName)
 		contest, contestExists := contestMap[contestKey]
 		if !contestExists {
-			tx.Rollback()
 			return fmt.Errorf("contest not found: %s", contestKey)
 		}
 		candidateKey := getCandidateKey(contest.ID, record.BallotResponse)
 		ballotResponseID, candidateExists := candidateMap[candidateKey]
 		if !candidateExists {
-			tx.Rollback()
 			return fmt.Errorf("candidate not found: %s", candidateKey)
 		}
 		// Create vote tally
@@ -167,11 +254,16 @@ func (db *DB) UpdateVoteTallies(data []GenericVoteRecord, hash string, timestamp
 			Votes:            record.Votes,
 			VotePercentage:   record.VotePercentage,
 			ContestID:        contest.ID,
+			BallotsCounted:   record.BallotsCounted,
+			RegisteredVoters: record.RegisteredVoters,
 		}
 
 		if !slices.Contains(contest.Jurisdictions, string(jType)) {
 			contest.Jurisdictions = append(contest.Jurisdictions, string(jType))
-			db.Model(&contest).Update("Jurisdictions", contest.Jurisdictions)
+			if err := tx.Model(&contest).Update("Jurisdictions", contest.Jurisdictions).Error; err != nil {
+				return fmt.Errorf("error updating jurisdictions for %s: %v", contestKey, err)
+			}
+			contestMap[contestKey] = contest
 		}
 
 		voteTallies = append(voteTallies, voteTally)
@@ -180,53 +272,90 @@ func (db *DB) UpdateVoteTallies(data []GenericVoteRecord, hash string, timestamp
 	if len(voteTallies) > 0 {
 		fmt.Printf("Loading %v vote tallies for %v\n", len(voteTallies), jType)
 		if err := tx.CreateInBatches(voteTallies, 100).Error; err != nil {
-			tx.Rollback()
 			return fmt.Errorf("error creating vote tallies: %v", err)
 		}
 	}
-
-	return tx.Commit().Error
-}
-
-func (db *DB) UpdateHashExists(hash string) (bool, Update) {
-	var update Update
-	result := db.Where("hash = ?", hash).First(&update)
-	return result.Error == nil, update
+	if err := storeCountyTallies(tx, update.ID, countyRecords, contestMap, candidateMap); err != nil {
+		return err
+	}
+	return refreshUpdateResults(tx, jType, update.ID)
 }
 
-func (db *DB) DeleteUpdate(update Update) {
-	db.Delete(&update)
+// Loads the contests, candidates and vote tallies of a new update. PostgreSQL
+// uses the COPY based BulkLoadUpdate, other databases go through gorm.
+// Precinct results only add precinct tallies to existing contests.
+func (db *DB) LoadUpdate(data []GenericVoteRecord, hash string, timestamp time.Time, election Election) error {
+	if len(data) > 0 && data[0].JurisdictionType == PrecinctJurisdiction {
+		return db.loadPrecinctUpdate(data, hash, timestamp, election)
+	}
+	if db.Dialector.Name() == "postgres" {
+		return db.BulkLoadUpdate(data, hash, timestamp, election)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		txDB := &DB{DB: tx}
+		if err := txDB.LoadBallotResponses(data, election); err != nil {
+			return err
+		}
+		return txDB.UpdateVoteTallies(data, hash, timestamp, election)
+	})
 }
 
-// Checks the hash and publishes a new update if the has doesn't exist yet
-func (db *DB) CheckAndProcessUpdate(data []GenericVoteRecord, hash string, jurisdictionType JurisdictionType, election Election) error {
+// Finds an election's update by the hash of its file, returning nil if the
+// file hasn't been loaded.
+func (db *DB) FindUpdate(hash string, election Election) (*Update, error) {
 	var update Update
-	// Check to see if the update already exists
-	result := db.Where("hash = ?", hash).First(&update)
-	if result.Error == gorm.ErrRecordNotFound {
-		log.Printf("New %s update detected", jurisdictionType)
-		if err := db.UpdateVoteTallies(data, hash, time.Now(), election); err != nil {
-			return fmt.Errorf("error updating %s data: %v", jurisdictionType, err)
-		}
-	} else if result.Error != nil {
-		return fmt.Errorf("error querying %s update: %v", jurisdictionType, result.Error)
-	} else {
-		log.Printf("No change in %s data", jurisdictionType)
+	err := db.Where("election_id = ? AND hash = ?", election.ID, hash).First(&update).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error querying update %s: %v", hash, err)
 	}
+	return &update, nil
+}
 
-	return nil
+// Permanently deletes an update and its vote tallies, recomputing the
+// results of the contests it covered.
+func (db *DB) DeleteUpdate(update Update) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := carryForwardTallies(tx, update); err != nil {
+			return err
+		}
+		// Soft delete first so the refresh no longer sees the update while its
+		// tallies still identify the affected contests
+		if err := tx.Delete(&update).Error; err != nil {
+			return fmt.Errorf("error deleting update %v: %v", update.ID, err)
+		}
+		if err := refreshUpdateResults(tx, update.JurisdictionType, update.ID); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&update).Error; err != nil {
+			return fmt.Errorf("error deleting update %v: %v", update.ID, err)
+		}
+		return nil
+	})
 }
 
-func (db *DB) GetElection() (*Election, error) {
-	electionName := os.Getenv("ELECTION_NAME")
-	electionDate, err := time.Parse("2006-01-02", os.Getenv("ELECTION_DATE"))
-	if err != nil {
-		return nil, fmt.Errorf("error parsing ELECTION_DATE %s: %v", os.Getenv("ELECTION_DATE"), err)
+// Builds the contest_results table for databases created before it existed.
+func (db *DB) backfillContestResults() error {
+	var results, tallies int64
+	if err := db.Model(&ContestResult{}).Count(&results).Error; err != nil {
+		return fmt.Errorf("error counting contest results: %v", err)
 	}
-	election := &Election{
-		Name:         electionName,
-		ElectionDate: electionDate,
+	if err := db.Model(&VoteTally{}).Count(&tallies).Error; err != nil {
+		return fmt.Errorf("error counting vote tallies: %v", err)
 	}
-	db.FirstOrCreate(&election, election)
-	return election, nil
+	if results > 0 || tallies == 0 {
+		return nil
+	}
+	var elections []Election
+	if err := db.Find(&elections).Error; err != nil {
+		return fmt.Errorf("error listing elections: %v", err)
+	}
+	for _, election := range elections {
+		log.Printf("Computing contest results for %s", election.ID)
+		if err := db.RebuildContestResults(election); err != nil {
+			return err
+		}
+	}
+	return nil
 }
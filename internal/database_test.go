@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Opens a migrated SQLite database in a temporary directory.
+func openTestSQLite(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB("sqlite://" + filepath.Join(t.TempDir(), "elections.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := db.MigrateSchema(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNewDBSQLite(t *testing.T) {
+	db := openTestSQLite(t)
+	if name := db.Dialector.Name(); name != "sqlite" {
+		t.Errorf("dialector = %s, want sqlite", name)
+	}
+	var foreignKeys int
+	if err := db.Raw("PRAGMA foreign_keys").Scan(&foreignKeys).Error; err != nil {
+		t.Fatal(err)
+	}
+	if foreignKeys != 1 {
+		t.Error("foreign keys are off, cascading deletes won't run")
+	}
+}
+
+func TestStringArray(t *testing.T) {
+	tests := []StringArray{
+		nil,
+		{},
+		{"State"},
+		{"State", "County"},
+		{"with, comma", `with "quotes"`, "with {braces}", ""},
+	}
+	for _, test := range tests {
+		value, err := test.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got StringArray
+		if err := got.Scan(value); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, test) {
+			t.Errorf("StringArray %q round trips to %q", test, got)
+		}
+	}
+}
+
+func TestSQLiteJurisdictions(t *testing.T) {
+	db := openTestSQLite(t)
+	election := createTestElection(t, db)
+	state := testRecord("Mayor", "Alice", 150)
+	state.JurisdictionType = StateJurisdiction
+	loadTestUpdate(t, db, election, "county", 1, testRecord("Mayor", "Alice", 140))
+	loadTestUpdate(t, db, election, "state", 2, state)
+
+	contest, err := db.FindContest(election.ID, getContestKey("Mayor", "King County"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (StringArray{"County", "State"}); !slices.Equal(contest.Jurisdictions, want) {
+		t.Errorf("jurisdictions = %q, want %q", contest.Jurisdictions, want)
+	}
+	var column string
+	if err := db.Raw("SELECT jurisdictions FROM contests WHERE id = ?", contest.ID).Scan(&column).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"County","State"}`; column != want {
+		t.Errorf("jurisdictions column = %s, want %s", column, want)
+	}
+}
+
+func TestSQLiteDeleteElectionCascades(t *testing.T) {
+	db := openTestSQLite(t)
+	election := createTestElection(t, db)
+	loadTestUpdate(t, db, election, "first", 1, testRecord("Mayor", "Alice", 150))
+	if err := db.DeleteElection(election.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"contests", "ballot_responses", "updates", "vote_tallies", "contest_results"} {
+		var count int64
+		if err := db.Table(table).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%d rows left in %s", count, table)
+		}
+	}
+}
+
+func TestSQLiteMigrationsRunOnce(t *testing.T) {
+	db := openTestSQLite(t)
+	runs := 0
+	for range 2 {
+		if err := db.runOnce("test", func() error { runs++; return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("migration ran %d times, want 1", runs)
+	}
+	var count int64
+	if err := db.Model(&Migration{}).Where("name = ?", "backfill_candidates").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Error("backfill_candidates was not recorded as run")
+	}
+}
+
+func TestSQLiteBackfillElections(t *testing.T) {
+	db := openTestSQLite(t)
+	elections := []struct {
+		id       string
+		date     time.Time
+		wantType ElectionType
+	}{
+		{"2024_primary", time.Date(2024, time.August, 6, 0, 0, 0, 0, time.UTC), PrimaryElection},
+		{"nov2024", time.Date(2024, time.November, 5, 0, 0, 0, 0, time.UTC), GeneralElection},
+		{"aug2023", time.Date(2023, time.August, 1, 0, 0, 0, 0, time.UTC), PrimaryElection},
+		{"feb2024", time.Date(2024, time.February, 13, 0, 0, 0, 0, time.UTC), SpecialElection},
+	}
+	for _, election := range elections {
+		if err := db.CreateElection(&Election{ID: election.id, Name: election.id, ElectionDate: election.date, Type: GeneralElection}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Elections registered before they had a type or status
+	if err := db.Exec("UPDATE elections SET type = '', status = NULL").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MigrateSchema(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range elections {
+		election, err := db.FindElection(want.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if election.Type != want.wantType || election.Status != ActiveElection {
+			t.Errorf("%s: type %q status %q, want %q active", want.id, election.Type, election.Status, want.wantType)
+		}
+	}
+}
+
+func TestSQLiteRepairIdentities(t *testing.T) {
+	db := openTestSQLite(t)
+	// A database from before contests and candidates had unique keys
+	if err := db.Migrator().DropIndex(&Contest{}, "idx_contest_election_key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrator().DropIndex(&BallotResponse{}, "idx_ballot_response_contest_name"); err != nil {
+		t.Fatal(err)
+	}
+	general := createTestElection(t, db)
+	previous := Election{ID: "2023_general", Name: "2023 General", ElectionDate: testElectionDate.AddDate(-1, 0, 0), Type: GeneralElection}
+	if err := db.CreateElection(&previous); err != nil {
+		t.Fatal(err)
+	}
+	create := func(value any) {
+		t.Helper()
+		if err := db.Omit(clause.Associations).Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := getContestKey("Mayor", "King County")
+	mayor := Contest{BallotTitle: "Mayor", District: "King County", ContestKey: key, ElectionID: general.ID}
+	duplicate := mayor
+	create(&mayor)
+	create(&duplicate)
+	deleted := Contest{BallotTitle: "Mayor", District: "King County", ContestKey: key, ElectionID: general.ID}
+	create(&deleted)
+	if err := db.Delete(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	oldMayor := Contest{BallotTitle: "Mayor", District: "King County", ContestKey: key, ElectionID: previous.ID}
+	create(&oldMayor)
+
+	alice := BallotResponse{Name: "Alice", ContestID: mayor.ID, ElectionID: general.ID}
+	aliceAgain := BallotResponse{Name: "Alice", ContestID: duplicate.ID, ElectionID: general.ID}
+	oldBob := BallotResponse{Name: "Bob", ContestID: oldMayor.ID, ElectionID: previous.ID}
+	create(&alice)
+	create(&aliceAgain)
+	create(&oldBob)
+
+	first := Update{Hash: "first", Timestamp: testElectionDate.Add(time.Hour), JurisdictionType: CountyJurisdiction, ElectionID: general.ID}
+	oldUpdate := Update{Hash: "old", Timestamp: testElectionDate.AddDate(-1, 0, 0), JurisdictionType: CountyJurisdiction, ElectionID: previous.ID}
+	create(&first)
+	create(&oldUpdate)
+	create(&VoteTally{UpdateID: first.ID, ContestID: duplicate.ID, BallotResponseID: aliceAgain.ID, Votes: 150})
+	// Matched to the 2023 contest by title, the bug the unique keys fix
+	create(&VoteTally{UpdateID: first.ID, ContestID: oldMayor.ID, BallotResponseID: oldBob.ID, Votes: 90})
+	create(&VoteTally{UpdateID: oldUpdate.ID, ContestID: oldMayor.ID, BallotResponseID: oldBob.ID, Votes: 70})
+
+	if err := db.MigrateSchema(); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []struct {
+		model any
+		name  string
+	}{{&Contest{}, "idx_contest_election_key"}, {&BallotResponse{}, "idx_ballot_response_contest_name"}} {
+		if !db.Migrator().HasIndex(index.model, index.name) {
+			t.Errorf("%s was not created", index.name)
+		}
+	}
+	var contests int64
+	if err := db.Unscoped().Model(&Contest{}).Where("election_id = ?", general.ID).Count(&contests).Error; err != nil {
+		t.Fatal(err)
+	}
+	if contests != 1 {
+		t.Errorf("%d Mayor contests left in %s, want 1", contests, general.ID)
+	}
+	if got, want := currentVotes(t, db, general, "Mayor"), map[string]int{"Alice": 150, "Bob": 90}; !maps.Equal(got, want) {
+		t.Errorf("%s votes = %v, want %v", general.ID, got, want)
+	}
+	if got, want := currentVotes(t, db, previous, "Mayor"), map[string]int{"Bob": 70}; !maps.Equal(got, want) {
+		t.Errorf("%s votes = %v, want %v", previous.ID, got, want)
+	}
+}
+
+func TestSQLiteUpsertRestoresSoftDeleted(t *testing.T) {
+	db := openTestSQLite(t)
+	election := createTestElection(t, db)
+	loadTestUpdate(t, db, election, "first", 1, testRecord("Mayor", "Alice", 150))
+	if err := db.Where("election_id = ?", election.ID).Delete(&Contest{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("election_id = ?", election.ID).Delete(&BallotResponse{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	loadTestUpdate(t, db, election, "second", 2, testRecord("Mayor", "Alice", 200))
+	if got, want := currentVotes(t, db, election, "Mayor"), map[string]int{"Alice": 200}; !maps.Equal(got, want) {
+		t.Errorf("votes = %v, want %v", got, want)
+	}
+}
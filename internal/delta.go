@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Updates only store tallies for the contests whose numbers changed since the
+// previous update from the same jurisdiction. The full results as of an update
+// are the latest tally of every candidate at or before it, see Snapshot.
+
+// The numbers stored for a candidate in a tally. The contest's ballots counted
+// and registered voters are repeated on every candidate.
+type tallyNumbers struct {
+	Votes            int
+	BallotsCounted   int
+	RegisteredVoters int
+}
+
+// Numbers of each candidate, keyed by contest key and then candidate name.
+type contestVotes map[string]map[string]tallyNumbers
+
+func votesFromTallies(tallies []VoteTally) contestVotes {
+	votes := make(contestVotes)
+	for _, tally := range tallies {
+		key := tally.Contest.ContestKey
+		if votes[key] == nil {
+			votes[key] = make(map[string]tallyNumbers)
+		}
+		votes[key][tally.BallotResponse.Name] = tallyNumbers{tally.Votes, tally.BallotsCounted, tally.RegisteredVoters}
+	}
+	return votes
+}
+
+func votesFromRecords(records []GenericVoteRecord) contestVotes {
+	votes := make(contestVotes)
+	for _, record := range records {
+		key := getContestKey(record.BallotTitle, record.DistrictName)
+		if votes[key] == nil {
+			votes[key] = make(map[string]tallyNumbers)
+		}
+		votes[key][record.BallotResponse] = tallyNumbers{record.Votes, record.BallotsCounted, record.RegisteredVoters}
+	}
+	return votes
+}
+
+// Returns the records of the contests whose votes, ballots counted or
+// registered voters differ from previous, including contests that gained or
+// lost a candidate.
+func changedRecords(records []GenericVoteRecord, previous contestVotes) []GenericVoteRecord {
+	current := votesFromRecords(records)
+	changed := make(map[string]bool)
+	for key, votes := range current {
+		changed[key] = !maps.Equal(votes, previous[key])
+	}
+	var ret []GenericVoteRecord
+	for _, record := range records {
+		if changed[getContestKey(record.BallotTitle, record.DistrictName)] {
+			ret = append(ret, record)
+		}
+	}
+	if skipped := len(records) - len(ret); skipped > 0 {
+		log.Printf("Skipping %v tallies in unchanged contests", skipped)
+	}
+	return ret
+}
+
+// Returns the IDs of tallies that repeat the numbers already in effect for
+// their contest, given tallies with their Update loaded. Used to convert data
+// loaded before delta storage.
+func redundantTallies(tallies []VoteTally) []uint {
+	slices.SortFunc(tallies, func(a, b VoteTally) int {
+		if c := a.Update.Timestamp.Compare(b.Update.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.UpdateID, b.UpdateID)
+	})
+	type contestUpdate struct {
+		jType     JurisdictionType
+		contestID uint
+		updateID  uint
+	}
+	// Group the tallies into one set per contest per update, in update order
+	var order []contestUpdate
+	groups := make(map[contestUpdate][]VoteTally)
+	for _, tally := range tallies {
+		key := contestUpdate{tally.Update.JurisdictionType, tally.ContestID, tally.UpdateID}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], tally)
+	}
+
+	type jurisdictionContest struct {
+		jType     JurisdictionType
+		contestID uint
+	}
+	current := make(map[jurisdictionContest]map[uint]tallyNumbers)
+	var redundant []uint
+	for _, key := range order {
+		votes := make(map[uint]tallyNumbers)
+		for _, tally := range groups[key] {
+			votes[tally.BallotResponseID] = tallyNumbers{tally.Votes, tally.BallotsCounted, tally.RegisteredVoters}
+		}
+		ck := jurisdictionContest{key.jType, key.contestID}
+		if previous, ok := current[ck]; ok && maps.Equal(previous, votes) {
+			for _, tally := range groups[key] {
+				redundant = append(redundant, tally.ID)
+			}
+			continue
+		}
+		current[ck] = votes
+	}
+	return redundant
+}
+
+// Selects the latest tally of each candidate from the updates of one
+// jurisdiction at or before a point in time, ties broken by update ID.
+const snapshotSQL = `id IN (
+	SELECT id FROM (
+		SELECT t.id, ROW_NUMBER() OVER (PARTITION BY t.ballot_response_id ORDER BY u."timestamp" DESC, u.id DESC) AS n
+		FROM vote_tallies t
+		JOIN updates u ON u.id = t.update_id
+		WHERE u.election_id = ? AND u.jurisdiction_type = ? AND u.deleted_at IS NULL AND u.retracted_at IS NULL AND t.deleted_at IS NULL
+		AND (u."timestamp" < ? OR (u."timestamp" = ? AND u.id <= ?))
+	) latest
+	WHERE n = 1
+)`
+
+func snapshotAsOf(tx *gorm.DB, electionID string, jType JurisdictionType, timestamp time.Time, updateID uint) ([]VoteTally, error) {
+	var tallies []VoteTally
+	if err := tx.Where(snapshotSQL, electionID, jType, timestamp, timestamp, updateID).
+		Preload("Contest").
+		Preload("BallotResponse").
+		Preload("Update").
+		Find(&tallies).Error; err != nil {
+		return nil, fmt.Errorf("error fetching %s results as of %v: %v", jType, timestamp, err)
+	}
+	return tallies, nil
+}
+
+// Returns the full results of an update's jurisdiction as of that update: the
+// latest tally of every candidate, whichever update it was recorded in.
+func (db *DB) Snapshot(update Update) ([]VoteTally, error) {
+	return snapshotAsOf(db.DB, update.ElectionID, update.JurisdictionType, update.Timestamp, update.ID)
+}
+
+// Returns the tallies that a new update would need to store.
+func newUpdateRecords(tx *gorm.DB, data []GenericVoteRecord, jType JurisdictionType, timestamp time.Time, election Election) ([]GenericVoteRecord, error) {
+	previous, err := snapshotAsOf(tx, election.ID, jType, timestamp, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	return changedRecords(data, votesFromTallies(previous)), nil
+}
+
+// Returns the next visible update from the same jurisdiction as update, nil if
+// there is none.
+func nextVisibleUpdate(tx *gorm.DB, update Update) (*Update, error) {
+	var next Update
+	err := tx.Where("election_id = ? AND jurisdiction_type = ? AND id <> ? AND retracted_at IS NULL", update.ElectionID, update.JurisdictionType, update.ID).
+		Where(`("timestamp" > ? OR ("timestamp" = ? AND id > ?))`, update.Timestamp, update.Timestamp, update.ID).
+		Order(`"timestamp", id`).
+		First(&next).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error finding the update after %v: %v", update.ID, err)
+	}
+	return &next, nil
+}
+
+// Copies an update's tallies into the next visible update from the same
+// jurisdiction for the contests that update didn't store, so that removing or
+// retracting the update doesn't change the results of the updates after it.
+func carryForwardTallies(tx *gorm.DB, update Update) error {
+	next, err := nextVisibleUpdate(tx, update)
+	if next == nil {
+		return err
+	}
+	now := time.Now()
+	if err := tx.Exec(`
+		INSERT INTO vote_tallies (created_at, updated_at, ballot_response_id, update_id, contest_id, votes, vote_percentage, ballots_counted, registered_voters)
+		SELECT ?, ?, ballot_response_id, ?, contest_id, votes, vote_percentage, ballots_counted, registered_voters
+		FROM vote_tallies
+		WHERE update_id = ? AND deleted_at IS NULL
+		AND contest_id NOT IN (SELECT contest_id FROM vote_tallies WHERE update_id = ?)`,
+		now, now, next.ID, update.ID, next.ID).Error; err != nil {
+		return fmt.Errorf("error carrying tallies from update %v to %v: %v", update.ID, next.ID, err)
+	}
+	return nil
+}
+
+// Stores the tallies in effect just before the next visible update into it,
+// for the contests a retracted update covers and the next update didn't
+// store, so that restoring the retracted update doesn't change the results of
+// the updates after it. Runs before the update is restored.
+func pinNextUpdateTallies(tx *gorm.DB, update Update) error {
+	next, err := nextVisibleUpdate(tx, update)
+	if next == nil {
+		return err
+	}
+	var covered, stored []uint
+	if err := tx.Model(&VoteTally{}).Where("update_id = ?", update.ID).Distinct().Pluck("contest_id", &covered).Error; err != nil {
+		return fmt.Errorf("error fetching the contests of update %v: %v", update.ID, err)
+	}
+	if err := tx.Model(&VoteTally{}).Where("update_id = ?", next.ID).Distinct().Pluck("contest_id", &stored).Error; err != nil {
+		return fmt.Errorf("error fetching the contests of update %v: %v", next.ID, err)
+	}
+	previous, err := snapshotAsOf(tx, update.ElectionID, update.JurisdictionType, next.Timestamp, next.ID)
+	if err != nil {
+		return err
+	}
+	var pinned []VoteTally
+	for _, tally := range previous {
+		if slices.Contains(covered, tally.ContestID) && !slices.Contains(stored, tally.ContestID) {
+			pinned = append(pinned, VoteTally{
+				BallotResponseID: tally.BallotResponseID,
+				UpdateID:         next.ID,
+				ContestID:        tally.ContestID,
+				Votes:            tally.Votes,
+				VotePercentage:   tally.VotePercentage,
+				BallotsCounted:   tally.BallotsCounted,
+				RegisteredVoters: tally.RegisteredVoters,
+			})
+		}
+	}
+	if len(pinned) == 0 {
+		return nil
+	}
+	if err := tx.Omit(clause.Associations).CreateInBatches(pinned, 100).Error; err != nil {
+		return fmt.Errorf("error storing the tallies of update %v: %v", next.ID, err)
+	}
+	return nil
+}
+
+// Converts an election's existing data to delta storage by deleting tallies
+// that repeat the previous visible update's numbers, then rebuilds its
+// results. Retracted updates are left alone, since results skip them. Returns
+// the number of tallies removed.
+func (db *DB) CompactElection(election Election) (int, error) {
+	var tallies []VoteTally
+	if err := db.Where("update_id IN (?)", db.Model(&Update{}).Select("id").Where("election_id = ? AND retracted_at IS NULL", election.ID)).
+		Preload("Update").
+		Find(&tallies).Error; err != nil {
+		return 0, fmt.Errorf("error fetching tallies for %s: %v", election.ID, err)
+	}
+	redundant := redundantTallies(tallies)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for batch := range slices.Chunk(redundant, 1000) {
+			if err := tx.Unscoped().Where("id IN ?", batch).Delete(&VoteTally{}).Error; err != nil {
+				return fmt.Errorf("error deleting redundant tallies: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(redundant), db.RebuildContestResults(election)
+}
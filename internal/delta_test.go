@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestCompactElectionSkipsRetractedUpdates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		loadTestUpdate(t, store, election, "a", 1, testRecord("Mayor", "Alice", 150))
+		retracted := loadTestUpdate(t, store, election, "r", 2, testRecord("Mayor", "Alice", 999))
+		if err := store.RetractUpdate(retracted, "test", "wrong file"); err != nil {
+			t.Fatal(err)
+		}
+		loadTestUpdate(t, store, election, "n", 3, testRecord("Mayor", "Alice", 999))
+
+		if _, err := store.CompactElection(election); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := currentVotes(t, store, election, "Mayor"), map[string]int{"Alice": 999}; !maps.Equal(got, want) {
+			t.Errorf("votes after compacting = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestChangedRecords(t *testing.T) {
+	previous := votesFromRecords([]GenericVoteRecord{
+		{BallotTitle: "Mayor", DistrictName: "King County", BallotResponse: "Alice", Votes: 150, BallotsCounted: 300, RegisteredVoters: 1000},
+	})
+	tests := []struct {
+		name    string
+		record  GenericVoteRecord
+		changed bool
+	}{
+		{"unchanged", GenericVoteRecord{Votes: 150, BallotsCounted: 300, RegisteredVoters: 1000}, false},
+		{"votes", GenericVoteRecord{Votes: 151, BallotsCounted: 300, RegisteredVoters: 1000}, true},
+		{"ballots counted", GenericVoteRecord{Votes: 150, BallotsCounted: 310, RegisteredVoters: 1000}, true},
+		{"registered voters", GenericVoteRecord{Votes: 150, BallotsCounted: 300, RegisteredVoters: 1010}, true},
+	}
+	for _, test := range tests {
+		record := test.record
+		record.BallotTitle, record.DistrictName, record.BallotResponse = "Mayor", "King County", "Alice"
+		if changed := len(changedRecords([]GenericVoteRecord{record}, previous)) > 0; changed != test.changed {
+			t.Errorf("%s: changed = %v, want %v", test.name, changed, test.changed)
+		}
+	}
+}
+
+func TestRedundantTallies(t *testing.T) {
+	updates := []Update{
+		{Model: gorm.Model{ID: 1}, Timestamp: testElectionDate},
+		{Model: gorm.Model{ID: 2}, Timestamp: testElectionDate.Add(time.Hour)},
+		{Model: gorm.Model{ID: 3}, Timestamp: testElectionDate.Add(2 * time.Hour)},
+	}
+	tally := func(id uint, update Update, votes int, ballots int) VoteTally {
+		return VoteTally{Model: gorm.Model{ID: id}, UpdateID: update.ID, Update: update, ContestID: 1, BallotResponseID: 1, Votes: votes, BallotsCounted: ballots}
+	}
+	tallies := []VoteTally{
+		tally(10, updates[0], 150, 300),
+		tally(11, updates[1], 150, 310),
+		tally(12, updates[2], 150, 310),
+	}
+	if got, want := redundantTallies(tallies), []uint{12}; !slices.Equal(got, want) {
+		t.Errorf("redundant = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,359 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DistrictType string
+
+const (
+	FederalDistrict     DistrictType = "Federal"
+	StateDistrict       DistrictType = "State"
+	JudicialDistrict    DistrictType = "Judicial"
+	LegislativeDistrict DistrictType = "Legislative"
+	CountyDistrict      DistrictType = "County"
+	CityDistrict        DistrictType = "City"
+	SchoolDistrict      DistrictType = "School"
+	FireDistrict        DistrictType = "Fire"
+	// Ports, hospitals, parks, water and sewer districts and the like
+	SpecialDistrict DistrictType = "Special"
+	OtherDistrict   DistrictType = "Other"
+)
+
+// District types in the order the election page lists them.
+var DistrictTypes = []DistrictType{
+	FederalDistrict, StateDistrict, JudicialDistrict, LegislativeDistrict, CountyDistrict,
+	CityDistrict, SchoolDistrict, FireDistrict, SpecialDistrict, OtherDistrict,
+}
+
+func ParseDistrictType(s string) (DistrictType, error) {
+	for _, t := range DistrictTypes {
+		if strings.EqualFold(s, string(t)) {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown district type %q", s)
+}
+
+// District is the area a contest is decided in. Districts are shared across
+// elections and matched to contests by name, which is the contest's
+// District. Parent is the larger district it is part of, such as the county
+// of a county council district.
+type District struct {
+	gorm.Model
+	Name     string `gorm:"uniqueIndex"`
+	Type     DistrictType
+	ParentID *uint     `gorm:"index"`
+	Parent   *District `gorm:"constraint:OnDelete:SET NULL"`
+}
+
+// Words that place a district in a type, checked in order against the start
+// of each word of the source file's heading for it and then of its name.
+var districtTypeWords = []struct {
+	Type  DistrictType
+	Words []string
+}{
+	{FederalDistrict, []string{"federal", "congress", "president", "united"}},
+	{JudicialDistrict, []string{"judic", "court", "judge", "justice"}},
+	{LegislativeDistrict, []string{"legislat"}},
+	{SchoolDistrict, []string{"school"}},
+	{FireDistrict, []string{"fire"}},
+	{SpecialDistrict, []string{"port", "hospital", "water", "sewer", "park", "library", "transit", "cemetery", "utility", "flood", "drainage", "irrigation"}},
+	{CountyDistrict, []string{"county", "counties"}},
+	{CityDistrict, []string{"city", "cities", "town"}},
+	{StateDistrict, []string{"state", "washington"}},
+	{SpecialDistrict, []string{"district"}},
+}
+
+func districtTypeOf(s string) DistrictType {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !('a' <= r && r <= 'z')
+	})
+	for _, candidate := range districtTypeWords {
+		for _, word := range words {
+			if slices.ContainsFunc(candidate.Words, func(prefix string) bool { return strings.HasPrefix(word, prefix) }) {
+				return candidate.Type
+			}
+		}
+	}
+	return OtherDistrict
+}
+
+// Returns the type of a district from the heading the source file lists it
+// under (the county's District Type, or the state's JurisdictionName), or
+// from its name when the heading doesn't say.
+func ClassifyDistrict(heading string, name string) DistrictType {
+	if t := districtTypeOf(heading); t != OtherDistrict {
+		return t
+	}
+	return districtTypeOf(name)
+}
+
+// The state's JurisdictionName is the kind of race in the statewide results
+// and the county in the per-county results, which says nothing of the
+// district.
+func stateDistrictHeading(jurisdictionName string) string {
+	if countyName(jurisdictionName) != "" {
+		return ""
+	}
+	return strings.TrimSpace(jurisdictionName)
+}
+
+// Parts of a district's name that mark it as a division of the district
+// named before them.
+var subdistrictPattern = regexp.MustCompile(`(?i),?\s+(council district|director district|commissioner district|(commissioner )?position|ward)\b`)
+
+// Returns the name of the district a district is part of, or "". Divisions
+// like "King County Council District 5" belong to the district named before
+// them, and federal, state and legislative districts to the United States or
+// Washington as the state's results name them.
+func districtParentName(name string, t DistrictType) string {
+	if loc := subdistrictPattern.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		return strings.TrimSpace(name[:loc[0]])
+	}
+	switch t {
+	case FederalDistrict:
+		if name != "Federal" {
+			return "Federal"
+		}
+	case StateDistrict, LegislativeDistrict:
+		if name != "State of Washington" {
+			return "State of Washington"
+		}
+	}
+	return ""
+}
+
+// A district found in an update's records, with the name of its parent.
+type districtSpec struct {
+	District
+	ParentName string
+}
+
+// Returns the districts of the records and their parents, ordered by name.
+// Parents that no contest is in take the type of their name, or of the
+// district they were found through.
+func recordDistricts(records []GenericVoteRecord) []districtSpec {
+	headings := make(map[string]string)
+	for _, record := range records {
+		if record.DistrictName == "" {
+			continue
+		}
+		if _, ok := headings[record.DistrictName]; !ok || headings[record.DistrictName] == "" {
+			headings[record.DistrictName] = record.DistrictHeading
+		}
+	}
+	specs := make(map[string]districtSpec)
+	var add func(name string, t DistrictType)
+	add = func(name string, t DistrictType) {
+		if _, ok := specs[name]; ok {
+			return
+		}
+		parent := districtParentName(name, t)
+		specs[name] = districtSpec{District: District{Name: name, Type: t}, ParentName: parent}
+		if parent != "" {
+			parentType := ClassifyDistrict("", parent)
+			if parentType == OtherDistrict {
+				parentType = t
+			}
+			add(parent, parentType)
+		}
+	}
+	for name, heading := range headings {
+		add(name, ClassifyDistrict(heading, name))
+	}
+	result := make([]districtSpec, 0, len(specs))
+	for _, spec := range specs {
+		result = append(result, spec)
+	}
+	slices.SortFunc(result, func(a, b districtSpec) int { return cmp.Compare(a.Name, b.Name) })
+	return result
+}
+
+// Creates the districts of an update's records that don't exist yet and links
+// them to their parents. Districts that were already typed or given a parent,
+// whether by an earlier load or by hand, are left as they are.
+func storeDistricts(tx *gorm.DB, records []GenericVoteRecord) error {
+	specs := recordDistricts(records)
+	if len(specs) == 0 {
+		return nil
+	}
+	districts := make([]District, len(specs))
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		districts[i] = spec.District
+		names[i] = spec.Name
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: "districts", Name: "type"}, Value: OtherDistrict}}},
+	}).CreateInBatches(&districts, 500).Error; err != nil {
+		return fmt.Errorf("error creating districts: %v", err)
+	}
+
+	var stored []District
+	if err := tx.Where("name IN ?", names).Find(&stored).Error; err != nil {
+		return fmt.Errorf("error fetching districts: %v", err)
+	}
+	byName := make(map[string]District)
+	for _, district := range stored {
+		byName[district.Name] = district
+	}
+	for _, spec := range specs {
+		district, parent := byName[spec.Name], byName[spec.ParentName]
+		if spec.ParentName == "" || district.ParentID != nil || parent.ID == 0 || parent.ID == district.ID {
+			continue
+		}
+		if err := tx.Model(&District{}).Where("id = ?", district.ID).Update("parent_id", parent.ID).Error; err != nil {
+			return fmt.Errorf("error linking district %s to %s: %v", spec.Name, spec.ParentName, err)
+		}
+	}
+	return nil
+}
+
+// Creates districts for contests loaded before districts were stored.
+func (db *DB) backfillDistricts() error {
+	var names []string
+	if err := db.Model(&Contest{}).Where("district NOT IN (?)", db.Model(&District{}).Select("name")).Distinct().Pluck("district", &names).Error; err != nil {
+		return fmt.Errorf("error finding contests without districts: %v", err)
+	}
+	records := make([]GenericVoteRecord, len(names))
+	for i, name := range names {
+		records[i] = GenericVoteRecord{DistrictName: name}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		return storeDistricts(tx, records)
+	})
+}
+
+// Returns every district ordered by name.
+func (db *DB) ListDistricts() ([]District, error) {
+	var districts []District
+	if err := db.Order("name").Find(&districts).Error; err != nil {
+		return nil, fmt.Errorf("error fetching districts: %v", err)
+	}
+	return districts, nil
+}
+
+func (db *DB) SetDistrictType(name string, t DistrictType) error {
+	result := db.Model(&District{}).Where("name = ?", name).Update("type", t)
+	if result.Error != nil {
+		return fmt.Errorf("error updating district %s: %v", name, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("district %s not found", name)
+	}
+	return nil
+}
+
+// Sets the district a district is part of, or clears it when parent is "".
+func (db *DB) SetDistrictParent(name string, parent string) error {
+	var parentID *uint
+	if parent != "" {
+		if parent == name {
+			return fmt.Errorf("a district can't be its own parent")
+		}
+		var p District
+		if err := db.Where("name = ?", parent).First(&p).Error; err != nil {
+			return fmt.Errorf("district %s not found", parent)
+		}
+		parentID = &p.ID
+	}
+	result := db.Model(&District{}).Where("name = ?", name).Update("parent_id", parentID)
+	if result.Error != nil {
+		return fmt.Errorf("error updating district %s: %v", name, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("district %s not found", name)
+	}
+	return nil
+}
+
+// DistrictSection is the contests of an election in districts of one type.
+type DistrictSection struct {
+	Type   DistrictType
+	Groups []DistrictGroup
+}
+
+// DistrictGroup is the contests of a district and of the districts within it
+// of the same type, such as a county and its council districts.
+type DistrictGroup struct {
+	District District
+	Contests []Contest
+}
+
+// Groups contests into sections by the type of their district, in the order
+// of DistrictTypes, and within them by the outermost district of the same
+// type. Contests whose district isn't stored yet are classified by name.
+func GroupContestsByDistrict(contests []Contest, districts []District) []DistrictSection {
+	byName := make(map[string]District)
+	byID := make(map[uint]District)
+	for _, district := range districts {
+		byName[district.Name] = district
+		byID[district.ID] = district
+	}
+	groups := make(map[DistrictType]map[string]*DistrictGroup)
+	for _, contest := range contests {
+		district, ok := byName[contest.District]
+		if !ok {
+			district = District{Name: contest.District, Type: ClassifyDistrict("", contest.District)}
+		}
+		root := district
+		seen := map[uint]bool{root.ID: true}
+		for root.ParentID != nil {
+			parent, ok := byID[*root.ParentID]
+			if !ok || parent.Type != district.Type || seen[parent.ID] {
+				break
+			}
+			seen[parent.ID] = true
+			root = parent
+		}
+		if groups[district.Type] == nil {
+			groups[district.Type] = make(map[string]*DistrictGroup)
+		}
+		group, ok := groups[district.Type][root.Name]
+		if !ok {
+			group = &DistrictGroup{District: root}
+			groups[district.Type][root.Name] = group
+		}
+		group.Contests = append(group.Contests, contest)
+	}
+
+	var sections []DistrictSection
+	for _, t := range DistrictTypes {
+		if len(groups[t]) == 0 {
+			continue
+		}
+		section := DistrictSection{Type: t}
+		for _, group := range groups[t] {
+			slices.SortFunc(group.Contests, func(a, b Contest) int {
+				return cmp.Or(compareNatural(a.District, b.District), compareNatural(a.BallotTitle, b.BallotTitle))
+			})
+			section.Groups = append(section.Groups, *group)
+		}
+		slices.SortFunc(section.Groups, func(a, b DistrictGroup) int { return compareNatural(a.District.Name, b.District.Name) })
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// Compares strings with the numbers in them compared by value, so that
+// District 2 comes before District 10.
+func compareNatural(a string, b string) int {
+	pad := func(s string) string {
+		return digitsPattern.ReplaceAllStringFunc(strings.ToLower(s), func(digits string) string {
+			return fmt.Sprintf("%012s", digits)
+		})
+	}
+	return cmp.Or(cmp.Compare(pad(a), pad(b)), cmp.Compare(a, b))
+}
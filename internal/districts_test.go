@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestClassifyDistrict(t *testing.T) {
+	tests := []struct {
+		heading string
+		name    string
+		want    DistrictType
+	}{
+		{"", "King County", CountyDistrict},
+		{"", "City of Seattle", CityDistrict},
+		{"", "Town of Skykomish", CityDistrict},
+		{"", "Seattle School District 1", SchoolDistrict},
+		{"", "Fire District 10", FireDistrict},
+		{"", "Port of Seattle", SpecialDistrict},
+		{"", "Water District 90", SpecialDistrict},
+		{"", "Sound Transit", SpecialDistrict},
+		{"", "Legislative District 43", LegislativeDistrict},
+		{"", "Congressional District 9", FederalDistrict},
+		{"", "State of Washington", StateDistrict},
+		{"", "King County Superior Court", JudicialDistrict},
+		{"", "Skyway Improvement District", SpecialDistrict},
+		{"", "Skyway", OtherDistrict},
+		{"", "", OtherDistrict},
+		{"City", "Skyway", CityDistrict},
+		{"School", "King County", SchoolDistrict},
+		{"Unknown Heading", "King County", CountyDistrict},
+		{"", "KING COUNTY", CountyDistrict},
+	}
+	for _, test := range tests {
+		if got := ClassifyDistrict(test.heading, test.name); got != test.want {
+			t.Errorf("ClassifyDistrict(%q, %q) = %s, want %s", test.heading, test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseDistrictType(t *testing.T) {
+	if got, err := ParseDistrictType("school"); err != nil || got != SchoolDistrict {
+		t.Errorf("ParseDistrictType(school) = %q, %v", got, err)
+	}
+	if _, err := ParseDistrictType("tribal"); err == nil {
+		t.Error("ParseDistrictType accepted tribal")
+	}
+}
+
+func TestDistrictParentName(t *testing.T) {
+	tests := []struct {
+		name string
+		t    DistrictType
+		want string
+	}{
+		{"King County Council District 5", CountyDistrict, "King County"},
+		{"Seattle School District 1, Director District 3", SchoolDistrict, "Seattle School District 1"},
+		{"Port of Seattle Commissioner Position 2", SpecialDistrict, "Port of Seattle"},
+		{"City of Kent Ward 3", CityDistrict, "City of Kent"},
+		{"Congressional District 9", FederalDistrict, "Federal"},
+		{"Federal", FederalDistrict, ""},
+		{"Legislative District 43", LegislativeDistrict, "State of Washington"},
+		{"State of Washington", StateDistrict, ""},
+		{"King County", CountyDistrict, ""},
+		{"Ward 3", CityDistrict, ""},
+		{"", OtherDistrict, ""},
+	}
+	for _, test := range tests {
+		if got := districtParentName(test.name, test.t); got != test.want {
+			t.Errorf("districtParentName(%q, %s) = %q, want %q", test.name, test.t, got, test.want)
+		}
+	}
+}
+
+func TestRecordDistricts(t *testing.T) {
+	records := []GenericVoteRecord{
+		{DistrictName: "King County Council District 5"},
+		{DistrictName: "Legislative District 43", DistrictHeading: ""},
+		{DistrictName: "Legislative District 43", DistrictHeading: "Legislative"},
+		{DistrictName: "Skyway Council District 2"},
+		{DistrictName: "Mystery", DistrictHeading: "City"},
+		{DistrictName: ""},
+	}
+	var got []string
+	for _, spec := range recordDistricts(records) {
+		got = append(got, fmt.Sprintf("%s (%s) in %q", spec.Name, spec.Type, spec.ParentName))
+	}
+	want := []string{
+		`King County (County) in ""`,
+		`King County Council District 5 (County) in "King County"`,
+		`Legislative District 43 (Legislative) in "State of Washington"`,
+		`Mystery (City) in ""`,
+		`Skyway (Special) in ""`,
+		`Skyway Council District 2 (Special) in "Skyway"`,
+		`State of Washington (State) in ""`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("recordDistricts =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestGroupContestsByDistrict(t *testing.T) {
+	district := func(id uint, name string, t DistrictType, parentID uint) District {
+		d := District{Name: name, Type: t}
+		d.ID = id
+		if parentID != 0 {
+			d.ParentID = &parentID
+		}
+		return d
+	}
+	districts := []District{
+		district(1, "King County", CountyDistrict, 0),
+		district(2, "King County Council District 5", CountyDistrict, 1),
+		district(3, "City of Seattle", CityDistrict, 0),
+		district(4, "City of Seattle Council District 10", CityDistrict, 3),
+		district(5, "City of Seattle Council District 2", CityDistrict, 3),
+		// Part of the city but a different type, so grouped on its own
+		district(6, "Seattle School District 1", SchoolDistrict, 3),
+		// Parents that point at each other
+		district(7, "Port A", SpecialDistrict, 8),
+		district(8, "Port B", SpecialDistrict, 7),
+		// Parent missing from the list
+		district(9, "Orphan Fire District", FireDistrict, 99),
+	}
+	contests := []Contest{
+		{BallotTitle: "Council", District: "City of Seattle Council District 10"},
+		{BallotTitle: "Council", District: "City of Seattle Council District 2"},
+		{BallotTitle: "Mayor", District: "City of Seattle"},
+		{BallotTitle: "Executive", District: "King County"},
+		{BallotTitle: "Council", District: "King County Council District 5"},
+		{BallotTitle: "Director", District: "Seattle School District 1"},
+		{BallotTitle: "Commissioner", District: "Port A"},
+		{BallotTitle: "Commissioner", District: "Port B"},
+		{BallotTitle: "Commissioner", District: "Orphan Fire District"},
+		// Not stored yet, so typed by name
+		{BallotTitle: "Commissioner", District: "Fire District 10"},
+		{BallotTitle: "Question", District: "Somewhere"},
+		{BallotTitle: "Question", District: ""},
+	}
+
+	var got []string
+	total := 0
+	for _, section := range GroupContestsByDistrict(contests, districts) {
+		for _, group := range section.Groups {
+			line := fmt.Sprintf("%s/%s:", section.Type, group.District.Name)
+			for _, contest := range group.Contests {
+				line += " " + contest.District + " " + contest.BallotTitle + ";"
+				total++
+			}
+			got = append(got, line)
+		}
+	}
+	if total != len(contests) {
+		t.Errorf("grouped %d contests, want %d", total, len(contests))
+	}
+	want := []string{
+		"County/King County: King County Executive; King County Council District 5 Council;",
+		"City/City of Seattle: City of Seattle Mayor; City of Seattle Council District 2 Council; City of Seattle Council District 10 Council;",
+		"School/Seattle School District 1: Seattle School District 1 Director;",
+		"Fire/Fire District 10: Fire District 10 Commissioner;",
+		"Fire/Orphan Fire District: Orphan Fire District Commissioner;",
+		"Special/Port A: Port B Commissioner;",
+		"Special/Port B: Port A Commissioner;",
+		"Other/:  Question;",
+		"Other/Somewhere: Somewhere Question;",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("GroupContestsByDistrict =\n%v\nwant\n%v", got, want)
+	}
+	if sections := GroupContestsByDistrict(nil, districts); len(sections) != 0 {
+		t.Errorf("GroupContestsByDistrict(nil) = %v, want no sections", sections)
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	names := []string{"District 10", "district 2", "District 1", "District 2", "District"}
+	slices.SortFunc(names, compareNatural)
+	if want := []string{"District", "District 1", "District 2", "district 2", "District 10"}; !slices.Equal(names, want) {
+		t.Errorf("sorted = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// First path segments of the web application's own routes, which election
+// pages under /{slug}/ would clash with.
+var reservedSlugs = []string{"admin", "api", "candidate", "graphql", "health", "search", "static"}
+
+func validateSlug(slug string) error {
+	if !slugPattern.MatchString(slug) {
+		return fmt.Errorf("invalid election slug %q: use lowercase letters, numbers, - and _", slug)
+	}
+	if slices.Contains(reservedSlugs, slug) {
+		return fmt.Errorf("election slug %q is reserved by the web application", slug)
+	}
+	return nil
+}
+
+func ParseElectionType(s string) (ElectionType, error) {
+	switch t := ElectionType(s); t {
+	case PrimaryElection, GeneralElection, SpecialElection:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown election type %q (expected primary, general or special)", s)
+}
+
+// Guesses the type of an election registered before elections had one, from
+// its slug (2024_primary) or else its date: WA holds primaries in August and
+// general elections in November, so anything else is a special election.
+func inferElectionType(election Election) ElectionType {
+	slug := strings.ToLower(election.ID)
+	for _, t := range []ElectionType{PrimaryElection, GeneralElection, SpecialElection} {
+		if strings.Contains(slug, string(t)) {
+			return t
+		}
+	}
+	switch election.ElectionDate.Month() {
+	case time.August:
+		return PrimaryElection
+	case time.November:
+		return GeneralElection
+	}
+	return SpecialElection
+}
+
+// Sets the type and status of elections registered before they had them.
+func (db *DB) backfillElections() error {
+	var elections []Election
+	if err := db.Where("type = '' OR type IS NULL").Find(&elections).Error; err != nil {
+		return fmt.Errorf("error finding elections without a type: %v", err)
+	}
+	for _, election := range elections {
+		if err := db.Model(&election).Update("type", inferElectionType(election)).Error; err != nil {
+			return fmt.Errorf("error setting the type of %s: %v", election.ID, err)
+		}
+	}
+	if err := db.Model(&Election{}).Where("status = '' OR status IS NULL").Update("status", ActiveElection).Error; err != nil {
+		return fmt.Errorf("error backfilling election status: %v", err)
+	}
+	return nil
+}
+
+// Registers a new election. The slug must be unused, including by deleted
+// or archived elections.
+func (db *DB) CreateElection(election *Election) error {
+	if err := validateSlug(election.ID); err != nil {
+		return err
+	}
+	if _, err := ParseElectionType(string(election.Type)); err != nil {
+		return err
+	}
+	if err := validateTurnout(election.ExpectedTurnout); err != nil {
+		return err
+	}
+	if err := validateTopTwo(election.Type, election.TopTwo); err != nil {
+		return err
+	}
+	if election.Status == "" {
+		election.Status = ActiveElection
+	}
+	var count int64
+	if err := db.Unscoped().Model(&Election{}).Where("id = ?", election.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("error checking for election %s: %v", election.ID, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("election %s already exists", election.ID)
+	}
+	if err := db.Create(election).Error; err != nil {
+		return fmt.Errorf("error creating election %s: %v", election.ID, err)
+	}
+	return nil
+}
+
+// Looks up a registered election by slug.
+func (db *DB) FindElection(slug string) (*Election, error) {
+	var election Election
+	err := db.Where("id = ?", slug).First(&election).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("election %s is not registered", slug)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching election %s: %v", slug, err)
+	}
+	return &election, nil
+}
+
+// Lists elections, newest first. Archived elections are only included when
+// includeArchived is set.
+func (db *DB) ListElections(includeArchived bool) ([]Election, error) {
+	var elections []Election
+	query := db.Order("election_date DESC")
+	if !includeArchived {
+		query = query.Where("status <> ?", ArchivedElection)
+	}
+	if err := query.Find(&elections).Error; err != nil {
+		return nil, fmt.Errorf("error listing elections: %v", err)
+	}
+	return elections, nil
+}
+
+func (db *DB) RenameElection(slug string, name string) error {
+	return db.updateElection(slug, "name", name)
+}
+
+func (db *DB) SetElectionStatus(slug string, status ElectionStatus) error {
+	return db.updateElection(slug, "status", status)
+}
+
+func (db *DB) SetExpectedTurnout(slug string, percent float64) error {
+	if err := validateTurnout(percent); err != nil {
+		return err
+	}
+	return db.updateElection(slug, "expected_turnout", percent)
+}
+
+// Marks an election as a top-two primary or not. Only primaries can be.
+func (db *DB) SetTopTwo(slug string, topTwo bool) error {
+	election, err := db.FindElection(slug)
+	if err != nil {
+		return err
+	}
+	if err := validateTopTwo(election.Type, topTwo); err != nil {
+		return err
+	}
+	return db.updateElection(slug, "top_two", topTwo)
+}
+
+func (db *DB) CertifyElection(slug string, at *time.Time) error {
+	return db.updateElection(slug, "certified_at", at)
+}
+
+func validateTopTwo(electionType ElectionType, topTwo bool) error {
+	if topTwo && electionType != PrimaryElection {
+		return fmt.Errorf("only primaries can be top-two, this is a %s election", electionType)
+	}
+	return nil
+}
+
+func validateTurnout(percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("expected turnout must be between 0 and 100, got %v", percent)
+	}
+	return nil
+}
+
+func (db *DB) updateElection(slug string, column string, value any) error {
+	result := db.Model(&Election{}).Where("id = ?", slug).Update(column, value)
+	if result.Error != nil {
+		return fmt.Errorf("error updating election %s: %v", slug, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("election %s is not registered", slug)
+	}
+	return nil
+}
+
+// Permanently deletes an election along with its contests, candidates,
+// updates and vote tallies.
+func (db *DB) DeleteElection(slug string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("id = ?", slug).Delete(&Election{})
+		if result.Error != nil {
+			return fmt.Errorf("error deleting election %s: %v", slug, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("election %s is not registered", slug)
+		}
+		return deleteOrphanedCandidates(tx)
+	})
+}
+
+// Removes all contests, candidates and updates for an election while keeping
+// the election itself registered.
+func (db *DB) ClearElectionResults(election Election) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("election_id = ?", election.ID).Delete(&ContestResult{}).Error; err != nil {
+			return fmt.Errorf("error clearing contest results for %s: %v", election.ID, err)
+		}
+		if err := tx.Unscoped().Where("update_id IN (?)", tx.Model(&Update{}).Select("id").Where("election_id = ?", election.ID)).Delete(&VoteTally{}).Error; err != nil {
+			return fmt.Errorf("error clearing vote tallies for %s: %v", election.ID, err)
+		}
+		if err := tx.Where("update_id IN (?)", tx.Model(&Update{}).Select("id").Where("election_id = ?", election.ID)).Delete(&CountyTally{}).Error; err != nil {
+			return fmt.Errorf("error clearing county tallies for %s: %v", election.ID, err)
+		}
+		if err := tx.Where("update_id IN (?)", tx.Model(&Update{}).Select("id").Where("election_id = ?", election.ID)).Delete(&PrecinctTally{}).Error; err != nil {
+			return fmt.Errorf("error clearing precinct tallies for %s: %v", election.ID, err)
+		}
+		if err := tx.Unscoped().Where("election_id = ?", election.ID).Delete(&Update{}).Error; err != nil {
+			return fmt.Errorf("error clearing updates for %s: %v", election.ID, err)
+		}
+		if err := tx.Unscoped().Where("election_id = ?", election.ID).Delete(&BallotResponse{}).Error; err != nil {
+			return fmt.Errorf("error clearing candidates for %s: %v", election.ID, err)
+		}
+		if err := tx.Unscoped().Where("election_id = ?", election.ID).Delete(&Contest{}).Error; err != nil {
+			return fmt.Errorf("error clearing contests for %s: %v", election.ID, err)
+		}
+		return deleteOrphanedCandidates(tx)
+	})
+}
@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IngestOutcome string
+
+const (
+	NewUpdateOutcome IngestOutcome = "new_update"
+	UnchangedOutcome IngestOutcome = "unchanged"
+	FailedOutcome    IngestOutcome = "failed"
+)
+
+// IngestRun records one attempt by the scraper or importer at fetching,
+// parsing and loading a results file.
+type IngestRun struct {
+	gorm.Model
+	Source           string
+	ElectionID       string `gorm:"index"`
+	JurisdictionType JurisdictionType
+	StartedAt        time.Time `gorm:"index"`
+	FinishedAt       time.Time
+	// Zero for files read from disk
+	HTTPStatus int
+	Bytes      int64
+	Hash       string
+	Outcome    IngestOutcome `gorm:"index"`
+	// Number of parsed rows and the contests they cover
+	Rows     int
+	Contests int
+	// The update created by the run, if any
+	UpdateID *uint
+	Error    string
+	Warnings StringArray
+	// Contests within a recount margin after a new update
+	Recounts StringArray
+	// Number of attempts the run stands for. Unchanged and failed runs that
+	// repeat the source's previous run are counted on it instead of adding a
+	// row, LastSeenAt being when the latest of them finished.
+	Attempts   int `gorm:"default:1"`
+	LastSeenAt time.Time
+}
+
+// Narrows down ListIngestRuns. Zero values match everything, Limit defaults
+// to 100.
+type IngestRunFilter struct {
+	ElectionID string
+	Outcome    IngestOutcome
+	Limit      int
+}
+
+func (f IngestRunFilter) limit() int {
+	if f.Limit <= 0 {
+		return 100
+	}
+	return f.Limit
+}
+
+func (run IngestRun) Duration() time.Duration {
+	return run.FinishedAt.Sub(run.StartedAt)
+}
+
+// Reports whether run repeats previous, the source's latest run: neither
+// loaded an update and both ended the same way with the same file.
+func (run IngestRun) repeats(previous IngestRun) bool {
+	return run.Outcome != NewUpdateOutcome && previous.Outcome == run.Outcome &&
+		previous.Hash == run.Hash && previous.Error == run.Error && previous.HTTPStatus == run.HTTPStatus
+}
+
+// Records a run, or counts it on the source's previous run when it repeats
+// it, in which case run is set to that one.
+func (db *DB) RecordIngestRun(run *IngestRun) error {
+	run.Attempts = 1
+	run.LastSeenAt = run.FinishedAt
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var previous IngestRun
+		if err := tx.Where("source = ? AND election_id = ? AND jurisdiction_type = ?", run.Source, run.ElectionID, run.JurisdictionType).
+			Order("started_at DESC, id DESC").
+			Limit(1).
+			Find(&previous).Error; err != nil {
+			return err
+		}
+		if previous.ID == 0 || !run.repeats(previous) {
+			return tx.Create(run).Error
+		}
+		if err := tx.Model(&previous).Updates(map[string]any{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"last_seen_at": run.FinishedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.First(run, previous.ID).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error recording ingest run for %s: %v", run.Source, err)
+	}
+	return nil
+}
+
+// Permanently deletes the unchanged and failed runs last seen before a time,
+// returning how many were deleted. Runs that loaded an update are kept.
+func (db *DB) PruneIngestRuns(before time.Time) (int, error) {
+	result := db.Unscoped().Where("outcome <> ? AND last_seen_at < ?", NewUpdateOutcome, before).Delete(&IngestRun{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("error pruning ingest runs: %v", result.Error)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// Sets when runs recorded before repeats were collapsed were last seen.
+func (db *DB) backfillIngestRuns() error {
+	if err := db.Model(&IngestRun{}).Where("last_seen_at IS NULL").Update("last_seen_at", gorm.Expr("finished_at")).Error; err != nil {
+		return fmt.Errorf("error backfilling ingest runs: %v", err)
+	}
+	return nil
+}
+
+// Lists ingest runs, most recent first.
+func (db *DB) ListIngestRuns(filter IngestRunFilter) ([]IngestRun, error) {
+	query := db.Order("started_at DESC, id DESC").Limit(filter.limit())
+	if filter.ElectionID != "" {
+		query = query.Where("election_id = ?", filter.ElectionID)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	var runs []IngestRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("error listing ingest runs: %v", err)
+	}
+	return runs, nil
+}
+
+func (db *DB) GetIngestRun(id uint) (*IngestRun, error) {
+	var run IngestRun
+	err := db.First(&run, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("ingest run %v not found", id)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching ingest run %v: %v", id, err)
+	}
+	return &run, nil
+}
+
+// Counts the bytes read through it.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Starts an ingest run for a source, to be passed to Ingest.
+func NewIngestRun(source string, jType JurisdictionType, election Election) *IngestRun {
+	return &IngestRun{
+		Source:           source,
+		ElectionID:       election.ID,
+		JurisdictionType: jType,
+		StartedAt:        time.Now(),
+	}
+}
+
+// Loads parsed records as a new update and returns it, or returns nil if the
+// file doesn't need loading.
+type UpdateLoader func(data []GenericVoteRecord, hash string) (*Update, error)
+
+// Returns a loader that skips files whose hash was already loaded for the
+// election. The update's timestamp is taken when it is loaded.
+func LoadNewUpdate(store Store, election Election, timestamp func() time.Time) UpdateLoader {
+	return func(data []GenericVoteRecord, hash string) (*Update, error) {
+		jType := data[0].JurisdictionType
+		update, err := store.FindUpdate(hash, election)
+		if err != nil {
+			return nil, fmt.Errorf("error querying %s update: %v", jType, err)
+		}
+		if update != nil {
+			log.Printf("No change in %s data", jType)
+			return nil, nil
+		}
+
+		log.Printf("New %s update detected", jType)
+		if err := store.LoadUpdate(data, hash, timestamp(), election); err != nil {
+			return nil, fmt.Errorf("error updating %s data: %v", jType, err)
+		}
+		return store.FindUpdate(hash, election)
+	}
+}
+
+// Downloads and loads a results file, recording the attempt as an IngestRun.
+func IngestURL(store Store, url string, jType JurisdictionType, election Election) error {
+	run := NewIngestRun(url, jType, election)
+	open := func() (io.ReadCloser, error) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		run.HTTPStatus = resp.StatusCode
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		}
+		return resp.Body, nil
+	}
+	return Ingest(store, run, open, LoadNewUpdate(store, election, time.Now))
+}
+
+// Parses the file returned by open and passes it to load, then records the run
+// whatever the outcome.
+func Ingest(store Store, run *IngestRun, open func() (io.ReadCloser, error), load UpdateLoader) error {
+	err := ingest(run, open, load)
+	if err != nil {
+		run.Outcome = FailedOutcome
+		run.Error = err.Error()
+	} else if run.Outcome == NewUpdateOutcome {
+		summarizeRecounts(store, run)
+	}
+	run.FinishedAt = time.Now()
+	if recordErr := store.RecordIngestRun(run); recordErr != nil {
+		log.Printf("Failed to record ingest run: %v", recordErr)
+	}
+	return err
+}
+
+func ingest(run *IngestRun, open func() (io.ReadCloser, error), load UpdateLoader) error {
+	reader, err := open()
+	if err != nil {
+		return fmt.Errorf("error fetching %s data: %v", run.JurisdictionType, err)
+	}
+	body := &countingReader{ReadCloser: reader}
+	defer body.Close()
+	data, hash, err := Parse(body, run.JurisdictionType)
+	run.Bytes = body.n
+	if err != nil {
+		return fmt.Errorf("error parsing %s data: %v", run.JurisdictionType, err)
+	}
+	run.Hash = hash
+	run.Rows = len(data)
+	run.Contests = len(votesFromRecords(data))
+	run.Warnings = validateRecords(data)
+	if len(data) == 0 {
+		return fmt.Errorf("no %s data to process", run.JurisdictionType)
+	}
+
+	update, err := load(data, hash)
+	if err != nil {
+		return err
+	}
+	if update == nil {
+		run.Outcome = UnchangedOutcome
+		return nil
+	}
+	run.Outcome = NewUpdateOutcome
+	run.UpdateID = &update.ID
+	return nil
+}
+
+// Lists the election's contests that are within a recount margin after the
+// run's update, using the rules in RECOUNT_RULES.
+func summarizeRecounts(store Store, run *IngestRun) {
+	rules, err := RecountRulesFromEnv()
+	if err != nil {
+		run.Warnings = append(run.Warnings, err.Error())
+		return
+	}
+	election, err := store.FindElection(run.ElectionID)
+	if err != nil {
+		run.Warnings = append(run.Warnings, fmt.Sprintf("error checking recount margins: %v", err))
+		return
+	}
+	results, err := store.ElectionResults(run.ElectionID)
+	if err != nil {
+		run.Warnings = append(run.Warnings, fmt.Sprintf("error checking recount margins: %v", err))
+		return
+	}
+	for _, race := range CloseRaces(results, rules, election.TopTwo) {
+		log.Printf("Within recount margin: %s", race)
+		run.Recounts = append(run.Recounts, race.String())
+	}
+}
+
+// Returns warnings about records that look wrong but don't stop the file
+// from loading.
+func validateRecords(records []GenericVoteRecord) []string {
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, record := range records {
+		warn := func(format string, args ...any) {
+			warning := fmt.Sprintf(format, args...)
+			if record.Row > 0 {
+				warning = fmt.Sprintf("row %d: %s", record.Row, warning)
+			}
+			warnings = append(warnings, warning)
+		}
+		if record.BallotTitle == "" {
+			warn("missing ballot title")
+		}
+		if record.BallotResponse == "" {
+			warn("missing ballot response in %s", record.BallotTitle)
+		}
+		if record.Votes < 0 {
+			warn("negative votes for %s", record.BallotResponse)
+		}
+		key := getContestKey(record.BallotTitle, record.DistrictName) + "\x00" + record.BallotResponse + "\x00" + record.County + "\x00" + record.Precinct.Name
+		if seen[key] {
+			warn("%s is listed more than once in %s", record.BallotResponse, record.BallotTitle)
+		}
+		seen[key] = true
+	}
+	return warnings
+}
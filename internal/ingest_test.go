@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testStateCSV = `Race,Candidate,Party,Votes,PercentageOfTotalVotes,JurisdictionName
+Mayor,Alice,(Prefers Democratic Party),150,60,King
+Mayor,Bob,(Prefers Republican Party),100,40,King
+`
+
+func TestIngestCollapsesRepeatedRuns(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		file := func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(testStateCSV)), nil }
+		unreachable := func() (io.ReadCloser, error) { return nil, errors.New("connection refused") }
+		load := LoadNewUpdate(store, election, time.Now)
+		ingest := func(open func() (io.ReadCloser, error)) {
+			Ingest(store, NewIngestRun("https://example.com/state.csv", StateJurisdiction, election), open, load)
+		}
+
+		ingest(file)
+		for range 3 {
+			ingest(file)
+		}
+		for range 2 {
+			ingest(unreachable)
+		}
+		ingest(file)
+
+		runs, err := store.ListIngestRuns(IngestRunFilter{ElectionID: election.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Most recent first
+		want := []struct {
+			outcome  IngestOutcome
+			attempts int
+		}{
+			{UnchangedOutcome, 1},
+			{FailedOutcome, 2},
+			{UnchangedOutcome, 3},
+			{NewUpdateOutcome, 1},
+		}
+		if len(runs) != len(want) {
+			t.Fatalf("got %d runs, want %d", len(runs), len(want))
+		}
+		for i, run := range runs {
+			if run.Outcome != want[i].outcome || run.Attempts != want[i].attempts {
+				t.Errorf("run %d = %s x%d, want %s x%d", i, run.Outcome, run.Attempts, want[i].outcome, want[i].attempts)
+			}
+			if run.LastSeenAt.Before(run.FinishedAt) {
+				t.Errorf("run %d last seen at %v, before it finished at %v", i, run.LastSeenAt, run.FinishedAt)
+			}
+		}
+
+		pruned, err := store.PruneIngestRuns(time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pruned != 3 {
+			t.Errorf("pruned %d runs, want 3", pruned)
+		}
+		runs, err = store.ListIngestRuns(IngestRunFilter{ElectionID: election.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != 1 || runs[0].Outcome != NewUpdateOutcome {
+			t.Errorf("runs after pruning = %v, want the new update's run", runs)
+		}
+	})
+}
+
+func TestValidateRecordRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		jType JurisdictionType
+		csv   string
+		want  []string
+	}{
+		{
+			"state",
+			StateJurisdiction,
+			`Race,Candidate,Party,Votes,PercentageOfTotalVotes,JurisdictionName
+Mayor,Alice,,150,60,King
+Mayor,Bob,,-1,0,King
+Mayor,Alice,,150,60,King
+`,
+			[]string{"row 3: negative votes for Bob", "row 4: Alice is listed more than once in Mayor"},
+		},
+		{
+			// Counter rows and rows for single ways of voting don't become
+			// records, so rows aren't the record's position in the file
+			"precinct",
+			PrecinctJurisdiction,
+			`Precinct,Race,LEG,CC,CG,CounterGroup,Party,CounterType,SumOfCount
+SEA 11-1234,Mayor,43,,,Total,,Registered Voters,500
+SEA 11-1234,Mayor,43,,,Total,,Times Counted,300
+SEA 11-1234,Mayor,43,,,Election Day,,Alice,10
+SEA 11-1234,Mayor,43,,,Total,,Alice,150
+SEA 11-1234,Mayor,43,,,Total,,Bob,-1
+`,
+			[]string{"row 6: negative votes for Bob"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, _, err := Parse(io.NopCloser(strings.NewReader(test.csv)), test.jType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := validateRecords(records); strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("warnings = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
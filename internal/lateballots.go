@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"cmp"
+	"slices"
+)
+
+// BallotDrop is what one county update added to a contest.
+type BallotDrop struct {
+	Update Update
+	// Ballots counted in the contest's district after the drop, and how many
+	// the drop added. 0 when the source file doesn't report them.
+	BallotsCounted   int
+	BallotsAdded     int
+	RegisteredVoters int
+	// Votes each candidate gained, keyed by ballot response ID
+	VotesAdded map[uint]int
+	TotalAdded int
+}
+
+// Returns the candidate's share of the votes in the drop, from 0 to 100.
+func (drop BallotDrop) Share(ballotResponseID uint) float64 {
+	if drop.TotalAdded <= 0 {
+		return 0
+	}
+	return float64(drop.VotesAdded[ballotResponseID]) * 100 / float64(drop.TotalAdded)
+}
+
+// Returns the county drops of a contest, oldest first, from its candidates
+// and their vote tallies. The first drop counts every vote as added.
+func BallotDrops(candidates []BallotResponse) []BallotDrop {
+	byUpdate := make(map[uint]*BallotDrop)
+	for _, candidate := range candidates {
+		for _, tally := range candidate.VoteTallies {
+			if tally.Update.JurisdictionType != CountyJurisdiction {
+				continue
+			}
+			drop, ok := byUpdate[tally.UpdateID]
+			if !ok {
+				drop = &BallotDrop{Update: tally.Update, VotesAdded: make(map[uint]int)}
+				byUpdate[tally.UpdateID] = drop
+			}
+			drop.BallotsCounted = max(drop.BallotsCounted, tally.BallotsCounted)
+			drop.RegisteredVoters = max(drop.RegisteredVoters, tally.RegisteredVoters)
+			drop.VotesAdded[candidate.ID] = tally.Votes
+		}
+	}
+	drops := make([]BallotDrop, 0, len(byUpdate))
+	for _, drop := range byUpdate {
+		drops = append(drops, *drop)
+	}
+	slices.SortFunc(drops, func(a, b BallotDrop) int {
+		return cmp.Or(a.Update.Timestamp.Compare(b.Update.Timestamp), cmp.Compare(a.Update.ID, b.Update.ID))
+	})
+
+	// VotesAdded holds running totals until here
+	previous := make(map[uint]int)
+	previousBallots := 0
+	for i := range drops {
+		drop := &drops[i]
+		for _, candidate := range candidates {
+			votes, ok := drop.VotesAdded[candidate.ID]
+			if !ok {
+				// The candidate has no tally in this update, so their total is unchanged
+				votes = previous[candidate.ID]
+			}
+			drop.VotesAdded[candidate.ID] = votes - previous[candidate.ID]
+			drop.TotalAdded += votes - previous[candidate.ID]
+			previous[candidate.ID] = votes
+		}
+		if drop.BallotsCounted > 0 {
+			drop.BallotsAdded = drop.BallotsCounted - previousBallots
+			previousBallots = drop.BallotsCounted
+		}
+	}
+	return drops
+}
+
+// LateBallotOutlook is what the trailing candidate needs from the ballots left
+// to count to overtake the leader, based on the latest county drop.
+type LateBallotOutlook struct {
+	Leader         BallotResponse
+	Trailer        BallotResponse
+	LeaderVotes    int
+	TrailerVotes   int
+	BallotsCounted int
+	// Estimated from the district's registered voters and the election's
+	// expected turnout
+	BallotsOutstanding int
+	// Votes the outstanding ballots are expected to hold for the two
+	// candidates, at the rate of the ballots counted so far
+	RemainingVotes int
+	// Share of the remaining votes between the two that the trailer needs,
+	// from 0 to 100. Over 100 means the lead can't be overcome.
+	NeededShare float64
+}
+
+// Reports whether the trailer can still overtake the leader.
+func (outlook LateBallotOutlook) Reachable() bool {
+	return outlook.NeededShare <= 100
+}
+
+// Estimates the ballots left to count after a drop from the district's
+// registered voters and the expected turnout. Returns 0 when either is unknown.
+func estimateOutstanding(drop BallotDrop, expectedTurnout float64) int {
+	if expectedTurnout <= 0 || drop.BallotsCounted <= 0 {
+		return 0
+	}
+	return max(0, int(float64(drop.RegisteredVoters)*expectedTurnout/100)-drop.BallotsCounted)
+}
+
+// Estimates the ballots left to count in a contest after its latest county
+// drop. ok is false when the county hasn't reported ballots counted or the
+// election has no expected turnout.
+func OutstandingBallots(candidates []BallotResponse, expectedTurnout float64) (outstanding int, ok bool) {
+	drops := BallotDrops(candidates)
+	if len(drops) == 0 || expectedTurnout <= 0 || drops[len(drops)-1].BallotsCounted <= 0 {
+		return 0, false
+	}
+	return estimateOutstanding(drops[len(drops)-1], expectedTurnout), true
+}
+
+// Returns each candidate's votes as of the last drop, keyed by ballot
+// response ID.
+func countedVotes(drops []BallotDrop) map[uint]int {
+	totals := make(map[uint]int)
+	for _, drop := range drops {
+		for id, votes := range drop.VotesAdded {
+			totals[id] += votes
+		}
+	}
+	return totals
+}
+
+// Returns the first and second place candidates by votes.
+func topTwo(candidates []BallotResponse, votes map[uint]int) (BallotResponse, BallotResponse) {
+	ranked := slices.Clone(candidates)
+	slices.SortStableFunc(ranked, func(a, b BallotResponse) int { return votes[b.ID] - votes[a.ID] })
+	return ranked[0], ranked[1]
+}
+
+// Works out what the second place candidate needs from the outstanding
+// ballots. Returns nil when it can't be estimated: the county hasn't reported
+// ballots counted, the election has no expected turnout, fewer than two
+// candidates have votes, or no ballots are left to count.
+func LateBallotNeeds(candidates []BallotResponse, expectedTurnout float64) *LateBallotOutlook {
+	if len(candidates) < 2 {
+		return nil
+	}
+	drops := BallotDrops(candidates)
+	if len(drops) == 0 {
+		return nil
+	}
+	latest := drops[len(drops)-1]
+	outstanding := estimateOutstanding(latest, expectedTurnout)
+	totals := countedVotes(drops)
+	leader, trailer := topTwo(candidates, totals)
+	if outstanding <= 0 || totals[trailer.ID] <= 0 {
+		return nil
+	}
+
+	outlook := &LateBallotOutlook{
+		Leader:             leader,
+		Trailer:            trailer,
+		LeaderVotes:        totals[leader.ID],
+		TrailerVotes:       totals[trailer.ID],
+		BallotsCounted:     latest.BallotsCounted,
+		BallotsOutstanding: outstanding,
+	}
+	perBallot := float64(outlook.LeaderVotes+outlook.TrailerVotes) / float64(latest.BallotsCounted)
+	outlook.RemainingVotes = int(float64(outstanding) * perBallot)
+	if outlook.RemainingVotes <= 0 {
+		return nil
+	}
+	// The trailer needs x of the remaining votes with
+	// trailer + x >= leader + (remaining - x)
+	margin := outlook.LeaderVotes - outlook.TrailerVotes
+	outlook.NeededShare = float64(outlook.RemainingVotes+margin) * 100 / float64(2*outlook.RemainingVotes)
+	return outlook
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLateBallotNeeds(t *testing.T) {
+	// Alice leads Bob 12000 to 8000 with 20000 of 100000 registered voters'
+	// ballots counted
+	drops := [][2]int{{6000, 4000}, {12000, 8000}}
+	unreported := projectionCandidates(drops...)
+	for i := range unreported {
+		for j := range unreported[i].VoteTallies {
+			unreported[i].VoteTallies[j].BallotsCounted = 0
+		}
+	}
+	tests := []struct {
+		name            string
+		candidates      []BallotResponse
+		expectedTurnout float64
+		outstanding     int
+		neededShare     float64
+		reachable       bool
+		none            bool
+	}{
+		{name: "reachable", candidates: projectionCandidates(drops...), expectedTurnout: 40, outstanding: 20000, neededShare: 60, reachable: true},
+		{name: "trailer can't catch up", candidates: projectionCandidates(drops...), expectedTurnout: 22, outstanding: 2000, neededShare: 150},
+		{name: "needs every vote", candidates: projectionCandidates(drops...), expectedTurnout: 24, outstanding: 4000, neededShare: 100, reachable: true},
+		{name: "count at the expected turnout", candidates: projectionCandidates(drops...), expectedTurnout: 20, none: true},
+		{name: "expected turnout below the count", candidates: projectionCandidates(drops...), expectedTurnout: 10, none: true},
+		{name: "no expected turnout", candidates: projectionCandidates(drops...), expectedTurnout: 0, none: true},
+		{name: "ballots counted not reported", candidates: unreported, expectedTurnout: 40, none: true},
+		{name: "trailer without votes", candidates: projectionCandidates([2]int{1000, 0}), expectedTurnout: 40, none: true},
+		{name: "one candidate", candidates: projectionCandidates(drops...)[:1], expectedTurnout: 40, none: true},
+		{name: "no tallies", candidates: []BallotResponse{{Name: "Alice"}, {Name: "Bob"}}, expectedTurnout: 40, none: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outlook := LateBallotNeeds(test.candidates, test.expectedTurnout)
+			if test.none {
+				if outlook != nil {
+					t.Errorf("LateBallotNeeds = %+v, want nil", outlook)
+				}
+				return
+			}
+			if outlook == nil {
+				t.Fatal("LateBallotNeeds = nil")
+			}
+			if outlook.Leader.Name != "Alice" || outlook.Trailer.Name != "Bob" {
+				t.Errorf("leader %s, trailer %s; want Alice and Bob", outlook.Leader.Name, outlook.Trailer.Name)
+			}
+			if math.IsNaN(outlook.NeededShare) || math.IsInf(outlook.NeededShare, 0) || outlook.NeededShare < 0 {
+				t.Errorf("NeededShare = %v", outlook.NeededShare)
+			}
+			if outlook.BallotsOutstanding != test.outstanding || outlook.NeededShare != test.neededShare || outlook.Reachable() != test.reachable {
+				t.Errorf("LateBallotNeeds = %d outstanding, %v%% needed, reachable %v; want %d, %v%%, %v",
+					outlook.BallotsOutstanding, outlook.NeededShare, outlook.Reachable(), test.outstanding, test.neededShare, test.reachable)
+			}
+		})
+	}
+}
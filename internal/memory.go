@@ -0,0 +1,1396 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in memory, for tests and for
+// running the pipeline without a database. Records are returned as copies.
+type MemoryStore struct {
+	mu         sync.Mutex
+	nextID     uint
+	elections  map[string]Election
+	contests   map[uint]Contest
+	candidates map[uint]BallotResponse
+	updates    map[uint]Update
+	tallies    map[uint]VoteTally
+	counties   map[uint]CountyTally
+	precincts  map[uint]Precinct
+	events     []UpdateEvent
+	runs       []IngestRun
+	people     map[uint]Candidate
+	// Keyed by contest, then by jurisdiction type
+	results map[uint]map[JurisdictionType][]ContestResult
+	// Keyed by update
+	precinctTallies map[uint][]PrecinctTally
+	boundaries      map[uint]Boundary
+	districts       map[uint]District
+	parties         map[uint]Party
+}
+
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		elections:  make(map[string]Election),
+		contests:   make(map[uint]Contest),
+		candidates: make(map[uint]BallotResponse),
+		updates:    make(map[uint]Update),
+		tallies:    make(map[uint]VoteTally),
+		counties:   make(map[uint]CountyTally),
+		precincts:  make(map[uint]Precinct),
+		people:     make(map[uint]Candidate),
+		results:    make(map[uint]map[JurisdictionType][]ContestResult),
+
+		precinctTallies: make(map[uint][]PrecinctTally),
+		boundaries:      make(map[uint]Boundary),
+		districts:       make(map[uint]District),
+		parties:         make(map[uint]Party),
+	}
+	now := time.Now()
+	for _, party := range defaultParties {
+		party.ID = m.newID()
+		party.CreatedAt, party.UpdatedAt = now, now
+		party.Aliases = slices.Clone(party.Aliases)
+		m.parties[party.ID] = party
+	}
+	return m
+}
+
+func (m *MemoryStore) MigrateSchema() error {
+	return nil
+}
+
+func (m *MemoryStore) newID() uint {
+	m.nextID++
+	return m.nextID
+}
+
+func (m *MemoryStore) CreateElection(election *Election) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := validateSlug(election.ID); err != nil {
+		return err
+	}
+	if _, err := ParseElectionType(string(election.Type)); err != nil {
+		return err
+	}
+	if err := validateTurnout(election.ExpectedTurnout); err != nil {
+		return err
+	}
+	if err := validateTopTwo(election.Type, election.TopTwo); err != nil {
+		return err
+	}
+	if _, exists := m.elections[election.ID]; exists {
+		return fmt.Errorf("election %s already exists", election.ID)
+	}
+	if election.Status == "" {
+		election.Status = ActiveElection
+	}
+	election.CreatedAt = time.Now()
+	election.UpdatedAt = election.CreatedAt
+	m.elections[election.ID] = *election
+	return nil
+}
+
+func (m *MemoryStore) FindElection(slug string) (*Election, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	election, ok := m.elections[slug]
+	if !ok {
+		return nil, fmt.Errorf("election %s is not registered", slug)
+	}
+	return &election, nil
+}
+
+func (m *MemoryStore) ListElections(includeArchived bool) ([]Election, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elections := []Election{}
+	for _, election := range m.elections {
+		if includeArchived || election.Status != ArchivedElection {
+			elections = append(elections, election)
+		}
+	}
+	slices.SortFunc(elections, func(a, b Election) int {
+		return b.ElectionDate.Compare(a.ElectionDate)
+	})
+	return elections, nil
+}
+
+func (m *MemoryStore) RenameElection(slug string, name string) error {
+	return m.updateElection(slug, func(e *Election) { e.Name = name })
+}
+
+func (m *MemoryStore) SetElectionStatus(slug string, status ElectionStatus) error {
+	return m.updateElection(slug, func(e *Election) { e.Status = status })
+}
+
+func (m *MemoryStore) SetExpectedTurnout(slug string, percent float64) error {
+	if err := validateTurnout(percent); err != nil {
+		return err
+	}
+	return m.updateElection(slug, func(e *Election) { e.ExpectedTurnout = percent })
+}
+
+func (m *MemoryStore) SetTopTwo(slug string, topTwo bool) error {
+	election, err := m.FindElection(slug)
+	if err != nil {
+		return err
+	}
+	if err := validateTopTwo(election.Type, topTwo); err != nil {
+		return err
+	}
+	return m.updateElection(slug, func(e *Election) { e.TopTwo = topTwo })
+}
+
+func (m *MemoryStore) CertifyElection(slug string, at *time.Time) error {
+	return m.updateElection(slug, func(e *Election) { e.CertifiedAt = at })
+}
+
+func (m *MemoryStore) updateElection(slug string, update func(*Election)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	election, ok := m.elections[slug]
+	if !ok {
+		return fmt.Errorf("election %s is not registered", slug)
+	}
+	update(&election)
+	election.UpdatedAt = time.Now()
+	m.elections[slug] = election
+	return nil
+}
+
+func (m *MemoryStore) DeleteElection(slug string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.elections[slug]; !ok {
+		return fmt.Errorf("election %s is not registered", slug)
+	}
+	m.clearElectionResults(slug)
+	m.runs = slices.DeleteFunc(m.runs, func(run IngestRun) bool { return run.ElectionID == slug })
+	for _, kind := range BoundaryKinds {
+		m.deleteBoundaries(slug, kind)
+	}
+	delete(m.elections, slug)
+	return nil
+}
+
+func (m *MemoryStore) ClearElectionResults(election Election) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clearElectionResults(election.ID)
+	return nil
+}
+
+func (m *MemoryStore) clearElectionResults(electionID string) {
+	for id, update := range m.updates {
+		if update.ElectionID == electionID {
+			m.deleteUpdate(id)
+		}
+	}
+	for id, candidate := range m.candidates {
+		if candidate.ElectionID == electionID {
+			delete(m.candidates, id)
+		}
+	}
+	for id, contest := range m.contests {
+		if contest.ElectionID == electionID {
+			delete(m.contests, id)
+			delete(m.results, id)
+		}
+	}
+	for id := range m.people {
+		if len(m.candidateResponses(id)) == 0 {
+			delete(m.people, id)
+		}
+	}
+}
+
+func (m *MemoryStore) ListContests(electionID string) ([]Contest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	contests := []Contest{}
+	for _, contest := range m.contests {
+		if contest.ElectionID == electionID {
+			contests = append(contests, m.withElection(contest))
+		}
+	}
+	slices.SortFunc(contests, func(a, b Contest) int { return cmp.Compare(a.ID, b.ID) })
+	return contests, nil
+}
+
+func (m *MemoryStore) FindContest(electionID string, contestKey string) (*Contest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	contest, ok := m.findContest(electionID, contestKey)
+	if !ok {
+		return nil, fmt.Errorf("contest %s not found in %s", contestKey, electionID)
+	}
+	contest = m.withElection(contest)
+	return &contest, nil
+}
+
+func (m *MemoryStore) findContest(electionID string, contestKey string) (Contest, bool) {
+	for _, contest := range m.contests {
+		if contest.ElectionID == electionID && contest.ContestKey == contestKey {
+			return contest, true
+		}
+	}
+	return Contest{}, false
+}
+
+func (m *MemoryStore) withElection(contest Contest) Contest {
+	contest.Election = m.elections[contest.ElectionID]
+	contest.Jurisdictions = slices.Clone(contest.Jurisdictions)
+	return contest
+}
+
+func (m *MemoryStore) ContestCandidates(contestID uint) ([]BallotResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	candidates := []BallotResponse{}
+	for _, candidate := range m.candidates {
+		if candidate.ContestID != contestID {
+			continue
+		}
+		candidate.VoteTallies = nil
+		for _, tally := range m.tallies {
+			if tally.BallotResponseID == candidate.ID && m.updates[tally.UpdateID].RetractedAt == nil {
+				tally.Update = m.updates[tally.UpdateID]
+				candidate.VoteTallies = append(candidate.VoteTallies, tally)
+			}
+		}
+		slices.SortFunc(candidate.VoteTallies, func(a, b VoteTally) int { return cmp.Compare(a.ID, b.ID) })
+		if candidate.CandidateID != nil {
+			person := m.people[*candidate.CandidateID]
+			candidate.Candidate = &person
+		}
+		candidates = append(candidates, m.withParty(candidate))
+	}
+	slices.SortFunc(candidates, func(a, b BallotResponse) int { return cmp.Compare(a.ID, b.ID) })
+	return candidates, nil
+}
+
+func (m *MemoryStore) CountyTallies(contestID uint) ([]CountyTally, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest *Update
+	for _, tally := range m.counties {
+		update := m.updates[tally.UpdateID]
+		if tally.ContestID != contestID || update.RetractedAt != nil {
+			continue
+		}
+		if latest == nil || !updateAtOrBefore(update, latest.Timestamp, latest.ID) {
+			latest = &update
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	var tallies []CountyTally
+	for _, tally := range m.counties {
+		if tally.ContestID == contestID && tally.UpdateID == latest.ID {
+			tallies = append(tallies, tally)
+		}
+	}
+	slices.SortFunc(tallies, func(a, b CountyTally) int {
+		return cmp.Or(cmp.Compare(a.County, b.County), cmp.Compare(a.ID, b.ID))
+	})
+	return tallies, nil
+}
+
+func (m *MemoryStore) loadPrecinctUpdate(data []GenericVoteRecord, hash string, timestamp time.Time, election Election) error {
+	now := time.Now()
+	precinctIDs := make(map[string]uint)
+	for _, precinct := range m.precincts {
+		precinctIDs[precinct.Name] = precinct.ID
+	}
+	for _, precinct := range distinctPrecincts(data) {
+		if id, ok := precinctIDs[precinct.Name]; ok {
+			precinct.ID, precinct.CreatedAt = id, m.precincts[id].CreatedAt
+		} else {
+			precinct.ID, precinct.CreatedAt = m.newID(), now
+			precinctIDs[precinct.Name] = precinct.ID
+		}
+		precinct.UpdatedAt = now
+		m.precincts[precinct.ID] = precinct
+	}
+
+	var contests []Contest
+	for _, contest := range m.contests {
+		if contest.ElectionID == election.ID {
+			contests = append(contests, contest)
+		}
+	}
+	var candidates []BallotResponse
+	for _, candidate := range m.candidates {
+		if candidate.ElectionID == election.ID {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	update := Update{
+		Timestamp:        timestamp,
+		Hash:             hash,
+		JurisdictionType: PrecinctJurisdiction,
+		ElectionID:       election.ID,
+	}
+	update.ID = m.newID()
+	update.CreatedAt, update.UpdatedAt = now, now
+	tallies, unmatched := precinctTallies(data, update.ID, contests, candidates, precinctIDs)
+	if len(tallies) == 0 {
+		return fmt.Errorf("no precinct results match the contests of %s", election.ID)
+	}
+	if len(unmatched) > 0 {
+		log.Printf("Skipped %v precinct races with no matching contest: %s", len(unmatched), strings.Join(unmatched, ", "))
+	}
+	for i := range tallies {
+		tallies[i].ID = m.newID()
+	}
+	m.updates[update.ID] = update
+	m.precinctTallies[update.ID] = tallies
+	return nil
+}
+
+func (m *MemoryStore) PrecinctTallies(contestID uint) ([]PrecinctTally, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest *Update
+	for updateID, tallies := range m.precinctTallies {
+		update := m.updates[updateID]
+		if update.RetractedAt != nil || !slices.ContainsFunc(tallies, func(t PrecinctTally) bool { return t.ContestID == contestID }) {
+			continue
+		}
+		if latest == nil || !updateAtOrBefore(update, latest.Timestamp, latest.ID) {
+			latest = &update
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	var tallies []PrecinctTally
+	for _, tally := range m.precinctTallies[latest.ID] {
+		if tally.ContestID == contestID {
+			tally.Precinct = m.precincts[tally.PrecinctID]
+			tallies = append(tallies, tally)
+		}
+	}
+	return tallies, nil
+}
+
+func (m *MemoryStore) CurrentResults(contestID uint) ([]ContestResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var results []ContestResult
+	for _, jResults := range m.results[contestID] {
+		for _, result := range jResults {
+			result.BallotResponse = m.withParty(m.candidates[result.BallotResponseID])
+			results = append(results, result)
+		}
+	}
+	return currentResults(results, m.latestUpdates(m.contests[contestID].ElectionID)), nil
+}
+
+func (m *MemoryStore) ElectionResults(electionID string) ([]ContestResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var results []ContestResult
+	for contestID, contestResults := range m.results {
+		contest := m.contests[contestID]
+		if contest.ElectionID != electionID {
+			continue
+		}
+		for _, jResults := range contestResults {
+			for _, result := range jResults {
+				result.Contest = contest
+				result.BallotResponse = m.withParty(m.candidates[result.BallotResponseID])
+				results = append(results, result)
+			}
+		}
+	}
+	return currentElectionResults(results, m.latestUpdates(electionID)), nil
+}
+
+func (m *MemoryStore) latestUpdates(electionID string) map[JurisdictionType]time.Time {
+	var updates []Update
+	for _, update := range m.updates {
+		if update.ElectionID == electionID {
+			updates = append(updates, update)
+		}
+	}
+	return latestUpdates(updates)
+}
+
+func (m *MemoryStore) LoadUpdate(data []GenericVoteRecord, hash string, timestamp time.Time, election Election) error {
+	if len(data) == 0 {
+		return fmt.Errorf("no data to process")
+	}
+	jType := data[0].JurisdictionType
+	if slices.ContainsFunc(data, func(entry GenericVoteRecord) bool { return entry.JurisdictionType != jType }) {
+		return fmt.Errorf("error, found inconsistent jurisdiction types while updating vote tallies")
+	}
+	rules, err := ContestRulesFromEnv()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.elections[election.ID]; !ok {
+		return fmt.Errorf("election %s is not registered", election.ID)
+	}
+	if m.findUpdate(hash, election.ID) != nil {
+		return fmt.Errorf("update %s already exists for %s", hash, election.ID)
+	}
+	if jType == PrecinctJurisdiction {
+		return m.loadPrecinctUpdate(data, hash, timestamp, election)
+	}
+
+	// Only store the contests that changed since the previous update
+	totals, _ := splitCountyRecords(data)
+	previous := m.snapshot(election.ID, jType, timestamp, math.MaxInt64)
+	changed := votesFromRecords(changedRecords(totals, votesFromTallies(previous)))
+
+	now := time.Now()
+	update := Update{
+		Timestamp:        timestamp,
+		Hash:             hash,
+		JurisdictionType: jType,
+		ElectionID:       election.ID,
+	}
+	update.ID = m.newID()
+	update.CreatedAt, update.UpdatedAt = now, now
+	m.updates[update.ID] = update
+
+	m.storeDistricts(data, now)
+	touched := make(map[uint]bool)
+	for _, record := range data {
+		contest := m.upsertContest(record, election.ID, now)
+		if record.County != "" {
+			candidate := m.upsertCandidate(record, contest, now)
+			tally := CountyTally{
+				ID:               m.newID(),
+				UpdateID:         update.ID,
+				ContestID:        contest.ID,
+				BallotResponseID: candidate.ID,
+				County:           record.County,
+				Votes:            record.Votes,
+			}
+			m.counties[tally.ID] = tally
+			continue
+		}
+		if !slices.Contains(contest.Jurisdictions, string(jType)) {
+			contest.Jurisdictions = append(contest.Jurisdictions, string(jType))
+			m.contests[contest.ID] = contest
+		}
+		candidate := m.upsertCandidate(record, contest, now)
+		if changed[contest.ContestKey] == nil {
+			continue
+		}
+
+		tally := VoteTally{
+			BallotResponseID: candidate.ID,
+			UpdateID:         update.ID,
+			ContestID:        contest.ID,
+			Votes:            record.Votes,
+			VotePercentage:   record.VotePercentage,
+			BallotsCounted:   record.BallotsCounted,
+			RegisteredVoters: record.RegisteredVoters,
+		}
+		tally.ID = m.newID()
+		tally.CreatedAt, tally.UpdatedAt = now, now
+		m.tallies[tally.ID] = tally
+		touched[contest.ID] = true
+	}
+
+	for contestID := range touched {
+		m.refreshResults(contestID, jType)
+	}
+	m.linkCandidates(election.ID, now)
+	m.linkParties(election.ID, now)
+	m.classifyContests(election.ID, rules, false, now)
+	return nil
+}
+
+func (m *MemoryStore) upsertContest(record GenericVoteRecord, electionID string, now time.Time) Contest {
+	contestKey := getContestKey(record.BallotTitle, record.DistrictName)
+	contest, ok := m.findContest(electionID, contestKey)
+	if !ok {
+		contest = Contest{ContestKey: contestKey, ElectionID: electionID}
+		contest.ID = m.newID()
+		contest.CreatedAt = now
+	}
+	contest.BallotTitle = record.BallotTitle
+	contest.District = record.DistrictName
+	contest.UpdatedAt = now
+	m.contests[contest.ID] = contest
+	return contest
+}
+
+func (m *MemoryStore) upsertCandidate(record GenericVoteRecord, contest Contest, now time.Time) BallotResponse {
+	var candidate BallotResponse
+	found := false
+	for _, c := range m.candidates {
+		if c.ContestID == contest.ID && c.Name == record.BallotResponse {
+			candidate, found = c, true
+			break
+		}
+	}
+	if !found {
+		candidate = BallotResponse{Name: record.BallotResponse, ContestID: contest.ID, ElectionID: contest.ElectionID}
+		candidate.ID = m.newID()
+		candidate.CreatedAt = now
+	}
+	party := record.PartyPreference
+	candidate.Party = &party
+	candidate.UpdatedAt = now
+	m.candidates[candidate.ID] = candidate
+	return candidate
+}
+
+func (m *MemoryStore) FindUpdate(hash string, election Election) (*Update, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.findUpdate(hash, election.ID), nil
+}
+
+func (m *MemoryStore) findUpdate(hash string, electionID string) *Update {
+	for _, update := range m.updates {
+		if update.ElectionID == electionID && update.Hash == hash {
+			return &update
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteUpdate(update Update) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.updates[update.ID]; !ok {
+		return fmt.Errorf("update %v not found", update.ID)
+	}
+	m.carryForwardTallies(m.updates[update.ID])
+	touched := m.deleteUpdate(update.ID)
+	for contestID := range touched {
+		m.refreshResults(contestID, update.JurisdictionType)
+	}
+	return nil
+}
+
+// Removes an update and its tallies, returning the contests they covered.
+func (m *MemoryStore) deleteUpdate(updateID uint) map[uint]bool {
+	touched := make(map[uint]bool)
+	for id, tally := range m.tallies {
+		if tally.UpdateID == updateID {
+			touched[tally.ContestID] = true
+			delete(m.tallies, id)
+		}
+	}
+	for id, tally := range m.counties {
+		if tally.UpdateID == updateID {
+			delete(m.counties, id)
+		}
+	}
+	delete(m.precinctTallies, updateID)
+	delete(m.updates, updateID)
+	m.events = slices.DeleteFunc(m.events, func(e UpdateEvent) bool { return e.UpdateID == updateID })
+	return touched
+}
+
+func (m *MemoryStore) GetUpdate(id uint) (*Update, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	update, ok := m.updates[id]
+	if !ok {
+		return nil, fmt.Errorf("update %v not found", id)
+	}
+	return &update, nil
+}
+
+func (m *MemoryStore) ListUpdates(electionID string) ([]Update, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updates := []Update{}
+	for _, update := range m.updates {
+		if update.ElectionID == electionID {
+			updates = append(updates, update)
+		}
+	}
+	slices.SortFunc(updates, func(a, b Update) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return updates, nil
+}
+
+func (m *MemoryStore) UpdateEvents(updateID uint) ([]UpdateEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []UpdateEvent{}
+	for _, event := range m.events {
+		if event.UpdateID == updateID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) RetractUpdate(update Update, actor string, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.updates[update.ID]
+	if !ok {
+		return fmt.Errorf("update %v not found", update.ID)
+	}
+	if stored.RetractedAt != nil {
+		return fmt.Errorf("update %v is already retracted", update.ID)
+	}
+	m.carryForwardTallies(stored)
+	now := time.Now()
+	stored.RetractedAt = &now
+	stored.RetractedBy = actor
+	stored.RetractionReason = reason
+	m.updates[update.ID] = stored
+	m.recordUpdateEvent(stored, RetractedUpdate, actor, reason)
+	return nil
+}
+
+func (m *MemoryStore) RestoreUpdate(update Update, actor string, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.updates[update.ID]
+	if !ok {
+		return fmt.Errorf("update %v not found", update.ID)
+	}
+	if stored.RetractedAt == nil {
+		return fmt.Errorf("update %v is not retracted", update.ID)
+	}
+	m.pinNextUpdateTallies(stored)
+	stored.RetractedAt = nil
+	stored.RetractedBy = ""
+	stored.RetractionReason = ""
+	m.updates[update.ID] = stored
+	m.recordUpdateEvent(stored, RestoredUpdate, actor, reason)
+	return nil
+}
+
+// Records the event and recomputes the results of the update's contests.
+func (m *MemoryStore) recordUpdateEvent(update Update, action UpdateAction, actor string, reason string) {
+	event := UpdateEvent{
+		UpdateID: update.ID,
+		Action:   action,
+		Actor:    actor,
+		Reason:   reason,
+	}
+	event.ID = m.newID()
+	event.CreatedAt = time.Now()
+	event.UpdatedAt = event.CreatedAt
+	m.events = append(m.events, event)
+
+	touched := make(map[uint]bool)
+	for _, tally := range m.tallies {
+		if tally.UpdateID == update.ID {
+			touched[tally.ContestID] = true
+		}
+	}
+	for contestID := range touched {
+		m.refreshResults(contestID, update.JurisdictionType)
+	}
+}
+
+func (m *MemoryStore) Snapshot(update Update) ([]VoteTally, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot(update.ElectionID, update.JurisdictionType, update.Timestamp, update.ID), nil
+}
+
+// Returns the latest tally of each candidate from the updates of one
+// jurisdiction at or before a point in time, like snapshotSQL.
+func (m *MemoryStore) snapshot(electionID string, jType JurisdictionType, timestamp time.Time, updateID uint) []VoteTally {
+	latest := make(map[uint]VoteTally)
+	for _, tally := range m.tallies {
+		update := m.updates[tally.UpdateID]
+		if update.ElectionID != electionID || update.JurisdictionType != jType || update.RetractedAt != nil ||
+			!updateAtOrBefore(update, timestamp, updateID) {
+			continue
+		}
+		if previous, ok := latest[tally.BallotResponseID]; ok && !updateAtOrBefore(previous.Update, update.Timestamp, update.ID) {
+			continue
+		}
+		tally.Update = update
+		tally.Contest = m.contests[tally.ContestID]
+		tally.BallotResponse = m.candidates[tally.BallotResponseID]
+		latest[tally.BallotResponseID] = tally
+	}
+	tallies := slices.Collect(maps.Values(latest))
+	slices.SortFunc(tallies, func(a, b VoteTally) int { return cmp.Compare(a.ID, b.ID) })
+	return tallies
+}
+
+func updateAtOrBefore(update Update, timestamp time.Time, updateID uint) bool {
+	return update.Timestamp.Before(timestamp) || (update.Timestamp.Equal(timestamp) && update.ID <= updateID)
+}
+
+// Returns the next visible update from the same jurisdiction as update, like
+// nextVisibleUpdate.
+func (m *MemoryStore) nextVisibleUpdate(update Update) *Update {
+	var next *Update
+	for _, u := range m.updates {
+		if u.ElectionID != update.ElectionID || u.JurisdictionType != update.JurisdictionType || u.ID == update.ID ||
+			u.RetractedAt != nil || updateAtOrBefore(u, update.Timestamp, update.ID) {
+			continue
+		}
+		if next == nil || updateAtOrBefore(u, next.Timestamp, next.ID) {
+			next = &u
+		}
+	}
+	return next
+}
+
+// Returns the contests an update stored tallies for.
+func (m *MemoryStore) updateContests(updateID uint) map[uint]bool {
+	contests := make(map[uint]bool)
+	for _, tally := range m.tallies {
+		if tally.UpdateID == updateID {
+			contests[tally.ContestID] = true
+		}
+	}
+	return contests
+}
+
+// Copies an update's tallies into the next update from the same jurisdiction
+// for the contests that update didn't store, like carryForwardTallies.
+func (m *MemoryStore) carryForwardTallies(update Update) {
+	next := m.nextVisibleUpdate(update)
+	if next == nil {
+		return
+	}
+	stored := m.updateContests(next.ID)
+	for _, tally := range slices.Collect(maps.Values(m.tallies)) {
+		if tally.UpdateID == update.ID && !stored[tally.ContestID] {
+			tally.ID = m.newID()
+			tally.UpdateID = next.ID
+			m.tallies[tally.ID] = tally
+		}
+	}
+}
+
+// Stores the tallies in effect just before the next update into it for the
+// contests a retracted update covers, like pinNextUpdateTallies.
+func (m *MemoryStore) pinNextUpdateTallies(update Update) {
+	next := m.nextVisibleUpdate(update)
+	if next == nil {
+		return
+	}
+	covered := m.updateContests(update.ID)
+	stored := m.updateContests(next.ID)
+	for _, tally := range m.snapshot(update.ElectionID, update.JurisdictionType, next.Timestamp, next.ID) {
+		if covered[tally.ContestID] && !stored[tally.ContestID] {
+			tally.ID = m.newID()
+			tally.UpdateID = next.ID
+			tally.Update = Update{}
+			tally.Contest = Contest{}
+			tally.BallotResponse = BallotResponse{}
+			m.tallies[tally.ID] = tally
+		}
+	}
+}
+
+func (m *MemoryStore) CompactElection(election Election) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tallies []VoteTally
+	for _, tally := range m.tallies {
+		if update := m.updates[tally.UpdateID]; update.ElectionID == election.ID && update.RetractedAt == nil {
+			tally.Update = update
+			tallies = append(tallies, tally)
+		}
+	}
+	redundant := redundantTallies(tallies)
+	for _, id := range redundant {
+		delete(m.tallies, id)
+	}
+	for id, contest := range m.contests {
+		if contest.ElectionID == election.ID {
+			m.refreshResults(id, StateJurisdiction)
+			m.refreshResults(id, CountyJurisdiction)
+		}
+	}
+	return len(redundant), nil
+}
+
+// Recomputes a contest's results for one jurisdiction type from the latest
+// tally of each candidate.
+func (m *MemoryStore) refreshResults(contestID uint, jType JurisdictionType) {
+	latest := make(map[uint]ContestResult)
+	latestUpdate := make(map[uint]Update)
+	for _, tally := range m.tallies {
+		update := m.updates[tally.UpdateID]
+		if tally.ContestID != contestID || update.JurisdictionType != jType || update.RetractedAt != nil {
+			continue
+		}
+		previous, seen := latestUpdate[tally.BallotResponseID]
+		if seen && (update.Timestamp.Before(previous.Timestamp) ||
+			(update.Timestamp.Equal(previous.Timestamp) && update.ID < previous.ID)) {
+			continue
+		}
+		latestUpdate[tally.BallotResponseID] = update
+		latest[tally.BallotResponseID] = ContestResult{
+			ContestID:        contestID,
+			BallotResponseID: tally.BallotResponseID,
+			JurisdictionType: jType,
+			ElectionID:       update.ElectionID,
+			UpdateID:         update.ID,
+			Votes:            tally.Votes,
+			Timestamp:        update.Timestamp,
+		}
+	}
+
+	if m.results[contestID] == nil {
+		m.results[contestID] = make(map[JurisdictionType][]ContestResult)
+	}
+	if len(latest) == 0 {
+		delete(m.results[contestID], jType)
+		return
+	}
+	results := make([]ContestResult, 0, len(latest))
+	for _, result := range latest {
+		results = append(results, result)
+	}
+	rankContestResults(results)
+	m.results[contestID][jType] = results
+}
+
+func (m *MemoryStore) RecordIngestRun(run *IngestRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run.Attempts = 1
+	run.LastSeenAt = run.FinishedAt
+	// Runs are appended as they finish, so the source's latest is the last one
+	for i, previous := range slices.Backward(m.runs) {
+		if previous.Source != run.Source || previous.ElectionID != run.ElectionID || previous.JurisdictionType != run.JurisdictionType {
+			continue
+		}
+		if run.repeats(previous) {
+			previous.Attempts++
+			previous.LastSeenAt = run.FinishedAt
+			previous.UpdatedAt = time.Now()
+			m.runs[i] = previous
+			*run = previous
+			return nil
+		}
+		break
+	}
+	run.ID = m.newID()
+	run.CreatedAt = time.Now()
+	run.UpdatedAt = run.CreatedAt
+	m.runs = append(m.runs, *run)
+	return nil
+}
+
+func (m *MemoryStore) PruneIngestRuns(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := len(m.runs)
+	m.runs = slices.DeleteFunc(m.runs, func(run IngestRun) bool {
+		return run.Outcome != NewUpdateOutcome && run.LastSeenAt.Before(before)
+	})
+	return count - len(m.runs), nil
+}
+
+func (m *MemoryStore) ListIngestRuns(filter IngestRunFilter) ([]IngestRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs := []IngestRun{}
+	for _, run := range slices.Backward(m.runs) {
+		if (filter.ElectionID == "" || run.ElectionID == filter.ElectionID) &&
+			(filter.Outcome == "" || run.Outcome == filter.Outcome) {
+			runs = append(runs, run)
+		}
+	}
+	slices.SortStableFunc(runs, func(a, b IngestRun) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	if len(runs) > filter.limit() {
+		runs = runs[:filter.limit()]
+	}
+	return runs, nil
+}
+
+func (m *MemoryStore) GetIngestRun(id uint) (*IngestRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, run := range m.runs {
+		if run.ID == id {
+			return &run, nil
+		}
+	}
+	return nil, fmt.Errorf("ingest run %v not found", id)
+}
+
+func (m *MemoryStore) Search(query string) ([]SearchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	var candidates []BallotResponse
+	matched := make(map[uint]bool)
+	for _, candidate := range m.candidates {
+		if matchesTerms(candidate.Name, terms) {
+			candidates = append(candidates, candidate)
+			matched[candidate.ContestID] = true
+		}
+	}
+	slices.SortFunc(candidates, func(a, b BallotResponse) int { return int(a.ID) - int(b.ID) })
+
+	var contests []Contest
+	for _, contest := range m.contests {
+		if matched[contest.ID] || matchesTerms(contest.BallotTitle+" "+contest.District, terms) {
+			contests = append(contests, m.withElection(contest))
+		}
+	}
+	slices.SortFunc(contests, func(a, b Contest) int {
+		if c := b.Election.ElectionDate.Compare(a.Election.ElectionDate); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.BallotTitle, b.BallotTitle); c != 0 {
+			return c
+		}
+		return strings.Compare(a.District, b.District)
+	})
+	if len(contests) > maxSearchResults {
+		contests = contests[:maxSearchResults]
+	}
+	return searchResults(contests, candidates), nil
+}
+
+func (m *MemoryStore) linkCandidates(electionID string, now time.Time) {
+	slugs := candidateSlugs(slices.Collect(maps.Values(m.people)))
+	for _, response := range m.candidates {
+		if response.ElectionID != electionID || response.CandidateID != nil || response.NotCandidate {
+			continue
+		}
+		slug := candidateSlug(response.Name)
+		if slug == "" || !isCandidateName(response.Name) {
+			response.NotCandidate = true
+			m.candidates[response.ID] = response
+			continue
+		}
+		id, ok := slugs[slug]
+		if !ok {
+			candidate := Candidate{Slug: slug, Name: response.Name}
+			candidate.ID = m.newID()
+			candidate.CreatedAt, candidate.UpdatedAt = now, now
+			m.people[candidate.ID] = candidate
+			id = candidate.ID
+			slugs[slug] = id
+		}
+		response.CandidateID = &id
+		m.candidates[response.ID] = response
+	}
+}
+
+func (m *MemoryStore) findCandidate(slug string) (Candidate, bool) {
+	for _, candidate := range m.people {
+		if candidate.Slug == slug {
+			return candidate, true
+		}
+	}
+	return Candidate{}, false
+}
+
+// Returns the ballot responses linked to a candidate, ordered by ID.
+func (m *MemoryStore) candidateResponses(candidateID uint) []BallotResponse {
+	responses := []BallotResponse{}
+	for _, response := range m.candidates {
+		if response.CandidateID != nil && *response.CandidateID == candidateID {
+			responses = append(responses, response)
+		}
+	}
+	slices.SortFunc(responses, func(a, b BallotResponse) int { return cmp.Compare(a.ID, b.ID) })
+	return responses
+}
+
+func (m *MemoryStore) ListCandidates(query string) ([]Candidate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	terms := SearchTerms(query)
+	candidates := []Candidate{}
+	for _, candidate := range m.people {
+		if !matchesTerms(candidate.Name, terms) {
+			continue
+		}
+		candidate.Aliases = slices.Clone(candidate.Aliases)
+		candidate.BallotResponses = m.candidateResponses(candidate.ID)
+		candidates = append(candidates, candidate)
+	}
+	slices.SortFunc(candidates, func(a, b Candidate) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+	return candidates, nil
+}
+
+func (m *MemoryStore) FindCandidate(slug string) (*Candidate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := candidateSlugs(slices.Collect(maps.Values(m.people)))[slug]
+	if !ok {
+		return nil, fmt.Errorf("candidate %s not found", slug)
+	}
+	candidate := m.people[id]
+	candidate.Aliases = slices.Clone(candidate.Aliases)
+	candidate.BallotResponses = m.candidateResponses(id)
+	for i, response := range candidate.BallotResponses {
+		contest := m.withElection(m.contests[response.ContestID])
+		response.Contest = contest
+		for _, tally := range m.tallies {
+			if tally.BallotResponseID == response.ID && m.updates[tally.UpdateID].RetractedAt == nil {
+				tally.Update = m.updates[tally.UpdateID]
+				response.VoteTallies = append(response.VoteTallies, tally)
+			}
+		}
+		slices.SortFunc(response.VoteTallies, func(a, b VoteTally) int { return cmp.Compare(a.ID, b.ID) })
+		candidate.BallotResponses[i] = m.withParty(response)
+	}
+	return &candidate, nil
+}
+
+func (m *MemoryStore) MergeCandidates(fromSlug string, intoSlug string) error {
+	if fromSlug == intoSlug {
+		return fmt.Errorf("cannot merge %s into itself", fromSlug)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, ok := m.findCandidate(fromSlug)
+	if !ok {
+		return fmt.Errorf("candidate %s not found", fromSlug)
+	}
+	into, ok := m.findCandidate(intoSlug)
+	if !ok {
+		return fmt.Errorf("candidate %s not found", intoSlug)
+	}
+	for _, response := range m.candidateResponses(from.ID) {
+		response.CandidateID = &into.ID
+		m.candidates[response.ID] = response
+	}
+	into.Aliases = append(append(slices.Clone(into.Aliases), from.Slug), from.Aliases...)
+	into.UpdatedAt = time.Now()
+	m.people[into.ID] = into
+	delete(m.people, from.ID)
+	return nil
+}
+
+func (m *MemoryStore) SplitCandidate(slug string, ballotResponseIDs []uint) (*Candidate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	candidate, ok := m.findCandidate(slug)
+	if !ok {
+		return nil, fmt.Errorf("candidate %s not found", slug)
+	}
+	candidate.BallotResponses = m.candidateResponses(candidate.ID)
+	moved, err := splitResponses(candidate, ballotResponseIDs)
+	if err != nil {
+		return nil, err
+	}
+	slugs := candidateSlugs(slices.Collect(maps.Values(m.people)))
+	split := Candidate{
+		Slug: uniqueSlug(candidateSlug(moved[0].Name), func(s string) bool { _, ok := slugs[s]; return ok }),
+		Name: moved[0].Name,
+	}
+	split.ID = m.newID()
+	split.CreatedAt = time.Now()
+	split.UpdatedAt = split.CreatedAt
+	m.people[split.ID] = split
+	for _, response := range moved {
+		response.CandidateID = &split.ID
+		m.candidates[response.ID] = response
+	}
+	return &split, nil
+}
+
+func (m *MemoryStore) LoadBoundaries(electionID string, kind BoundaryKind, boundaries []Boundary) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.elections[electionID]; !ok {
+		return fmt.Errorf("election %s is not registered", electionID)
+	}
+	m.deleteBoundaries(electionID, kind)
+	now := time.Now()
+	for i := range boundaries {
+		boundaries[i].ID = m.newID()
+		boundaries[i].ElectionID, boundaries[i].Kind = electionID, kind
+		boundaries[i].CreatedAt, boundaries[i].UpdatedAt = now, now
+		m.boundaries[boundaries[i].ID] = boundaries[i]
+	}
+	return nil
+}
+
+func (m *MemoryStore) Boundaries(electionID string, kind BoundaryKind) ([]Boundary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var boundaries []Boundary
+	for _, boundary := range m.boundaries {
+		if boundary.ElectionID == electionID && boundary.Kind == kind {
+			boundaries = append(boundaries, boundary)
+		}
+	}
+	slices.SortFunc(boundaries, func(a, b Boundary) int { return cmp.Compare(a.Name, b.Name) })
+	return boundaries, nil
+}
+
+func (m *MemoryStore) BoundaryCounts(electionID string) (map[BoundaryKind]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[BoundaryKind]int)
+	for _, boundary := range m.boundaries {
+		if boundary.ElectionID == electionID {
+			counts[boundary.Kind]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *MemoryStore) DeleteBoundaries(electionID string, kind BoundaryKind) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteBoundaries(electionID, kind)
+	return nil
+}
+
+func (m *MemoryStore) deleteBoundaries(electionID string, kind BoundaryKind) {
+	for id, boundary := range m.boundaries {
+		if boundary.ElectionID == electionID && boundary.Kind == kind {
+			delete(m.boundaries, id)
+		}
+	}
+}
+
+func (m *MemoryStore) findDistrict(name string) (District, bool) {
+	for _, district := range m.districts {
+		if district.Name == name {
+			return district, true
+		}
+	}
+	return District{}, false
+}
+
+func (m *MemoryStore) storeDistricts(records []GenericVoteRecord, now time.Time) {
+	specs := recordDistricts(records)
+	for _, spec := range specs {
+		district, ok := m.findDistrict(spec.Name)
+		if !ok {
+			district = spec.District
+			district.ID = m.newID()
+			district.CreatedAt = now
+		} else if district.Type != OtherDistrict {
+			continue
+		}
+		district.Type = spec.Type
+		district.UpdatedAt = now
+		m.districts[district.ID] = district
+	}
+	for _, spec := range specs {
+		district, _ := m.findDistrict(spec.Name)
+		parent, ok := m.findDistrict(spec.ParentName)
+		if spec.ParentName == "" || district.ParentID != nil || !ok || parent.ID == district.ID {
+			continue
+		}
+		district.ParentID = &parent.ID
+		m.districts[district.ID] = district
+	}
+}
+
+func (m *MemoryStore) ListDistricts() ([]District, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	districts := slices.Collect(maps.Values(m.districts))
+	slices.SortFunc(districts, func(a, b District) int { return cmp.Compare(a.Name, b.Name) })
+	return districts, nil
+}
+
+func (m *MemoryStore) SetDistrictType(name string, t DistrictType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	district, ok := m.findDistrict(name)
+	if !ok {
+		return fmt.Errorf("district %s not found", name)
+	}
+	district.Type = t
+	district.UpdatedAt = time.Now()
+	m.districts[district.ID] = district
+	return nil
+}
+
+func (m *MemoryStore) SetDistrictParent(name string, parent string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var parentID *uint
+	if parent != "" {
+		if parent == name {
+			return fmt.Errorf("a district can't be its own parent")
+		}
+		p, ok := m.findDistrict(parent)
+		if !ok {
+			return fmt.Errorf("district %s not found", parent)
+		}
+		parentID = &p.ID
+	}
+	district, ok := m.findDistrict(name)
+	if !ok {
+		return fmt.Errorf("district %s not found", name)
+	}
+	district.ParentID = parentID
+	district.UpdatedAt = time.Now()
+	m.districts[district.ID] = district
+	return nil
+}
+
+// Returns a ballot response with its canonical party attached.
+func (m *MemoryStore) withParty(response BallotResponse) BallotResponse {
+	response.CanonicalParty = nil
+	if response.PartyID != nil {
+		if party, ok := m.parties[*response.PartyID]; ok {
+			party.Aliases = slices.Clone(party.Aliases)
+			response.CanonicalParty = &party
+		}
+	}
+	return response
+}
+
+func (m *MemoryStore) findParty(name string) (Party, bool) {
+	for _, party := range m.parties {
+		if party.Name == name {
+			return party, true
+		}
+	}
+	return Party{}, false
+}
+
+func (m *MemoryStore) linkParties(electionID string, now time.Time) {
+	parties := slices.Collect(maps.Values(m.parties))
+	slices.SortFunc(parties, func(a, b Party) int { return cmp.Compare(a.ID, b.ID) })
+	var preferences []string
+	for _, response := range m.candidates {
+		if response.ElectionID == electionID {
+			preferences = append(preferences, partyName(response.Party))
+		}
+	}
+	resolved, _, _ := resolveParties(parties, preferences, func(party *Party) error {
+		party.ID = m.newID()
+		party.CreatedAt, party.UpdatedAt = now, now
+		m.parties[party.ID] = *party
+		return nil
+	})
+	for _, response := range m.candidates {
+		if response.ElectionID != electionID {
+			continue
+		}
+		if partyID := resolved[partyName(response.Party)]; partyID != nil {
+			id := *partyID
+			response.PartyID = &id
+		} else {
+			response.PartyID = nil
+		}
+		m.candidates[response.ID] = response
+	}
+}
+
+func (m *MemoryStore) ListParties() ([]Party, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parties := make([]Party, 0, len(m.parties))
+	for _, party := range m.parties {
+		party.Aliases = slices.Clone(party.Aliases)
+		parties = append(parties, party)
+	}
+	slices.SortFunc(parties, func(a, b Party) int { return cmp.Compare(a.Name, b.Name) })
+	return parties, nil
+}
+
+func (m *MemoryStore) UpdateParty(name string, abbreviation string, color string) error {
+	if err := validatePartyStyle(abbreviation, color); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	party, ok := m.findParty(name)
+	if !ok {
+		return fmt.Errorf("party %s not found", name)
+	}
+	if abbreviation != "" {
+		party.Abbreviation = abbreviation
+	}
+	if color != "" {
+		party.Color = color
+	}
+	party.UpdatedAt = time.Now()
+	m.parties[party.ID] = party
+	return nil
+}
+
+func (m *MemoryStore) MergeParties(from string, into string) error {
+	if from == into {
+		return fmt.Errorf("cannot merge %s into itself", from)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fromParty, ok := m.findParty(from)
+	if !ok {
+		return fmt.Errorf("party %s not found", from)
+	}
+	intoParty, ok := m.findParty(into)
+	if !ok {
+		return fmt.Errorf("party %s not found", into)
+	}
+	intoParty.Aliases = mergeAliases(slices.Clone(intoParty.Aliases), fromParty)
+	intoParty.UpdatedAt = time.Now()
+	m.parties[intoParty.ID] = intoParty
+	for _, response := range m.candidates {
+		if response.PartyID != nil && *response.PartyID == fromParty.ID {
+			response.PartyID = &intoParty.ID
+			m.candidates[response.ID] = response
+		}
+	}
+	delete(m.parties, fromParty.ID)
+	return nil
+}
+
+func (m *MemoryStore) classifyContests(electionID string, rules []ContestRule, all bool, now time.Time) int {
+	count := 0
+	for _, contest := range m.contests {
+		if contest.ElectionID != electionID || (!all && contest.Category != "") {
+			continue
+		}
+		category, level := ClassifyContest(rules, contest.BallotTitle, contest.District)
+		if category == contest.Category && level == contest.Level {
+			continue
+		}
+		contest.Category, contest.Level = category, level
+		contest.UpdatedAt = now
+		m.contests[contest.ID] = contest
+		count++
+	}
+	return count
+}
+
+func (m *MemoryStore) ClassifyContests(electionID string) (int, error) {
+	rules, err := ContestRulesFromEnv()
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.classifyContests(electionID, rules, true, time.Now()), nil
+}
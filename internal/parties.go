@@ -0,0 +1,365 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Party is a canonical political party. Candidates state their party
+// preference in their own words, kept in BallotResponse.Party, which is
+// matched to a party by its name or one of its aliases. Preferences that
+// match no party get a party of their own, which can be merged into another.
+type Party struct {
+	gorm.Model
+	Name         string `gorm:"uniqueIndex"`
+	Abbreviation string
+	// Hex color of the party in charts and maps
+	Color   string
+	Aliases StringArray
+}
+
+// Color of parties created for preferences that matched no party.
+const defaultPartyColor = "#6B7280"
+
+// Parties every database starts with.
+var defaultParties = []Party{
+	{Name: "Democratic", Abbreviation: "D", Color: "#2563EB", Aliases: StringArray{"Democrat", "Democrats", "Dem"}},
+	{Name: "Republican", Abbreviation: "R", Color: "#DC2626", Aliases: StringArray{"GOP", "Grand Old Party", "Republicans"}},
+	{Name: "Libertarian", Abbreviation: "L", Color: "#CA8A04"},
+	{Name: "Green", Abbreviation: "G", Color: "#16A34A"},
+	{Name: "Independent", Abbreviation: "I", Color: "#7C3AED"},
+	{Name: "No Party Preference", Abbreviation: "NPP", Color: defaultPartyColor, Aliases: StringArray{"States No Party Preference", "None", "No Preference"}},
+}
+
+var partyColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// Returns the key preferences and party names are matched by: lowercase
+// words without "Prefers" or "Party", so that "(Prefers GOP Party)" and "GOP"
+// match.
+func partyKey(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words = slices.DeleteFunc(words, func(word string) bool { return word == "prefers" || word == "party" })
+	return strings.Join(words, " ")
+}
+
+func (p Party) matches(key string) bool {
+	return partyKey(p.Name) == key || slices.ContainsFunc(p.Aliases, func(alias string) bool { return partyKey(alias) == key })
+}
+
+func matchParty(parties []Party, preference string) (Party, bool) {
+	key := partyKey(preference)
+	for _, party := range parties {
+		if party.matches(key) {
+			return party, true
+		}
+	}
+	return Party{}, false
+}
+
+// Returns a party for a preference that matched no party, named by it without
+// "Prefers" or "Party" and abbreviated by its initials.
+func newParty(preference string) Party {
+	name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(preference), "Prefers "))
+	name = strings.TrimSpace(strings.TrimSuffix(name, " Party"))
+	if name == "" {
+		name = strings.TrimSpace(preference)
+	}
+	var initials []rune
+	for _, word := range strings.Fields(name) {
+		if r := []rune(word)[0]; unicode.IsLetter(r) && len(initials) < 3 {
+			initials = append(initials, unicode.ToUpper(r))
+		}
+	}
+	return Party{Name: name, Abbreviation: string(initials), Color: defaultPartyColor}
+}
+
+// Returns the party each preference matches, creating parties for the ones
+// that match none with create. Empty preferences have no party.
+func resolveParties(parties []Party, preferences []string, create func(*Party) error) (map[string]*uint, []Party, error) {
+	resolved := make(map[string]*uint)
+	for _, preference := range preferences {
+		if _, ok := resolved[preference]; ok || strings.TrimSpace(preference) == "" {
+			continue
+		}
+		party, ok := matchParty(parties, preference)
+		if !ok {
+			party = newParty(preference)
+			if err := create(&party); err != nil {
+				return nil, nil, err
+			}
+			parties = append(parties, party)
+		}
+		resolved[preference] = &party.ID
+	}
+	return resolved, parties, nil
+}
+
+// Creates the default parties that don't exist yet. A default party merged
+// into another is an alias of it and isn't created again.
+func (db *DB) seedParties() error {
+	var parties []Party
+	if err := db.Find(&parties).Error; err != nil {
+		return fmt.Errorf("error fetching parties: %v", err)
+	}
+	for _, party := range defaultParties {
+		if _, ok := matchParty(parties, party.Name); ok {
+			continue
+		}
+		if err := db.Create(&party).Error; err != nil {
+			return fmt.Errorf("error creating party %s: %v", party.Name, err)
+		}
+	}
+	return nil
+}
+
+// Links an election's ballot responses to the parties their preferences
+// match, creating parties for preferences that match none.
+func linkParties(tx *gorm.DB, electionID string) error {
+	var responses []BallotResponse
+	if err := tx.Where("election_id = ?", electionID).Find(&responses).Error; err != nil {
+		return fmt.Errorf("error fetching candidates for %s: %v", electionID, err)
+	}
+	var parties []Party
+	if err := tx.Find(&parties).Error; err != nil {
+		return fmt.Errorf("error fetching parties: %v", err)
+	}
+	preferences := make([]string, len(responses))
+	for i, response := range responses {
+		preferences[i] = partyName(response.Party)
+	}
+	resolved, _, err := resolveParties(parties, preferences, func(party *Party) error {
+		if err := tx.Create(party).Error; err != nil {
+			return fmt.Errorf("error creating party %s: %v", party.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only responses whose party changed are updated, grouped by party
+	changed := make(map[uint][]uint)
+	var cleared []uint
+	for _, response := range responses {
+		partyID := resolved[partyName(response.Party)]
+		switch {
+		case partyID == nil && response.PartyID != nil:
+			cleared = append(cleared, response.ID)
+		case partyID != nil && (response.PartyID == nil || *response.PartyID != *partyID):
+			changed[*partyID] = append(changed[*partyID], response.ID)
+		}
+	}
+	for partyID, ids := range changed {
+		for chunk := range slices.Chunk(ids, 500) {
+			if err := tx.Model(&BallotResponse{}).Where("id IN ?", chunk).Update("party_id", partyID).Error; err != nil {
+				return fmt.Errorf("error linking candidates to parties: %v", err)
+			}
+		}
+	}
+	for chunk := range slices.Chunk(cleared, 500) {
+		if err := tx.Model(&BallotResponse{}).Where("id IN ?", chunk).Update("party_id", nil).Error; err != nil {
+			return fmt.Errorf("error unlinking candidates from parties: %v", err)
+		}
+	}
+	return nil
+}
+
+func partyName(party *string) string {
+	if party == nil {
+		return ""
+	}
+	return *party
+}
+
+// Links ballot responses loaded before parties were stored.
+func (db *DB) backfillParties() error {
+	var electionIDs []string
+	if err := db.Model(&BallotResponse{}).Where("party_id IS NULL AND party <> ''").Distinct().Pluck("election_id", &electionIDs).Error; err != nil {
+		return fmt.Errorf("error finding candidates without parties: %v", err)
+	}
+	for _, electionID := range electionIDs {
+		if err := linkParties(db.DB, electionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns every party ordered by name.
+func (db *DB) ListParties() ([]Party, error) {
+	var parties []Party
+	if err := db.Order("name").Find(&parties).Error; err != nil {
+		return nil, fmt.Errorf("error fetching parties: %v", err)
+	}
+	return parties, nil
+}
+
+func validatePartyStyle(abbreviation string, color string) error {
+	if color != "" && !partyColorPattern.MatchString(color) {
+		return fmt.Errorf("invalid color %q, expected a hex color like #2563EB", color)
+	}
+	if len(abbreviation) > 5 {
+		return fmt.Errorf("abbreviation %q is longer than 5 characters", abbreviation)
+	}
+	return nil
+}
+
+// Changes a party's abbreviation and color, leaving the ones that are ""
+// unchanged.
+func (db *DB) UpdateParty(name string, abbreviation string, color string) error {
+	if err := validatePartyStyle(abbreviation, color); err != nil {
+		return err
+	}
+	result := db.Model(&Party{}).Where("name = ?", name).Updates(Party{Abbreviation: abbreviation, Color: color})
+	if result.Error != nil {
+		return fmt.Errorf("error updating party %s: %v", name, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("party %s not found", name)
+	}
+	return nil
+}
+
+// Merges a party into another. Its name and aliases become aliases of the
+// other party, and its candidates move to it.
+func (db *DB) MergeParties(from string, into string) error {
+	if from == into {
+		return fmt.Errorf("cannot merge %s into itself", from)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var fromParty, intoParty Party
+		if err := tx.Where("name = ?", from).First(&fromParty).Error; err != nil {
+			return fmt.Errorf("party %s not found", from)
+		}
+		if err := tx.Where("name = ?", into).First(&intoParty).Error; err != nil {
+			return fmt.Errorf("party %s not found", into)
+		}
+		intoParty.Aliases = mergeAliases(intoParty.Aliases, fromParty)
+		if err := tx.Model(&intoParty).Update("aliases", intoParty.Aliases).Error; err != nil {
+			return fmt.Errorf("error updating party %s: %v", into, err)
+		}
+		if err := tx.Model(&BallotResponse{}).Where("party_id = ?", fromParty.ID).Update("party_id", intoParty.ID).Error; err != nil {
+			return fmt.Errorf("error moving candidates to %s: %v", into, err)
+		}
+		if err := tx.Unscoped().Delete(&fromParty).Error; err != nil {
+			return fmt.Errorf("error deleting party %s: %v", from, err)
+		}
+		return nil
+	})
+}
+
+func mergeAliases(aliases StringArray, from Party) StringArray {
+	for _, alias := range append([]string{from.Name}, from.Aliases...) {
+		if !slices.Contains(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// PartyTotal is the votes for one party's candidates.
+type PartyTotal struct {
+	Party Party
+	Votes int
+	// Share of the votes in the races counted, from 0 to 100
+	Percent float64
+	// Races the party had a candidate in, and led
+	Contests int
+	Leading  int
+}
+
+// PartyVotes adds up the votes by party across partisan races, those with at
+// least one candidate stating a party preference.
+type PartyVotes struct {
+	Contests int
+	Total    int
+	// Votes for candidates without a party, such as write-ins
+	Unaffiliated int
+	Parties      []PartyTotal
+}
+
+func tallyPartyVotes(results []ContestResult) PartyVotes {
+	byContest := make(map[uint][]ContestResult)
+	for _, result := range results {
+		byContest[result.ContestID] = append(byContest[result.ContestID], result)
+	}
+	var votes PartyVotes
+	byParty := make(map[uint]*PartyTotal)
+	for _, contestResults := range byContest {
+		if !slices.ContainsFunc(contestResults, func(r ContestResult) bool { return r.BallotResponse.CanonicalParty != nil }) {
+			continue
+		}
+		votes.Contests++
+		seen := make(map[uint]bool)
+		for _, result := range contestResults {
+			votes.Total += result.Votes
+			party := result.BallotResponse.CanonicalParty
+			if party == nil {
+				votes.Unaffiliated += result.Votes
+				continue
+			}
+			total, ok := byParty[party.ID]
+			if !ok {
+				total = &PartyTotal{Party: *party}
+				byParty[party.ID] = total
+			}
+			total.Votes += result.Votes
+			if !seen[party.ID] {
+				seen[party.ID] = true
+				total.Contests++
+			}
+			if result.Rank == 1 {
+				total.Leading++
+			}
+		}
+	}
+	for _, total := range byParty {
+		if votes.Total > 0 {
+			total.Percent = float64(total.Votes) * 100 / float64(votes.Total)
+		}
+		votes.Parties = append(votes.Parties, *total)
+	}
+	slices.SortFunc(votes.Parties, func(a, b PartyTotal) int {
+		return cmp.Or(b.Votes-a.Votes, cmp.Compare(a.Party.Name, b.Party.Name))
+	})
+	return votes
+}
+
+// PartyVotesByType is the party vote in the races of one type of district.
+type PartyVotesByType struct {
+	Type DistrictType
+	PartyVotes
+}
+
+// Adds up an election's votes by party across all of its partisan races and
+// by the type of their districts. results need their BallotResponse with its
+// CanonicalParty and their Contest.
+func TallyPartyVotes(results []ContestResult, districts []District) (PartyVotes, []PartyVotesByType) {
+	types := make(map[string]DistrictType)
+	for _, district := range districts {
+		types[district.Name] = district.Type
+	}
+	byType := make(map[DistrictType][]ContestResult)
+	for _, result := range results {
+		t, ok := types[result.Contest.District]
+		if !ok {
+			t = ClassifyDistrict("", result.Contest.District)
+		}
+		byType[t] = append(byType[t], result)
+	}
+	var sections []PartyVotesByType
+	for _, t := range DistrictTypes {
+		if votes := tallyPartyVotes(byType[t]); votes.Contests > 0 {
+			sections = append(sections, PartyVotesByType{Type: t, PartyVotes: votes})
+		}
+	}
+	return tallyPartyVotes(results), sections
+}
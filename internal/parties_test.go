@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergedDefaultPartyStaysMerged(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		if err := store.MergeParties("Libertarian", "Independent"); err != nil {
+			t.Fatal(err)
+		}
+		// Migrating again seeds the default parties
+		if err := store.MigrateSchema(); err != nil {
+			t.Fatal(err)
+		}
+		parties, err := store.ListParties()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, len(parties))
+		for i, party := range parties {
+			names[i] = party.Name
+		}
+		if slices.Contains(names, "Libertarian") {
+			t.Errorf("parties after migrating = %v, want Libertarian merged into Independent", names)
+		}
+		independent, ok := matchParty(parties, "Prefers Libertarian Party")
+		if !ok || independent.Name != "Independent" {
+			t.Errorf("Libertarian preference matched %v, want Independent", independent.Name)
+		}
+	})
+}
+
+func TestPartyKey(t *testing.T) {
+	tests := []struct {
+		preference string
+		want       string
+	}{
+		{"(Prefers Democratic Party)", "democratic"},
+		{"Prefers GOP Party", "gop"},
+		{"States No Party Preference", "states no preference"},
+		{"  Green  ", "green"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := partyKey(test.preference); got != test.want {
+			t.Errorf("partyKey(%q) = %q, want %q", test.preference, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Precinct is a King County voting precinct, with the districts the latest
+// precinct results file placed it in.
+type Precinct struct {
+	gorm.Model
+	Name                  string `gorm:"uniqueIndex"`
+	LegislativeDistrict   string
+	CouncilDistrict       string
+	CongressionalDistrict string
+}
+
+// PrecinctTally is a candidate's votes in one precinct as of an update, from
+// the county's precinct results. The contest totals stay in VoteTally.
+type PrecinctTally struct {
+	ID               uint           `gorm:"primaryKey"`
+	UpdateID         uint           `gorm:"index"`
+	Update           Update         `gorm:"constraint:OnDelete:CASCADE"`
+	PrecinctID       uint           `gorm:"index"`
+	Precinct         Precinct       `gorm:"constraint:OnDelete:CASCADE"`
+	ContestID        uint           `gorm:"index"`
+	BallotResponseID uint           `gorm:"index"`
+	BallotResponse   BallotResponse `gorm:"constraint:OnDelete:CASCADE"`
+	Votes            int
+	// Ballots counted and registered voters in the precinct
+	BallotsCounted   int
+	RegisteredVoters int
+}
+
+// Counters in the precinct results file that aren't a candidate's votes.
+const (
+	registeredVotersCounter = "Registered Voters"
+	timesCountedCounter     = "Times Counted"
+)
+
+func isPrecinctCounter(counterType string) bool {
+	return counterType == registeredVotersCounter || strings.HasPrefix(counterType, "Times ")
+}
+
+// Converts the rows of a precinct results file into records, one for each
+// candidate in each race and precinct. Only the rows totalling every way of
+// voting are used, and the precinct's registered voters and ballots counted
+// are copied onto each of its candidates.
+func precinctRecords(rows []*PrecinctCSVRecord) []GenericVoteRecord {
+	type raceKey struct{ precinct, race string }
+	counters := make(map[raceKey]map[string]int)
+	var candidates []*PrecinctCSVRecord
+	var rowNumbers []int
+	for i, row := range rows {
+		if row.CounterGroup != "" && !strings.EqualFold(row.CounterGroup, "Total") {
+			continue
+		}
+		if isPrecinctCounter(row.CounterType) {
+			key := raceKey{row.Precinct, row.Race}
+			if counters[key] == nil {
+				counters[key] = make(map[string]int)
+			}
+			counters[key][row.CounterType] += row.SumOfCount
+			continue
+		}
+		candidates = append(candidates, row)
+		rowNumbers = append(rowNumbers, i+2) // 1-based, after the header
+	}
+
+	records := make([]GenericVoteRecord, 0, len(candidates))
+	for i, row := range candidates {
+		raceCounters := counters[raceKey{row.Precinct, row.Race}]
+		records = append(records, GenericVoteRecord{
+			BallotTitle:      normalizeString(row.Race),
+			BallotResponse:   normalizeString(row.CounterType),
+			Votes:            row.SumOfCount,
+			PartyPreference:  extractParty(row.Party),
+			JurisdictionType: PrecinctJurisdiction,
+			BallotsCounted:   raceCounters[timesCountedCounter],
+			RegisteredVoters: raceCounters[registeredVotersCounter],
+			Precinct: Precinct{
+				Name:                  strings.TrimSpace(row.Precinct),
+				LegislativeDistrict:   strings.TrimSpace(row.LEG),
+				CouncilDistrict:       strings.TrimSpace(row.CC),
+				CongressionalDistrict: strings.TrimSpace(row.CG),
+			},
+			Row: rowNumbers[i],
+		})
+	}
+	return records
+}
+
+// Finds the contest a precinct results race refers to. The file names a race
+// with a single string, which is the ballot title with or without the
+// district around it, so a bare title only matches when it's unique.
+type contestMatcher map[string][]Contest
+
+func newContestMatcher(contests []Contest) contestMatcher {
+	m := make(contestMatcher)
+	for _, contest := range contests {
+		for _, form := range []string{
+			contest.BallotTitle,
+			contest.District + " " + contest.BallotTitle,
+			contest.BallotTitle + " " + contest.District,
+		} {
+			key := matchKey(form)
+			if !slices.ContainsFunc(m[key], func(c Contest) bool { return c.ID == contest.ID }) {
+				m[key] = append(m[key], contest)
+			}
+		}
+	}
+	return m
+}
+
+func (m contestMatcher) match(race string) (Contest, bool) {
+	contests := m[matchKey(race)]
+	if len(contests) != 1 {
+		return Contest{}, false
+	}
+	return contests[0], true
+}
+
+func matchKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Turns precinct records into tallies for an update, matching them to the
+// election's contests and candidates. precinctIDs maps precinct names to IDs.
+// Returns the races that matched no contest.
+func precinctTallies(records []GenericVoteRecord, updateID uint, contests []Contest, candidates []BallotResponse, precinctIDs map[string]uint) ([]PrecinctTally, []string) {
+	matcher := newContestMatcher(contests)
+	responseIDs := make(map[string]uint)
+	for _, candidate := range candidates {
+		responseIDs[getCandidateKey(candidate.ContestID, strings.ToLower(candidate.Name))] = candidate.ID
+	}
+	var tallies []PrecinctTally
+	var unmatched []string
+	for _, record := range records {
+		contest, ok := matcher.match(record.BallotTitle)
+		if !ok {
+			if !slices.Contains(unmatched, record.BallotTitle) {
+				unmatched = append(unmatched, record.BallotTitle)
+			}
+			continue
+		}
+		responseID, ok := responseIDs[getCandidateKey(contest.ID, strings.ToLower(record.BallotResponse))]
+		if !ok {
+			continue
+		}
+		tallies = append(tallies, PrecinctTally{
+			UpdateID:         updateID,
+			PrecinctID:       precinctIDs[record.Precinct.Name],
+			ContestID:        contest.ID,
+			BallotResponseID: responseID,
+			Votes:            record.Votes,
+			BallotsCounted:   record.BallotsCounted,
+			RegisteredVoters: record.RegisteredVoters,
+		})
+	}
+	return tallies, unmatched
+}
+
+// Returns each precinct in the records once, with the districts of its last
+// record.
+func distinctPrecincts(records []GenericVoteRecord) []Precinct {
+	byName := make(map[string]Precinct)
+	for _, record := range records {
+		byName[record.Precinct.Name] = record.Precinct
+	}
+	precincts := make([]Precinct, 0, len(byName))
+	for _, precinct := range byName {
+		precincts = append(precincts, precinct)
+	}
+	slices.SortFunc(precincts, func(a, b Precinct) int { return cmp.Compare(a.Name, b.Name) })
+	return precincts
+}
+
+// Loads a precinct results file as an update. Precinct results only break
+// down contests the election already has, so nothing is created for races
+// that don't match one.
+func (db *DB) loadPrecinctUpdate(data []GenericVoteRecord, hash string, timestamp time.Time, election Election) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		precincts := distinctPrecincts(data)
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"legislative_district", "council_district", "congressional_district", "updated_at"}),
+		}).CreateInBatches(&precincts, 500).Error; err != nil {
+			return fmt.Errorf("error creating precincts: %v", err)
+		}
+		precinctIDs := make(map[string]uint)
+		for _, precinct := range precincts {
+			precinctIDs[precinct.Name] = precinct.ID
+		}
+
+		var contests []Contest
+		var candidates []BallotResponse
+		if err := tx.Where("election_id = ?", election.ID).Find(&contests).Error; err != nil {
+			return fmt.Errorf("error fetching contests for %s: %v", election.ID, err)
+		}
+		if err := tx.Where("election_id = ?", election.ID).Find(&candidates).Error; err != nil {
+			return fmt.Errorf("error fetching candidates for %s: %v", election.ID, err)
+		}
+
+		update := &Update{
+			Timestamp:        timestamp,
+			Hash:             hash,
+			JurisdictionType: PrecinctJurisdiction,
+			ElectionID:       election.ID,
+		}
+		if err := tx.Create(update).Error; err != nil {
+			return fmt.Errorf("error creating update: %v", err)
+		}
+		tallies, unmatched := precinctTallies(data, update.ID, contests, candidates, precinctIDs)
+		if len(tallies) == 0 {
+			return fmt.Errorf("no precinct results match the contests of %s", election.ID)
+		}
+		if len(unmatched) > 0 {
+			log.Printf("Skipped %v precinct races with no matching contest: %s", len(unmatched), strings.Join(unmatched, ", "))
+		}
+		fmt.Printf("Loading %v precinct tallies for %v precincts\n", len(tallies), len(precincts))
+		if err := tx.CreateInBatches(tallies, 1000).Error; err != nil {
+			return fmt.Errorf("error creating precinct tallies: %v", err)
+		}
+		return nil
+	})
+}
+
+// Returns a contest's precinct tallies, with their Precinct, from the latest
+// update that broke it down by precinct, leaving out retracted updates.
+func (db *DB) PrecinctTallies(contestID uint) ([]PrecinctTally, error) {
+	var latest Update
+	err := db.Joins("JOIN precinct_tallies ON precinct_tallies.update_id = updates.id").
+		Where("precinct_tallies.contest_id = ? AND updates.retracted_at IS NULL", contestID).
+		Order("updates.timestamp DESC, updates.id DESC").
+		First(&latest).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error finding precinct results for contest %v: %v", contestID, err)
+	}
+	var tallies []PrecinctTally
+	if err := db.Where("contest_id = ? AND update_id = ?", contestID, latest.ID).
+		Preload("Precinct").
+		Find(&tallies).Error; err != nil {
+		return nil, fmt.Errorf("error fetching precinct results for contest %v: %v", contestID, err)
+	}
+	return tallies, nil
+}
+
+// PrecinctResult is a contest's votes in one precinct.
+type PrecinctResult struct {
+	Precinct Precinct
+	// Votes of each candidate, keyed by ballot response ID
+	Votes            map[uint]int
+	Total            int
+	BallotsCounted   int
+	RegisteredVoters int
+}
+
+// Returns the candidate's share of the votes in the precinct, from 0 to 100.
+func (r PrecinctResult) Percent(ballotResponseID uint) float64 {
+	if r.Total <= 0 {
+		return 0
+	}
+	return float64(r.Votes[ballotResponseID]) * 100 / float64(r.Total)
+}
+
+// Returns the precinct's turnout, from 0 to 100.
+func (r PrecinctResult) Turnout() float64 {
+	if r.RegisteredVoters <= 0 {
+		return 0
+	}
+	return float64(r.BallotsCounted) * 100 / float64(r.RegisteredVoters)
+}
+
+// Groups precinct tallies by precinct, ordered by name.
+func GroupPrecinctTallies(tallies []PrecinctTally) []PrecinctResult {
+	byPrecinct := make(map[uint]*PrecinctResult)
+	for _, tally := range tallies {
+		result, ok := byPrecinct[tally.PrecinctID]
+		if !ok {
+			result = &PrecinctResult{Precinct: tally.Precinct, Votes: make(map[uint]int)}
+			byPrecinct[tally.PrecinctID] = result
+		}
+		result.Votes[tally.BallotResponseID] += tally.Votes
+		result.Total += tally.Votes
+		result.BallotsCounted = max(result.BallotsCounted, tally.BallotsCounted)
+		result.RegisteredVoters = max(result.RegisteredVoters, tally.RegisteredVoters)
+	}
+	results := make([]PrecinctResult, 0, len(byPrecinct))
+	for _, result := range byPrecinct {
+		results = append(results, *result)
+	}
+	slices.SortFunc(results, func(a, b PrecinctResult) int { return cmp.Compare(a.Precinct.Name, b.Precinct.Name) })
+	return results
+}
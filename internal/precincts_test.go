@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPrecinctRecords(t *testing.T) {
+	row := func(precinct string, race string, group string, counter string, count int) *PrecinctCSVRecord {
+		return &PrecinctCSVRecord{Precinct: precinct, Race: race, LEG: "43 ", CC: "4", CG: "7", CounterGroup: group, CounterType: counter, SumOfCount: count}
+	}
+	alice := row(" SEA 11-1234 ", "Mayor", "Total", "Alice Smith", 150)
+	alice.Party = "(Prefers Democratic Party)"
+	rows := []*PrecinctCSVRecord{
+		row(" SEA 11-1234 ", "Mayor", "Total", "Registered Voters", 500),
+		row(" SEA 11-1234 ", "Mayor", "Total", "Times Counted", 300),
+		row(" SEA 11-1234 ", "Mayor", "Total", "Times Over Voted", 2),
+		alice,
+		row(" SEA 11-1234 ", "Mayor", "Election Day", "Alice Smith", 40),
+		row(" SEA 11-1234 ", "Mayor", "Election Day", "Times Counted", 99),
+		row(" SEA 11-1234 ", "Mayor", "", "Bob Jones", 100),
+		row("SEA 11-1235", "Mayor", "total", "Times Counted", 80),
+		row("SEA 11-1235", "Mayor", "total", "Alice Smith", 50),
+		row("SEA 11-1235", "Council", "Total", "Carol White", 70),
+	}
+	type summary struct {
+		precinct, race, response, party string
+		votes, counted, registered, row int
+	}
+	var got []summary
+	for _, record := range precinctRecords(rows) {
+		if record.JurisdictionType != PrecinctJurisdiction || record.Precinct.LegislativeDistrict != "43" {
+			t.Errorf("record %+v isn't a precinct record in LD 43", record)
+		}
+		got = append(got, summary{record.Precinct.Name, record.BallotTitle, record.BallotResponse, record.PartyPreference,
+			record.Votes, record.BallotsCounted, record.RegisteredVoters, record.Row})
+	}
+	want := []summary{
+		{"SEA 11-1234", "Mayor", "Alice Smith", "Democratic Party", 150, 300, 500, 5},
+		{"SEA 11-1234", "Mayor", "Bob Jones", "", 100, 300, 500, 8},
+		{"SEA 11-1235", "Mayor", "Alice Smith", "", 50, 80, 0, 10},
+		{"SEA 11-1235", "Council", "Carol White", "", 70, 0, 0, 11},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("precinctRecords =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestContestMatcher(t *testing.T) {
+	contests := []Contest{
+		{BallotTitle: "Mayor", District: "City of Seattle"},
+		{BallotTitle: "Council Position 1", District: "City of Seattle"},
+		{BallotTitle: "Council Position 1", District: "City of Bellevue"},
+		{BallotTitle: "Proposition 1", District: "King County"},
+	}
+	for i := range contests {
+		contests[i].ID = uint(i + 1)
+	}
+	matcher := newContestMatcher(contests)
+	tests := []struct {
+		race string
+		want uint
+	}{
+		{"Mayor", 1},
+		{"City of Seattle Mayor", 1},
+		{"Mayor City of Seattle", 1},
+		{"  city of  SEATTLE   mayor ", 1},
+		{"City of Bellevue Council Position 1", 3},
+		{"Council Position 1 City of Seattle", 2},
+		// The title alone is ambiguous
+		{"Council Position 1", 0},
+		{"Proposition 1", 4},
+		{"City of Seattle Proposition 1", 0},
+		{"Governor", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		contest, ok := matcher.match(test.race)
+		if ok != (test.want != 0) || contest.ID != test.want {
+			t.Errorf("match(%q) = %d, %v; want %d", test.race, contest.ID, ok, test.want)
+		}
+	}
+}
+
+func TestGroupPrecinctTallies(t *testing.T) {
+	sea1235 := Precinct{Name: "SEA 11-1235"}
+	sea1235.ID = 2
+	sea1234 := Precinct{Name: "SEA 11-1234"}
+	sea1234.ID = 1
+	tallies := []PrecinctTally{
+		{PrecinctID: 2, Precinct: sea1235, BallotResponseID: 10, Votes: 50, BallotsCounted: 80, RegisteredVoters: 100},
+		{PrecinctID: 1, Precinct: sea1234, BallotResponseID: 10, Votes: 150, BallotsCounted: 300, RegisteredVoters: 500},
+		{PrecinctID: 1, Precinct: sea1234, BallotResponseID: 11, Votes: 100, BallotsCounted: 300, RegisteredVoters: 500},
+		{PrecinctID: 2, Precinct: sea1235, BallotResponseID: 11, Votes: 0},
+	}
+	results := GroupPrecinctTallies(tallies)
+	if len(results) != 2 || results[0].Precinct.Name != "SEA 11-1234" || results[1].Precinct.Name != "SEA 11-1235" {
+		t.Fatalf("GroupPrecinctTallies = %+v, want both precincts by name", results)
+	}
+	first, second := results[0], results[1]
+	if first.Total != 250 || first.Votes[10] != 150 || first.Votes[11] != 100 {
+		t.Errorf("SEA 11-1234 = %+v, want 150 and 100 of 250", first)
+	}
+	if first.Percent(10) != 60 || first.Turnout() != 60 {
+		t.Errorf("SEA 11-1234 percent %v, turnout %v; want 60 and 60", first.Percent(10), first.Turnout())
+	}
+	if second.Total != 50 || second.BallotsCounted != 80 || second.RegisteredVoters != 100 {
+		t.Errorf("SEA 11-1235 = %+v, want 50 votes and the counters of its first tally", second)
+	}
+	if empty := (PrecinctResult{}); empty.Percent(10) != 0 || empty.Turnout() != 0 {
+		t.Errorf("an empty precinct has percent %v and turnout %v, want 0", empty.Percent(10), empty.Turnout())
+	}
+	if results := GroupPrecinctTallies(nil); results == nil || len(results) != 0 {
+		t.Errorf("GroupPrecinctTallies(nil) = %#v, want an empty list", results)
+	}
+}
+
+func TestStoreLoadPrecinctUpdate(t *testing.T) {
+	precinctRecord := func(race string, candidate string, votes int) GenericVoteRecord {
+		return GenericVoteRecord{
+			BallotTitle:      race,
+			BallotResponse:   candidate,
+			Votes:            votes,
+			JurisdictionType: PrecinctJurisdiction,
+			BallotsCounted:   300,
+			RegisteredVoters: 500,
+			Precinct:         Precinct{Name: "SEA 11-1234", LegislativeDistrict: "43"},
+		}
+	}
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		loadTestUpdate(t, store, election, "county", 1, testRecord("Mayor", "Alice Smith", 150), testRecord("Mayor", "Bob Jones", 100))
+
+		err := store.LoadUpdate([]GenericVoteRecord{precinctRecord("Governor", "Alice Smith", 40)}, "unmatched", testElectionDate.Add(2*time.Hour), election)
+		if err == nil {
+			t.Error("loading precinct results matching no contest succeeded")
+		}
+		if update, _ := store.FindUpdate("unmatched", election); update != nil {
+			t.Errorf("precinct results matching no contest left update %+v", update)
+		}
+
+		loadTestUpdate(t, store, election, "precincts", 3,
+			precinctRecord("King County Mayor", "Alice Smith", 40),
+			precinctRecord("King County Mayor", "Bob Jones", 30),
+			precinctRecord("King County Mayor", "Write-in", 1),
+			precinctRecord("Governor", "Carol White", 20))
+		contest, err := store.FindContest(election.ID, getContestKey("Mayor", "King County"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tallies, err := store.PrecinctTallies(contest.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := GroupPrecinctTallies(tallies)
+		if len(results) != 1 || results[0].Precinct.Name != "SEA 11-1234" || results[0].Total != 70 ||
+			results[0].BallotsCounted != 300 || results[0].RegisteredVoters != 500 {
+			t.Errorf("precinct results = %+v, want 70 votes in SEA 11-1234 with its counters", results)
+		}
+	})
+}
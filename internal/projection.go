@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+)
+
+type ProjectionStatus string
+
+const (
+	TooCloseToCall ProjectionStatus = "too_close_to_call"
+	LikelyWinner   ProjectionStatus = "likely"
+	Projected      ProjectionStatus = "projected"
+)
+
+const (
+	// Smallest spread assumed for the leader's net votes per ballot, so that
+	// a few drops that happen to agree don't make the interval too narrow
+	minMarginSpread = 0.02
+	// Spread assumed when there are too few drops to measure it
+	unmeasuredSpread = 0.15
+	// Standard deviations covered by the 95% interval and by a likely call
+	z95     = 1.96
+	zLikely = 1.0
+)
+
+// Projection is a contest's projected final county margin between its top two
+// candidates, extrapolated from the trend of the county drops so far.
+type Projection struct {
+	// First and second place by the votes counted so far
+	Leader       BallotResponse
+	Trailer      BallotResponse
+	LeaderVotes  int
+	TrailerVotes int
+	// Ballots left to count, estimated from the expected turnout. 0 when
+	// unknown, or when Final is set.
+	BallotsOutstanding int
+	// The election is certified, so the current margin is the final one
+	Final bool
+	// Net votes for the leader expected from each outstanding ballot
+	MarginPerBallot float64
+	// Projected final votes of the leader minus the trailer, negative if the
+	// trailer overtakes, with a 95% interval
+	Margin     int
+	MarginLow  int
+	MarginHigh int
+	Status     ProjectionStatus
+}
+
+// Reports whether MarginLow and MarginHigh bound the final margin. They don't
+// when the ballots left to count are unknown before certification, which
+// leaves the contest too close to call.
+func (p Projection) HasInterval() bool {
+	return p.Final || p.BallotsOutstanding > 0
+}
+
+// Returns the candidate projected to finish first.
+func (p Projection) Winner() BallotResponse {
+	if p.Margin < 0 {
+		return p.Trailer
+	}
+	return p.Leader
+}
+
+// Projects a contest from its candidates' county tallies and the election's
+// expected turnout. Once the election is certified the current margin is
+// final. Returns nil when the contest has fewer than two candidates or no
+// county drops.
+func ProjectContest(candidates []BallotResponse, election Election) *Projection {
+	drops := BallotDrops(candidates)
+	if len(drops) == 0 {
+		return nil
+	}
+	if election.CertifiedAt != nil {
+		p := ProjectDrops(candidates, drops, 0)
+		if p != nil {
+			p.Final = true
+			p.Status = Projected
+		}
+		return p
+	}
+	return ProjectDrops(candidates, drops, estimateOutstanding(drops[len(drops)-1], election.ExpectedTurnout))
+}
+
+// Projects the final margin after drops with outstanding ballots left to
+// count. The leader's net votes per ballot in each drop are fitted with a
+// line against the ballots counted, weighted by the drop's size, and the
+// line is followed to the middle of the outstanding ballots. The interval
+// comes from how far the drops stray from the line. The first drop, which
+// is mostly early ballots, is left out of the fit once there are enough
+// later ones. With no outstanding ballots, which is how an unknown count
+// comes in, the margin stays at the current one and the contest is too close
+// to call.
+func ProjectDrops(candidates []BallotResponse, drops []BallotDrop, outstanding int) *Projection {
+	if len(candidates) < 2 || len(drops) == 0 {
+		return nil
+	}
+	totals := countedVotes(drops)
+	leader, trailer := topTwo(candidates, totals)
+	p := &Projection{
+		Leader:             leader,
+		Trailer:            trailer,
+		LeaderVotes:        totals[leader.ID],
+		TrailerVotes:       totals[trailer.ID],
+		BallotsOutstanding: outstanding,
+	}
+	current := p.LeaderVotes - p.TrailerVotes
+	if outstanding <= 0 {
+		p.Margin, p.MarginLow, p.MarginHigh = current, current, current
+		p.Status = TooCloseToCall
+		return p
+	}
+
+	rate, spread := marginTrend(drops, leader.ID, trailer.ID, outstanding)
+	p.MarginPerBallot = rate
+	remaining := float64(outstanding)
+	p.Margin = current + int(math.Round(remaining*rate))
+	p.MarginLow = current + int(math.Round(remaining*(rate-z95*spread)))
+	p.MarginHigh = current + int(math.Round(remaining*(rate+z95*spread)))
+
+	likelyLow := float64(current) + remaining*(rate-zLikely*spread)
+	likelyHigh := float64(current) + remaining*(rate+zLikely*spread)
+	switch {
+	case p.MarginLow > 0 || p.MarginHigh < 0:
+		p.Status = Projected
+	case likelyLow > 0 || likelyHigh < 0:
+		p.Status = LikelyWinner
+	default:
+		p.Status = TooCloseToCall
+	}
+	return p
+}
+
+// Returns the leader's expected net votes per outstanding ballot and its
+// standard deviation.
+func marginTrend(drops []BallotDrop, leaderID uint, trailerID uint, outstanding int) (float64, float64) {
+	type point struct{ x, y, w float64 }
+	var points []point
+	for _, drop := range drops {
+		if drop.BallotsAdded <= 0 {
+			continue
+		}
+		points = append(points, point{
+			x: float64(drop.BallotsCounted) - float64(drop.BallotsAdded)/2,
+			y: float64(drop.VotesAdded[leaderID]-drop.VotesAdded[trailerID]) / float64(drop.BallotsAdded),
+			w: float64(drop.BallotsAdded),
+		})
+	}
+	if len(points) > 3 {
+		points = points[1:]
+	}
+	if len(points) == 0 {
+		return 0, unmeasuredSpread
+	}
+
+	var sw, sx, sy float64
+	for _, p := range points {
+		sw += p.w
+		sx += p.w * p.x
+		sy += p.w * p.y
+	}
+	meanX, meanY := sx/sw, sy/sw
+	slope, fitted := 0.0, 1
+	if len(points) >= 3 {
+		fitted = 2
+		var sxy, sxx float64
+		for _, p := range points {
+			sxy += p.w * (p.x - meanX) * (p.y - meanY)
+			sxx += p.w * (p.x - meanX) * (p.x - meanX)
+		}
+		if sxx > 0 {
+			slope = sxy / sxx
+		}
+	}
+
+	spread := unmeasuredSpread
+	if n := len(points); n > fitted {
+		var residuals float64
+		for _, p := range points {
+			r := p.y - (meanY + slope*(p.x-meanX))
+			residuals += p.w * r * r
+		}
+		spread = max(math.Sqrt(residuals/sw*float64(n)/float64(n-fitted)), minMarginSpread)
+	}
+
+	last := drops[len(drops)-1].BallotsCounted
+	target := float64(last) + float64(outstanding)/2
+	rate := meanY + slope*(target-meanX)
+	// A net margin per ballot can't be beyond every ballot going one way
+	return max(-1, min(1, rate)), spread
+}
+
+// BacktestScore is how the projections with one status fared in a backtest.
+type BacktestScore struct {
+	Status      ProjectionStatus
+	Projections int
+	// Projections whose winner matched the final count
+	CorrectWinner int
+	// Projections whose 95% interval held the final margin
+	WithinInterval int
+	// Sum of the differences between projected and final margins
+	AbsoluteError int
+}
+
+// Replays an election's county drops: after every drop but the last, each
+// contest is projected from the drops so far and compared with its final
+// county count. The outstanding ballots are the ones the county went on to
+// count, so the backtest measures the trend model rather than the turnout
+// estimate. Returns a score for each status.
+func Backtest(store Store, election Election) ([]BacktestScore, error) {
+	contests, err := store.ListContests(election.ID)
+	if err != nil {
+		return nil, err
+	}
+	scores := map[ProjectionStatus]*BacktestScore{
+		Projected:      {Status: Projected},
+		LikelyWinner:   {Status: LikelyWinner},
+		TooCloseToCall: {Status: TooCloseToCall},
+	}
+	for _, contest := range contests {
+		candidates, err := store.ContestCandidates(contest.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching candidates for %s: %v", contest.ContestKey, err)
+		}
+		drops := BallotDrops(candidates)
+		if len(drops) < 2 {
+			continue
+		}
+		final := drops[len(drops)-1]
+		finalVotes := countedVotes(drops)
+		for i := range len(drops) - 1 {
+			outstanding := final.BallotsCounted - drops[i].BallotsCounted
+			if outstanding <= 0 {
+				continue
+			}
+			p := ProjectDrops(candidates, drops[:i+1], outstanding)
+			if p == nil {
+				continue
+			}
+			finalMargin := finalVotes[p.Leader.ID] - finalVotes[p.Trailer.ID]
+			score := scores[p.Status]
+			score.Projections++
+			if (p.Margin > 0) == (finalMargin > 0) {
+				score.CorrectWinner++
+			}
+			if p.MarginLow <= finalMargin && finalMargin <= p.MarginHigh {
+				score.WithinInterval++
+			}
+			score.AbsoluteError += abs(p.Margin - finalMargin)
+		}
+	}
+	return []BacktestScore{*scores[Projected], *scores[LikelyWinner], *scores[TooCloseToCall]}, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+// Two candidates with a county tally each for every drop, of 100000
+// registered voters.
+func projectionCandidates(drops ...[2]int) []BallotResponse {
+	candidates := []BallotResponse{{Name: "Alice"}, {Name: "Bob"}}
+	candidates[0].ID, candidates[1].ID = 1, 2
+	counted := 0
+	for i, votes := range drops {
+		update := Update{Timestamp: testElectionDate.Add(time.Duration(i) * time.Hour), JurisdictionType: CountyJurisdiction}
+		update.ID = uint(i + 1)
+		counted = votes[0] + votes[1]
+		for j := range candidates {
+			candidates[j].VoteTallies = append(candidates[j].VoteTallies, VoteTally{
+				UpdateID:         update.ID,
+				Update:           update,
+				Votes:            votes[j],
+				BallotsCounted:   counted,
+				RegisteredVoters: 100000,
+			})
+		}
+	}
+	return candidates
+}
+
+func TestProjectContest(t *testing.T) {
+	certified := testElectionDate.Add(30 * 24 * time.Hour)
+	drops := [][2]int{{6000, 4000}, {12000, 8000}, {18000, 12000}}
+	tests := []struct {
+		name         string
+		election     Election
+		status       ProjectionStatus
+		final        bool
+		outstanding  int
+		withInterval bool
+	}{
+		{"unknown turnout", Election{}, TooCloseToCall, false, 0, false},
+		{"count past the expected turnout", Election{ExpectedTurnout: 20}, TooCloseToCall, false, 0, false},
+		{"ballots left", Election{ExpectedTurnout: 40}, Projected, false, 10000, true},
+		{"certified without turnout", Election{CertifiedAt: &certified}, Projected, true, 0, true},
+		{"certified past the expected turnout", Election{ExpectedTurnout: 20, CertifiedAt: &certified}, Projected, true, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := ProjectContest(projectionCandidates(drops...), test.election)
+			if p == nil {
+				t.Fatal("no projection")
+			}
+			if p.Status != test.status || p.Final != test.final || p.BallotsOutstanding != test.outstanding || p.HasInterval() != test.withInterval {
+				t.Errorf("projection = %v final %v, %v outstanding, interval %v; want %v final %v, %v outstanding, interval %v",
+					p.Status, p.Final, p.BallotsOutstanding, p.HasInterval(), test.status, test.final, test.outstanding, test.withInterval)
+			}
+			if p.Winner().Name != "Alice" {
+				t.Errorf("winner = %s, want Alice", p.Winner().Name)
+			}
+			if !test.withInterval && p.Margin != 6000 {
+				t.Errorf("margin = %v, want the current margin 6000", p.Margin)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RecountRule is a recount a contest gets when the margin between its first
+// and second place candidates is under both limits.
+type RecountRule struct {
+	Name     string
+	MaxVotes int
+	// Percentage of the votes cast for the two candidates
+	MaxPercent float64
+}
+
+// Washington's mandatory recounts (RCW 29A.64.021), strictest first.
+var WashingtonRecountRules = []RecountRule{
+	{Name: "hand", MaxVotes: 150, MaxPercent: 0.25},
+	{Name: "machine", MaxVotes: 2000, MaxPercent: 0.5},
+}
+
+// Parses rules written as name:votes:percent and separated by commas, for
+// example "hand:150:0.25,machine:2000:0.5". List the strictest rule first.
+func ParseRecountRules(s string) ([]RecountRule, error) {
+	var rules []RecountRule
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid recount rule %q: expected name:votes:percent", field)
+		}
+		votes, err := strconv.Atoi(parts[1])
+		if err != nil || votes < 0 {
+			return nil, fmt.Errorf("invalid vote limit in recount rule %q", field)
+		}
+		percent, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || percent < 0 {
+			return nil, fmt.Errorf("invalid percent limit in recount rule %q", field)
+		}
+		rules = append(rules, RecountRule{Name: parts[0], MaxVotes: votes, MaxPercent: percent})
+	}
+	return rules, nil
+}
+
+// Returns the rules set in the RECOUNT_RULES environment variable, or
+// Washington's if it isn't set.
+func RecountRulesFromEnv() ([]RecountRule, error) {
+	if s := os.Getenv("RECOUNT_RULES"); s != "" {
+		return ParseRecountRules(s)
+	}
+	return WashingtonRecountRules, nil
+}
+
+// ContestMargin is the margin between a contest's first and second place
+// candidates in its current results, or second and third in a top-two primary.
+type ContestMargin struct {
+	Contest  Contest
+	Leader   ContestResult
+	RunnerUp ContestResult
+	Margin   int
+	// Margin as a percentage of the votes cast for the two candidates
+	MarginPercent float64
+	// The first rule the margin falls under, nil if none
+	Recount *RecountRule
+	// Whether Leader and RunnerUp are second and third place in a top-two
+	// primary
+	ForSecond bool
+}
+
+func (m ContestMargin) String() string {
+	s := fmt.Sprintf("%s (%s): %s leads %s by %d votes (%.2f%%)",
+		m.Contest.BallotTitle, m.Contest.District, m.Leader.BallotResponse.Name, m.RunnerUp.BallotResponse.Name, m.Margin, m.MarginPercent)
+	if m.ForSecond {
+		s += " for second place"
+	}
+	if m.Recount != nil {
+		s += ", " + m.Recount.Name + " recount"
+	}
+	return s
+}
+
+// Works out the margin of a contest from its current results, ordered by
+// rank. In a top-two primary the margin that decides who advances is between
+// second and third place, so that is the one checked for candidate contests.
+// Contest is taken from the results, so it is only set when they were loaded
+// with it, as ElectionResults does. Returns nil for contests with fewer than
+// two candidates, top-two contests without a third, or no votes.
+func CheckRecount(results []ContestResult, rules []RecountRule, topTwo bool) *ContestMargin {
+	if topTwo {
+		if t := CheckTopTwo(results); t != nil {
+			if t.Third == nil {
+				return nil
+			}
+			m := checkMargin(t.Advancing[1], *t.Third, rules)
+			if m != nil {
+				m.ForSecond = true
+			}
+			return m
+		}
+	}
+	if len(results) < 2 {
+		return nil
+	}
+	return checkMargin(results[0], results[1], rules)
+}
+
+func checkMargin(above ContestResult, below ContestResult, rules []RecountRule) *ContestMargin {
+	if above.Votes+below.Votes == 0 {
+		return nil
+	}
+	m := &ContestMargin{
+		Contest:  above.Contest,
+		Leader:   above,
+		RunnerUp: below,
+		Margin:   above.Votes - below.Votes,
+	}
+	m.MarginPercent = float64(m.Margin) * 100 / float64(above.Votes+below.Votes)
+	for i, rule := range rules {
+		if m.Margin < rule.MaxVotes && m.MarginPercent < rule.MaxPercent {
+			m.Recount = &rules[i]
+			break
+		}
+	}
+	return m
+}
+
+// Returns the margins of the contests whose results fall under a recount
+// rule, smallest margin first. results are an election's current results, as
+// returned by ElectionResults.
+func CloseRaces(results []ContestResult, rules []RecountRule, topTwo bool) []ContestMargin {
+	races := []ContestMargin{}
+	for _, contestResults := range resultsByContest(results) {
+		if m := CheckRecount(contestResults, rules, topTwo); m != nil && m.Recount != nil {
+			races = append(races, *m)
+		}
+	}
+	slices.SortFunc(races, func(a, b ContestMargin) int {
+		return cmp.Or(
+			cmp.Compare(a.Margin, b.Margin),
+			cmp.Compare(a.MarginPercent, b.MarginPercent),
+			cmp.Compare(a.Contest.ContestKey, b.Contest.ContestKey),
+		)
+	})
+	return races
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+// Returns the results of a contest, ranked in the order given.
+func testContestResults(contestID uint, names []string, votes ...int) []ContestResult {
+	results := make([]ContestResult, len(names))
+	for i, name := range names {
+		results[i] = ContestResult{
+			ContestID:        contestID,
+			Contest:          Contest{ContestKey: name + "-contest"},
+			BallotResponseID: contestID*100 + uint(i),
+			BallotResponse:   BallotResponse{Name: name},
+			Votes:            votes[i],
+			Rank:             i + 1,
+		}
+	}
+	rankContestResults(results)
+	return results
+}
+
+func TestCheckRecount(t *testing.T) {
+	people := []string{"Alice", "Bob", "Carol"}
+	tests := []struct {
+		name      string
+		names     []string
+		votes     []int
+		topTwo    bool
+		margin    int
+		recount   string
+		forSecond bool
+		none      bool
+	}{
+		{name: "hand", names: people[:2], votes: []int{100000, 99851}, margin: 149, recount: "hand"},
+		{name: "150 votes is a machine recount", names: people[:2], votes: []int{100000, 99850}, margin: 150, recount: "machine"},
+		{name: "under 0.25%", names: people[:2], votes: []int{20049, 19951}, margin: 98, recount: "hand"},
+		{name: "0.25% is a machine recount", names: people[:2], votes: []int{20050, 19950}, margin: 100, recount: "machine"},
+		{name: "under 2000 votes", names: people[:2], votes: []int{1000000, 998001}, margin: 1999, recount: "machine"},
+		{name: "2000 votes", names: people[:2], votes: []int{1000000, 998000}, margin: 2000},
+		{name: "under 0.5%", names: people[:2], votes: []int{50249, 49751}, margin: 498, recount: "machine"},
+		{name: "0.5%", names: people[:2], votes: []int{50250, 49750}, margin: 500},
+		{name: "landslide", names: people[:2], votes: []int{600, 400}, margin: 200},
+		{name: "tie", names: people[:2], votes: []int{500, 500}, margin: 0, recount: "hand"},
+		{name: "one candidate", names: people[:1], votes: []int{500}, none: true},
+		{name: "no votes", names: people[:2], votes: []int{0, 0}, none: true},
+		{name: "top two margin is second to third", names: people, votes: []int{5000, 3000, 2990}, topTwo: true, margin: 10, recount: "hand", forSecond: true},
+		{name: "top two with a clear second", names: people, votes: []int{5000, 3000, 1000}, topTwo: true, margin: 2000, forSecond: true},
+		{name: "top two without a third", names: people[:2], votes: []int{5000, 4990}, topTwo: true, none: true},
+		{name: "top two skips write-ins", names: []string{"Alice", "Bob", "Write-in", "Carol"}, votes: []int{5000, 3000, 2999, 2995}, topTwo: true, margin: 5, recount: "hand", forSecond: true},
+		{name: "top two measure", names: []string{"Yes", "No"}, votes: []int{5000, 4990}, topTwo: true, margin: 10, recount: "hand"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := CheckRecount(testContestResults(1, test.names, test.votes...), WashingtonRecountRules, test.topTwo)
+			if test.none {
+				if m != nil {
+					t.Errorf("CheckRecount = %v, want nil", m)
+				}
+				return
+			}
+			if m == nil {
+				t.Fatal("CheckRecount = nil")
+			}
+			recount := ""
+			if m.Recount != nil {
+				recount = m.Recount.Name
+			}
+			if m.Margin != test.margin || recount != test.recount || m.ForSecond != test.forSecond {
+				t.Errorf("CheckRecount = margin %d, recount %q, for second %v; want %d, %q, %v",
+					m.Margin, recount, m.ForSecond, test.margin, test.recount, test.forSecond)
+			}
+		})
+	}
+}
+
+func TestCloseRaces(t *testing.T) {
+	var results []ContestResult
+	results = append(results, testContestResults(1, []string{"Alice", "Bob"}, 1000000, 998500)...)
+	results = append(results, testContestResults(2, []string{"Carol", "Dan"}, 600, 400)...)
+	results = append(results, testContestResults(3, []string{"Erin", "Frank"}, 20000, 19990)...)
+	results = append(results, testContestResults(4, []string{"Yes", "No"}, 30000, 29900)...)
+	// Listed out of rank order, as ElectionResults doesn't sort within a contest
+	slices.Reverse(results)
+
+	var got []string
+	for _, race := range CloseRaces(results, WashingtonRecountRules, false) {
+		got = append(got, race.Leader.BallotResponse.Name+" "+race.Recount.Name)
+	}
+	if want := []string{"Erin hand", "Yes hand", "Alice machine"}; !slices.Equal(got, want) {
+		t.Errorf("CloseRaces = %v, want %v", got, want)
+	}
+	if races := CloseRaces(nil, WashingtonRecountRules, false); races == nil || len(races) != 0 {
+		t.Errorf("CloseRaces(nil) = %#v, want an empty list", races)
+	}
+}
+
+func TestParseRecountRules(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []RecountRule
+		wantErr bool
+	}{
+		{s: "hand:150:0.25,machine:2000:0.5", want: WashingtonRecountRules},
+		{s: " close:10:1 , closer:5:0.5 ", want: []RecountRule{{Name: "close", MaxVotes: 10, MaxPercent: 1}, {Name: "closer", MaxVotes: 5, MaxPercent: 0.5}}},
+		{s: "", wantErr: true},
+		{s: "hand:150", wantErr: true},
+		{s: ":150:0.25", wantErr: true},
+		{s: "hand:many:0.25", wantErr: true},
+		{s: "hand:-1:0.25", wantErr: true},
+		{s: "hand:150:-0.25", wantErr: true},
+		{s: "hand:150:0.25,", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseRecountRules(test.s)
+		if !slices.Equal(got, test.want) || (err != nil) != test.wantErr {
+			t.Errorf("ParseRecountRules(%q) = %v, %v; want %v, error %v", test.s, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestRecountRulesFromEnv(t *testing.T) {
+	t.Setenv("RECOUNT_RULES", "")
+	if rules, err := RecountRulesFromEnv(); err != nil || !slices.Equal(rules, WashingtonRecountRules) {
+		t.Errorf("RecountRulesFromEnv() without RECOUNT_RULES = %v, %v; want Washington's", rules, err)
+	}
+	t.Setenv("RECOUNT_RULES", "close:10:1")
+	if rules, err := RecountRulesFromEnv(); err != nil || !slices.Equal(rules, []RecountRule{{Name: "close", MaxVotes: 10, MaxPercent: 1}}) {
+		t.Errorf("RecountRulesFromEnv() = %v, %v", rules, err)
+	}
+	t.Setenv("RECOUNT_RULES", "close")
+	if _, err := RecountRulesFromEnv(); err == nil {
+		t.Error("RecountRulesFromEnv() accepted an invalid rule")
+	}
+}
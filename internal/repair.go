@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Databases loaded before contests and ballot responses had unique keys
+// (idx_contest_election_key and idx_ballot_response_contest_name) can hold
+// duplicates of both, and vote tallies that were matched to a contest of
+// another election with the same title. repairIdentities cleans them up so
+// that AutoMigrate can build the indexes.
+func (db *DB) repairIdentities() error {
+	m := db.Migrator()
+	if !m.HasTable(&Contest{}) || !m.HasTable(&BallotResponse{}) {
+		return nil
+	}
+	if m.HasIndex(&Contest{}, "idx_contest_election_key") && m.HasIndex(&BallotResponse{}, "idx_ballot_response_contest_name") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		contests, err := mergeDuplicateContests(tx)
+		if err != nil {
+			return err
+		}
+		moved, err := moveMisfiledTallies(tx)
+		if err != nil {
+			return err
+		}
+		responses, err := mergeDuplicateResponses(tx)
+		if err != nil {
+			return err
+		}
+		if contests+moved+responses == 0 {
+			return nil
+		}
+		log.Printf("Repaired %d duplicate contests, %d duplicate candidates and %d tallies filed under another election", contests, responses, moved)
+		// Contest results are rebuilt from the tallies by backfillContestResults
+		if tx.Migrator().HasTable(&ContestResult{}) {
+			if err := tx.Where("1 = 1").Delete(&ContestResult{}).Error; err != nil {
+				return fmt.Errorf("error clearing contest results: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// A row of contests or ballot_responses and the key it should be unique on.
+type identityRow struct {
+	ID      uint
+	Key     string
+	Deleted bool
+}
+
+// Groups rows by key. The first row of each group is kept: the oldest live
+// one, or the oldest soft-deleted one when none are live. Returns the live
+// duplicates to merge into their group's kept row, and the soft-deleted
+// duplicates to drop.
+func duplicateIdentities(rows []identityRow) (merge map[uint]uint, drop []uint) {
+	merge = make(map[uint]uint)
+	kept := make(map[string]identityRow)
+	for _, row := range rows {
+		keeper, ok := kept[row.Key]
+		switch {
+		case !ok:
+			kept[row.Key] = row
+		case row.Deleted:
+			drop = append(drop, row.ID)
+		case keeper.Deleted:
+			drop = append(drop, keeper.ID)
+			kept[row.Key] = row
+		default:
+			merge[row.ID] = keeper.ID
+		}
+	}
+	return merge, drop
+}
+
+// Points every row of tables whose column holds a key of ids at its value.
+func repointRows(tx *gorm.DB, tables []string, column string, ids map[uint]uint) error {
+	for _, table := range tables {
+		if !tx.Migrator().HasTable(table) {
+			continue
+		}
+		for from, to := range ids {
+			if err := tx.Table(table).Where(column+" = ?", from).Update(column, to).Error; err != nil {
+				return fmt.Errorf("error repointing %s.%s: %v", table, column, err)
+			}
+		}
+	}
+	return nil
+}
+
+func deleteIdentities(tx *gorm.DB, model any, ids []uint) error {
+	for batch := range slices.Chunk(ids, 500) {
+		if err := tx.Unscoped().Delete(model, batch).Error; err != nil {
+			return fmt.Errorf("error deleting duplicates: %v", err)
+		}
+	}
+	return nil
+}
+
+// Merges contests that share an election and contest key.
+func mergeDuplicateContests(tx *gorm.DB) (int, error) {
+	var rows []identityRow
+	if err := tx.Unscoped().Model(&Contest{}).
+		Select("id, election_id || '/' || contest_key AS key, deleted_at IS NOT NULL AS deleted").
+		Order("id").Scan(&rows).Error; err != nil {
+		return 0, fmt.Errorf("error finding duplicate contests: %v", err)
+	}
+	merge, drop := duplicateIdentities(rows)
+	tables := []string{"ballot_responses", "vote_tallies", "county_tallies", "precinct_tallies"}
+	if err := repointRows(tx, tables, "contest_id", merge); err != nil {
+		return 0, err
+	}
+	for id := range merge {
+		drop = append(drop, id)
+	}
+	return len(drop), deleteIdentities(tx, &Contest{}, drop)
+}
+
+// Merges ballot responses that share a contest and name.
+func mergeDuplicateResponses(tx *gorm.DB) (int, error) {
+	var rows []identityRow
+	if err := tx.Unscoped().Model(&BallotResponse{}).
+		Select("id, CAST(contest_id AS TEXT) || '/' || name AS key, deleted_at IS NOT NULL AS deleted").
+		Order("id").Scan(&rows).Error; err != nil {
+		return 0, fmt.Errorf("error finding duplicate candidates: %v", err)
+	}
+	merge, drop := duplicateIdentities(rows)
+	tables := []string{"vote_tallies", "county_tallies", "precinct_tallies"}
+	if err := repointRows(tx, tables, "ballot_response_id", merge); err != nil {
+		return 0, err
+	}
+	for id := range merge {
+		drop = append(drop, id)
+	}
+	return len(drop), deleteIdentities(tx, &BallotResponse{}, drop)
+}
+
+// Moves vote tallies whose contest belongs to another election than their
+// update to the same contest and ballot response of the update's election,
+// creating them when that election doesn't have them.
+func moveMisfiledTallies(tx *gorm.DB) (int, error) {
+	var misfiled []struct {
+		ID               uint
+		ElectionID       string
+		ContestID        uint
+		BallotResponseID uint
+	}
+	if err := tx.Table("vote_tallies t").
+		Select("t.id, u.election_id, t.contest_id, t.ballot_response_id").
+		Joins("JOIN updates u ON u.id = t.update_id").
+		Joins("JOIN contests c ON c.id = t.contest_id").
+		Where("c.election_id <> u.election_id").
+		Order("t.id").Scan(&misfiled).Error; err != nil {
+		return 0, fmt.Errorf("error finding misfiled tallies: %v", err)
+	}
+	type target struct {
+		electionID string
+		responseID uint
+	}
+	moved := make(map[target]BallotResponse)
+	for _, tally := range misfiled {
+		t := target{tally.ElectionID, tally.BallotResponseID}
+		response, ok := moved[t]
+		if !ok {
+			var err error
+			if response, err = rehomeResponse(tx, tally.ElectionID, tally.ContestID, tally.BallotResponseID); err != nil {
+				return 0, err
+			}
+			moved[t] = response
+		}
+		if err := tx.Table("vote_tallies").Where("id = ?", tally.ID).Updates(map[string]any{
+			"contest_id":         response.ContestID,
+			"ballot_response_id": response.ID,
+		}).Error; err != nil {
+			return 0, fmt.Errorf("error moving tally %v: %v", tally.ID, err)
+		}
+	}
+	return len(misfiled), nil
+}
+
+// Returns the copy in electionID of a contest and ballot response of another
+// election, creating them if needed. Runs before AutoMigrate, so only the
+// columns that databases from before the unique keys have are written.
+func rehomeResponse(tx *gorm.DB, electionID string, contestID uint, responseID uint) (BallotResponse, error) {
+	var original Contest
+	if err := tx.Unscoped().Select("ballot_title, district, contest_key, jurisdictions").First(&original, contestID).Error; err != nil {
+		return BallotResponse{}, fmt.Errorf("error fetching contest %v: %v", contestID, err)
+	}
+	var originalResponse BallotResponse
+	if err := tx.Unscoped().Select("name, party").First(&originalResponse, responseID).Error; err != nil {
+		return BallotResponse{}, fmt.Errorf("error fetching candidate %v: %v", responseID, err)
+	}
+	newContestID, err := findOrCreateRow(tx, "contests",
+		map[string]any{"election_id": electionID, "contest_key": original.ContestKey},
+		map[string]any{"ballot_title": original.BallotTitle, "district": original.District, "jurisdictions": original.Jurisdictions})
+	if err != nil {
+		return BallotResponse{}, err
+	}
+	newResponseID, err := findOrCreateRow(tx, "ballot_responses",
+		map[string]any{"contest_id": newContestID, "name": originalResponse.Name},
+		map[string]any{"party": originalResponse.Party, "election_id": electionID})
+	if err != nil {
+		return BallotResponse{}, err
+	}
+	response := BallotResponse{Name: originalResponse.Name, ContestID: newContestID, ElectionID: electionID}
+	response.ID = newResponseID
+	return response, nil
+}
+
+// Returns the ID of the oldest row of table matching key, soft-deleted or not,
+// inserting one with key and values when there is none.
+func findOrCreateRow(tx *gorm.DB, table string, key map[string]any, values map[string]any) (uint, error) {
+	find := func() ([]uint, error) {
+		var ids []uint
+		err := tx.Table(table).Where(key).Order("id").Limit(1).Pluck("id", &ids).Error
+		return ids, err
+	}
+	ids, err := find()
+	if err != nil {
+		return 0, fmt.Errorf("error looking up %s %v: %v", table, key, err)
+	}
+	if len(ids) > 0 {
+		return ids[0], nil
+	}
+	now := time.Now()
+	row := map[string]any{"created_at": now, "updated_at": now}
+	maps.Copy(row, key)
+	maps.Copy(row, values)
+	if err := tx.Table(table).Create(row).Error; err != nil {
+		return 0, fmt.Errorf("error creating %s %v: %v", table, key, err)
+	}
+	if ids, err = find(); err != nil || len(ids) == 0 {
+		return 0, fmt.Errorf("error looking up created %s %v: %v", table, key, err)
+	}
+	return ids[0], nil
+}
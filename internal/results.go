@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ContestResult holds a candidate's latest standing in a contest for one
+// jurisdiction type. The table is rebuilt for the affected contests in the
+// same transaction that loads or removes an Update, so pages can read it
+// directly instead of scanning every VoteTally.
+type ContestResult struct {
+	ContestID        uint             `gorm:"primaryKey"`
+	BallotResponseID uint             `gorm:"primaryKey"`
+	JurisdictionType JurisdictionType `gorm:"primaryKey"`
+	Contest          Contest          `gorm:"constraint:OnDelete:CASCADE"`
+	BallotResponse   BallotResponse   `gorm:"constraint:OnDelete:CASCADE"`
+	ElectionID       string           `gorm:"index"`
+	UpdateID         uint
+	Votes            int
+	// Share of all votes in the contest, from 0 to 100
+	Percent float64
+	// 1 for the leading candidate
+	Rank int
+	// Votes ahead of the next ranked candidate, 0 for the last candidate
+	MarginToNext int
+	// Timestamp of the update the votes came from
+	Timestamp time.Time
+}
+
+// Contests are selected with a condition on contest_id; the statements are
+// written with ? placeholders so they can run through gorm or, after
+// pgPlaceholders, directly on a pgx connection.
+const deleteContestResultsSQL = `
+	DELETE FROM contest_results
+	WHERE jurisdiction_type = ? AND %s`
+
+const insertContestResultsSQL = `
+	INSERT INTO contest_results (contest_id, ballot_response_id, jurisdiction_type, election_id, update_id, votes, percent, rank, margin_to_next, "timestamp")
+	SELECT contest_id, ballot_response_id, jurisdiction_type, election_id, update_id, votes,
+		COALESCE(CAST(votes AS REAL) * 100 / NULLIF(SUM(votes) OVER (PARTITION BY contest_id), 0), 0),
+		ROW_NUMBER() OVER (PARTITION BY contest_id ORDER BY votes DESC, ballot_response_id),
+		votes - COALESCE(LEAD(votes) OVER (PARTITION BY contest_id ORDER BY votes DESC, ballot_response_id), votes),
+		"timestamp"
+	FROM (
+		SELECT t.contest_id, t.ballot_response_id, u.jurisdiction_type, u.election_id, t.update_id, t.votes, u."timestamp",
+			ROW_NUMBER() OVER (PARTITION BY t.ballot_response_id ORDER BY u."timestamp" DESC, u.id DESC) AS n
+		FROM vote_tallies t
+		JOIN updates u ON u.id = t.update_id
+		WHERE u.jurisdiction_type = ? AND u.deleted_at IS NULL AND u.retracted_at IS NULL AND t.deleted_at IS NULL AND t.%s
+	) latest
+	WHERE n = 1`
+
+// Limits a refresh to the contests with tallies in a given update
+const updateContestsScope = "contest_id IN (SELECT contest_id FROM vote_tallies WHERE update_id = ?)"
+
+// Limits a refresh to the contests of an election
+const electionContestsScope = "contest_id IN (SELECT id FROM contests WHERE election_id = ?)"
+
+func contestResultsSQL(scope string) (string, string) {
+	return fmt.Sprintf(deleteContestResultsSQL, scope), fmt.Sprintf(insertContestResultsSQL, scope)
+}
+
+// Rewrites ? placeholders as $1, $2, ... for use with pgx.
+func pgPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Recomputes the results of every contest touched by an update.
+func refreshUpdateResults(tx *gorm.DB, jType JurisdictionType, updateID uint) error {
+	deleteSQL, insertSQL := contestResultsSQL(updateContestsScope)
+	if err := tx.Exec(deleteSQL, jType, updateID).Error; err != nil {
+		return fmt.Errorf("error clearing contest results: %v", err)
+	}
+	if err := tx.Exec(insertSQL, jType, updateID).Error; err != nil {
+		return fmt.Errorf("error computing contest results: %v", err)
+	}
+	return nil
+}
+
+// Recomputes the results of every contest in an election from its tallies.
+func (db *DB) RebuildContestResults(election Election) error {
+	deleteSQL, insertSQL := contestResultsSQL(electionContestsScope)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, jType := range []JurisdictionType{StateJurisdiction, CountyJurisdiction} {
+			if err := tx.Exec(deleteSQL, jType, election.ID).Error; err != nil {
+				return fmt.Errorf("error clearing contest results for %s: %v", election.ID, err)
+			}
+			if err := tx.Exec(insertSQL, jType, election.ID).Error; err != nil {
+				return fmt.Errorf("error computing contest results for %s: %v", election.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Returns the current results of a contest ordered by rank. When the contest
+// has results from both the state and the county, the jurisdiction with the
+// most recent update is used.
+func (db *DB) CurrentResults(contestID uint) ([]ContestResult, error) {
+	var results []ContestResult
+	if err := db.Where("contest_id = ?", contestID).
+		Preload("BallotResponse.CanonicalParty").
+		Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("error fetching results for contest %v: %v", contestID, err)
+	}
+	if len(results) == 0 {
+		return []ContestResult{}, nil
+	}
+	latest, err := db.latestUpdates(results[0].ElectionID)
+	if err != nil {
+		return nil, err
+	}
+	return currentResults(results, latest), nil
+}
+
+// Returns the timestamp of each jurisdiction's latest visible update in an
+// election.
+func (db *DB) latestUpdates(electionID string) (map[JurisdictionType]time.Time, error) {
+	var updates []Update
+	if err := db.Select(`jurisdiction_type, "timestamp"`).Where("election_id = ? AND retracted_at IS NULL", electionID).
+		Find(&updates).Error; err != nil {
+		return nil, fmt.Errorf("error fetching updates for %s: %v", electionID, err)
+	}
+	return latestUpdates(updates), nil
+}
+
+func latestUpdates(updates []Update) map[JurisdictionType]time.Time {
+	latest := make(map[JurisdictionType]time.Time)
+	for _, update := range updates {
+		if update.RetractedAt == nil && update.Timestamp.After(latest[update.JurisdictionType]) {
+			latest[update.JurisdictionType] = update.Timestamp
+		}
+	}
+	return latest
+}
+
+// Returns the current results of every contest in an election, with their
+// Contest and BallotResponse, ordered by contest key and then rank.
+func (db *DB) ElectionResults(electionID string) ([]ContestResult, error) {
+	var results []ContestResult
+	if err := db.Where("election_id = ?", electionID).
+		Preload("Contest").
+		Preload("BallotResponse.CanonicalParty").
+		Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("error fetching results for %s: %v", electionID, err)
+	}
+	latest, err := db.latestUpdates(electionID)
+	if err != nil {
+		return nil, err
+	}
+	return currentElectionResults(results, latest), nil
+}
+
+// Applies currentResults to each contest in results.
+func currentElectionResults(results []ContestResult, latest map[JurisdictionType]time.Time) []ContestResult {
+	byContest := make(map[uint][]ContestResult)
+	for _, result := range results {
+		byContest[result.ContestID] = append(byContest[result.ContestID], result)
+	}
+	current := []ContestResult{}
+	for _, contestResults := range byContest {
+		current = append(current, currentResults(contestResults, latest)...)
+	}
+	slices.SortFunc(current, func(a, b ContestResult) int {
+		if c := strings.Compare(a.Contest.ContestKey, b.Contest.ContestKey); c != 0 {
+			return c
+		}
+		return a.Rank - b.Rank
+	})
+	return current
+}
+
+// Picks the results of the jurisdiction with the most recent update, preferring
+// the state on a tie, and orders them by rank. Updates leave out the contests
+// that haven't changed, so a jurisdiction's results are as recent as its
+// latest update in latest rather than the tallies they came from.
+func currentResults(results []ContestResult, latest map[JurisdictionType]time.Time) []ContestResult {
+	reported := func(result ContestResult) time.Time {
+		if timestamp := latest[result.JurisdictionType]; timestamp.After(result.Timestamp) {
+			return timestamp
+		}
+		return result.Timestamp
+	}
+	var source *ContestResult
+	for i, result := range results {
+		if source == nil || reported(result).After(reported(*source)) ||
+			(reported(result).Equal(reported(*source)) && result.JurisdictionType == StateJurisdiction) {
+			source = &results[i]
+		}
+	}
+	current := []ContestResult{}
+	for _, result := range results {
+		if result.JurisdictionType == source.JurisdictionType {
+			current = append(current, result)
+		}
+	}
+	slices.SortFunc(current, func(a, b ContestResult) int { return a.Rank - b.Rank })
+	return current
+}
+
+// Fills in the percent, rank and margin of one contest's latest results, the
+// same way insertContestResultsSQL does.
+func rankContestResults(results []ContestResult) {
+	slices.SortFunc(results, func(a, b ContestResult) int {
+		if a.Votes != b.Votes {
+			return b.Votes - a.Votes
+		}
+		return int(a.BallotResponseID) - int(b.BallotResponseID)
+	})
+	total := 0
+	for _, result := range results {
+		total += result.Votes
+	}
+	for i := range results {
+		results[i].Rank = i + 1
+		results[i].Percent = 0
+		if total > 0 {
+			results[i].Percent = float64(results[i].Votes) * 100 / float64(total)
+		}
+		results[i].MarginToNext = 0
+		if i+1 < len(results) {
+			results[i].MarginToNext = results[i].Votes - results[i+1].Votes
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UpdateAction string
+
+const (
+	RetractedUpdate UpdateAction = "retracted"
+	RestoredUpdate  UpdateAction = "restored"
+)
+
+// UpdateEvent is the audit trail of retractions and restorations of an update.
+type UpdateEvent struct {
+	gorm.Model
+	UpdateID uint `gorm:"index"`
+	Action   UpdateAction
+	Actor    string
+	Reason   string
+}
+
+func (db *DB) GetUpdate(id uint) (*Update, error) {
+	var update Update
+	err := db.First(&update, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("update %v not found", id)
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching update %v: %v", id, err)
+	}
+	return &update, nil
+}
+
+// Lists an election's updates, including retracted ones, oldest first.
+func (db *DB) ListUpdates(electionID string) ([]Update, error) {
+	var updates []Update
+	if err := db.Where("election_id = ?", electionID).Order(`"timestamp", id`).Find(&updates).Error; err != nil {
+		return nil, fmt.Errorf("error listing updates for %s: %v", electionID, err)
+	}
+	return updates, nil
+}
+
+func (db *DB) UpdateEvents(updateID uint) ([]UpdateEvent, error) {
+	var events []UpdateEvent
+	if err := db.Where("update_id = ?", updateID).Order("created_at, id").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("error fetching events for update %v: %v", updateID, err)
+	}
+	return events, nil
+}
+
+// Hides an update from results while keeping it, and its tallies, for
+// auditing. The hash stays recorded so the same file isn't loaded again.
+func (db *DB) RetractUpdate(update Update, actor string, reason string) error {
+	if update.RetractedAt != nil {
+		return fmt.Errorf("update %v is already retracted", update.ID)
+	}
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := carryForwardTallies(tx, update); err != nil {
+			return err
+		}
+		if err := tx.Model(&update).Updates(map[string]any{
+			"retracted_at":      now,
+			"retracted_by":      actor,
+			"retraction_reason": reason,
+		}).Error; err != nil {
+			return fmt.Errorf("error retracting update %v: %v", update.ID, err)
+		}
+		return recordUpdateEvent(tx, update, RetractedUpdate, actor, reason)
+	})
+}
+
+// Makes a retracted update visible again.
+func (db *DB) RestoreUpdate(update Update, actor string, reason string) error {
+	if update.RetractedAt == nil {
+		return fmt.Errorf("update %v is not retracted", update.ID)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := pinNextUpdateTallies(tx, update); err != nil {
+			return err
+		}
+		if err := tx.Model(&update).Updates(map[string]any{
+			"retracted_at":      nil,
+			"retracted_by":      "",
+			"retraction_reason": "",
+		}).Error; err != nil {
+			return fmt.Errorf("error restoring update %v: %v", update.ID, err)
+		}
+		return recordUpdateEvent(tx, update, RestoredUpdate, actor, reason)
+	})
+}
+
+// Records the event and recomputes the results of the update's contests.
+func recordUpdateEvent(tx *gorm.DB, update Update, action UpdateAction, actor string, reason string) error {
+	event := UpdateEvent{
+		UpdateID: update.ID,
+		Action:   action,
+		Actor:    actor,
+		Reason:   reason,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return fmt.Errorf("error recording %s event for update %v: %v", action, update.ID, err)
+	}
+	return refreshUpdateResults(tx, update.JurisdictionType, update.ID)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestRestoreUpdateKeepsLaterResults(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		loadTestUpdate(t, store, election, "a", 1, testRecord("Mayor", "Alice", 150), testRecord("Council", "Bob", 10))
+		retracted := loadTestUpdate(t, store, election, "r", 2, testRecord("Mayor", "Alice", 999), testRecord("Council", "Bob", 10))
+		if err := store.RetractUpdate(retracted, "test", "wrong file"); err != nil {
+			t.Fatal(err)
+		}
+		// Mayor is unchanged from the first update, so this update doesn't
+		// store it
+		loadTestUpdate(t, store, election, "n", 3, testRecord("Mayor", "Alice", 150), testRecord("Council", "Bob", 20))
+
+		restored, err := store.GetUpdate(retracted.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RestoreUpdate(*restored, "test", "right file after all"); err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			contest string
+			want    map[string]int
+		}{
+			{"Mayor", map[string]int{"Alice": 150}},
+			{"Council", map[string]int{"Bob": 20}},
+		}
+		for _, test := range tests {
+			if got := currentVotes(t, store, election, test.contest); !maps.Equal(got, test.want) {
+				t.Errorf("%s votes after restoring = %v, want %v", test.contest, got, test.want)
+			}
+		}
+		events, err := store.UpdateEvents(retracted.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[1].Action != RestoredUpdate {
+			t.Errorf("events = %v, want a retraction and a restoration", events)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is a contest matching a search, either by its ballot title and
+// district or by the names of its candidates.
+type SearchResult struct {
+	Contest Contest
+	// The contest's candidates whose names matched, if any
+	Candidates []BallotResponse
+}
+
+const maxSearchResults = 50
+
+// Splits a search into lowercase words, dropping punctuation.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Reports whether text contains every term, ignoring case.
+func matchesTerms(text string, terms []string) bool {
+	text = strings.ToLower(text)
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search text of a contest, which is also used to build the PostgreSQL index.
+const contestSearchText = "ballot_title || ' ' || district"
+
+// Creates the full-text indexes used by Search on PostgreSQL.
+func (db *DB) createSearchIndexes() error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, stmt := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_contests_search ON contests USING gin (to_tsvector('simple', " + contestSearchText + "))",
+		"CREATE INDEX IF NOT EXISTS idx_ballot_responses_search ON ballot_responses USING gin (to_tsvector('simple', name))",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("error creating search index: %v", err)
+		}
+	}
+	return nil
+}
+
+// Finds contests across all elections whose ballot title and district, or
+// one of whose candidates' names, contain every word of the query. The last
+// word may be incomplete. PostgreSQL uses full-text search with prefix
+// matching, other databases fall back to LIKE. Results are ordered by
+// election date, newest first, then ballot title.
+func (db *DB) Search(query string) ([]SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	var contestCond, candidateCond string
+	var args []any
+	if db.Dialector.Name() == "postgres" {
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		tsquery := strings.Join(prefixes, " & ")
+		contestCond = "to_tsvector('simple', " + contestSearchText + ") @@ to_tsquery('simple', ?)"
+		candidateCond = "to_tsvector('simple', name) @@ to_tsquery('simple', ?)"
+		args = []any{tsquery}
+	} else {
+		contestLikes := make([]string, len(terms))
+		candidateLikes := make([]string, len(terms))
+		for i, term := range terms {
+			contestLikes[i] = "LOWER(" + contestSearchText + ") LIKE ?"
+			candidateLikes[i] = "LOWER(name) LIKE ?"
+			args = append(args, "%"+term+"%")
+		}
+		contestCond = strings.Join(contestLikes, " AND ")
+		candidateCond = strings.Join(candidateLikes, " AND ")
+	}
+
+	var candidates []BallotResponse
+	if err := db.Where(candidateCond, args...).Limit(maxSearchResults * 10).Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("error searching candidates: %v", err)
+	}
+	candidateContests := make([]uint, 0, len(candidates))
+	for _, candidate := range candidates {
+		candidateContests = append(candidateContests, candidate.ContestID)
+	}
+
+	var contests []Contest
+	if err := db.Joins("Election").
+		Where(db.Where(contestCond, args...).Or("contests.id IN ?", append(candidateContests, 0))).
+		Order(`"Election".election_date DESC, contests.ballot_title, contests.district`).
+		Limit(maxSearchResults).
+		Find(&contests).Error; err != nil {
+		return nil, fmt.Errorf("error searching contests: %v", err)
+	}
+	return searchResults(contests, candidates), nil
+}
+
+func searchResults(contests []Contest, candidates []BallotResponse) []SearchResult {
+	results := make([]SearchResult, len(contests))
+	for i, contest := range contests {
+		results[i].Contest = contest
+		for _, candidate := range candidates {
+			if candidate.ContestID == contest.ID {
+				results[i].Candidates = append(results[i].Candidates, candidate)
+			}
+		}
+	}
+	return results
+}
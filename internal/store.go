@@ -0,0 +1,93 @@
+package internal
+
+import "time"
+
+// Store is the storage used by the scraper, importer and web app. DB
+// implements it on top of gorm and MemoryStore keeps everything in memory.
+type Store interface {
+	MigrateSchema() error
+
+	// Elections
+	CreateElection(election *Election) error
+	FindElection(slug string) (*Election, error)
+	ListElections(includeArchived bool) ([]Election, error)
+	RenameElection(slug string, name string) error
+	SetElectionStatus(slug string, status ElectionStatus) error
+	SetExpectedTurnout(slug string, percent float64) error
+	SetTopTwo(slug string, topTwo bool) error
+	// Records when an election was certified, or clears it when at is nil
+	CertifyElection(slug string, at *time.Time) error
+	DeleteElection(slug string) error
+	ClearElectionResults(election Election) error
+
+	// Contests and candidates. Contests are returned with their Election, and
+	// candidates with their VoteTallies and each tally's Update.
+	ListContests(electionID string) ([]Contest, error)
+	FindContest(electionID string, contestKey string) (*Contest, error)
+	ContestCandidates(contestID uint) ([]BallotResponse, error)
+	CurrentResults(contestID uint) ([]ContestResult, error)
+	ElectionResults(electionID string) ([]ContestResult, error)
+	CountyTallies(contestID uint) ([]CountyTally, error)
+	PrecinctTallies(contestID uint) ([]PrecinctTally, error)
+	Search(query string) ([]SearchResult, error)
+
+	// Updates and vote tallies
+	LoadUpdate(data []GenericVoteRecord, hash string, timestamp time.Time, election Election) error
+	FindUpdate(hash string, election Election) (*Update, error)
+	DeleteUpdate(update Update) error
+	// Tallies are only stored for contests that changed, Snapshot returns
+	// every candidate's tally in effect as of an update.
+	Snapshot(update Update) ([]VoteTally, error)
+	CompactElection(election Election) (int, error)
+
+	// Retracting an update hides it from results, restoring it brings it back.
+	// Both are recorded as UpdateEvents.
+	GetUpdate(id uint) (*Update, error)
+	ListUpdates(electionID string) ([]Update, error)
+	RetractUpdate(update Update, actor string, reason string) error
+	RestoreUpdate(update Update, actor string, reason string) error
+	UpdateEvents(updateID uint) ([]UpdateEvent, error)
+
+	// Log of the scraper and importer's attempts at loading files. Repeated
+	// unchanged or failed attempts are collapsed into one run.
+	RecordIngestRun(run *IngestRun) error
+	ListIngestRuns(filter IngestRunFilter) ([]IngestRun, error)
+	GetIngestRun(id uint) (*IngestRun, error)
+	PruneIngestRuns(before time.Time) (int, error)
+
+	// Candidates link ballot responses across elections. FindCandidate
+	// returns them with their contests, elections and vote tallies.
+	ListCandidates(query string) ([]Candidate, error)
+	FindCandidate(slug string) (*Candidate, error)
+	MergeCandidates(fromSlug string, intoSlug string) error
+	SplitCandidate(slug string, ballotResponseIDs []uint) (*Candidate, error)
+
+	// Districts are created as contests are loaded, typed and linked to their
+	// parents by name. Setting a parent to "" clears it.
+	ListDistricts() ([]District, error)
+	SetDistrictType(name string, t DistrictType) error
+	SetDistrictParent(name string, parent string) error
+
+	// Classifies every contest of an election again with the rules in
+	// CONTEST_RULES, returning the number whose classification changed.
+	ClassifyContests(electionID string) (int, error)
+
+	// Parties ballot responses are linked to by their stated preference.
+	// Merging a party makes its name an alias of the other, and UpdateParty
+	// leaves "" values unchanged.
+	ListParties() ([]Party, error)
+	UpdateParty(name string, abbreviation string, color string) error
+	MergeParties(from string, into string) error
+
+	// Boundaries of the areas an election's results are mapped by. Loading
+	// boundaries replaces the election's existing ones of that kind.
+	LoadBoundaries(electionID string, kind BoundaryKind, boundaries []Boundary) error
+	Boundaries(electionID string, kind BoundaryKind) ([]Boundary, error)
+	BoundaryCounts(electionID string) (map[BoundaryKind]int, error)
+	DeleteBoundaries(electionID string, kind BoundaryKind) error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,386 @@
+package internal
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Every Store implementation, so that both backends run the same tests.
+var testStoreKinds = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+	{"sqlite", func(t *testing.T) Store { return openTestSQLite(t) }},
+}
+
+// Runs fn against a new store of every kind.
+func forEachStore(t *testing.T, fn func(t *testing.T, store Store)) {
+	t.Helper()
+	for _, kind := range testStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			fn(t, kind.open(t))
+		})
+	}
+}
+
+var testElectionDate = time.Date(2024, time.November, 5, 0, 0, 0, 0, time.UTC)
+
+func createTestElection(t *testing.T, store Store) Election {
+	t.Helper()
+	election := Election{ID: "2024_general", Name: "2024 General", ElectionDate: testElectionDate, Type: GeneralElection}
+	if err := store.CreateElection(&election); err != nil {
+		t.Fatal(err)
+	}
+	return election
+}
+
+// A county record for a candidate in a contest of the test election.
+func testRecord(title string, candidate string, votes int) GenericVoteRecord {
+	return GenericVoteRecord{
+		DistrictName:     "King County",
+		BallotTitle:      title,
+		BallotResponse:   candidate,
+		Votes:            votes,
+		JurisdictionType: CountyJurisdiction,
+	}
+}
+
+// Loads records as an update timestamped hours after election night.
+func loadTestUpdate(t *testing.T, store Store, election Election, hash string, hours int, records ...GenericVoteRecord) Update {
+	t.Helper()
+	if err := store.LoadUpdate(records, hash, testElectionDate.Add(time.Duration(hours)*time.Hour), election); err != nil {
+		t.Fatal(err)
+	}
+	update, err := store.FindUpdate(hash, election)
+	if err != nil || update == nil {
+		t.Fatalf("update %s not found: %v", hash, err)
+	}
+	return *update
+}
+
+// Returns the current votes of each candidate in a contest of the test
+// election.
+func currentVotes(t *testing.T, store Store, election Election, title string) map[string]int {
+	t.Helper()
+	contest, err := store.FindContest(election.ID, getContestKey(title, "King County"))
+	if err != nil || contest == nil {
+		t.Fatalf("contest %s not found: %v", title, err)
+	}
+	results, err := store.CurrentResults(contest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	votes := make(map[string]int)
+	for _, result := range results {
+		votes[result.BallotResponse.Name] = result.Votes
+	}
+	return votes
+}
+
+func TestStoreElections(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		for _, election := range []Election{
+			{ID: "2022_general", Name: "2022 General", ElectionDate: testElectionDate.AddDate(-2, 0, 0), Type: GeneralElection},
+			{ID: "2024_primary", Name: "2024 Primary", ElectionDate: testElectionDate.AddDate(0, -3, 0), Type: PrimaryElection},
+			{ID: "2024_general", Name: "2024 General", ElectionDate: testElectionDate, Type: GeneralElection},
+		} {
+			if err := store.CreateElection(&election); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.CreateElection(&Election{ID: "2024_general", Name: "Again", ElectionDate: testElectionDate, Type: GeneralElection}); err == nil {
+			t.Error("creating an election twice succeeded")
+		}
+		for _, slug := range reservedSlugs {
+			if err := store.CreateElection(&Election{ID: slug, Name: slug, ElectionDate: testElectionDate, Type: GeneralElection}); err == nil {
+				t.Errorf("creating an election with the reserved slug %s succeeded", slug)
+			}
+		}
+		if err := store.SetElectionStatus("2022_general", ArchivedElection); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RenameElection("2024_primary", "August Primary"); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			includeArchived bool
+			want            []string
+		}{
+			{false, []string{"2024_general", "2024_primary"}},
+			{true, []string{"2024_general", "2024_primary", "2022_general"}},
+		}
+		for _, test := range tests {
+			elections, err := store.ListElections(test.includeArchived)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, election := range elections {
+				got = append(got, election.ID)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ListElections(%v) = %v, want %v", test.includeArchived, got, test.want)
+			}
+		}
+
+		primary, err := store.FindElection("2024_primary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if primary.Name != "August Primary" || primary.Status != ActiveElection {
+			t.Errorf("primary = %q %s, want \"August Primary\" active", primary.Name, primary.Status)
+		}
+		if _, err := store.FindElection("1999_general"); err == nil {
+			t.Error("finding an unknown election succeeded")
+		}
+		if err := store.DeleteElection("2022_general"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.FindElection("2022_general"); err == nil {
+			t.Error("finding a deleted election succeeded")
+		}
+	})
+}
+
+func TestStoreLoadUpdate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		first := loadTestUpdate(t, store, election, "first", 1,
+			testRecord("Mayor", "Alice", 150), testRecord("Mayor", "Bob", 100),
+			testRecord("Council", "Carol", 80), testRecord("Council", "Dan", 90))
+		// Council is unchanged, so the second update only stores Mayor
+		second := loadTestUpdate(t, store, election, "second", 2,
+			testRecord("Mayor", "Alice", 160), testRecord("Mayor", "Bob", 170),
+			testRecord("Council", "Carol", 80), testRecord("Council", "Dan", 90))
+
+		contests, err := store.ListContests(election.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(contests) != 2 {
+			t.Fatalf("got %d contests, want 2", len(contests))
+		}
+
+		tests := []struct {
+			name   string
+			update Update
+			want   map[string]int
+		}{
+			{"first", first, map[string]int{"Alice": 150, "Bob": 100, "Carol": 80, "Dan": 90}},
+			{"second", second, map[string]int{"Alice": 160, "Bob": 170, "Carol": 80, "Dan": 90}},
+		}
+		for _, test := range tests {
+			snapshot, err := store.Snapshot(test.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]int)
+			for _, tally := range snapshot {
+				got[tally.BallotResponse.Name] = tally.Votes
+			}
+			if !maps.Equal(got, test.want) {
+				t.Errorf("snapshot of the %s update = %v, want %v", test.name, got, test.want)
+			}
+		}
+
+		contest, err := store.FindContest(election.ID, getContestKey("Mayor", "King County"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := store.CurrentResults(contest.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.SortFunc(results, func(a, b ContestResult) int { return a.Rank - b.Rank })
+		if len(results) != 2 || results[0].BallotResponse.Name != "Bob" || results[0].MarginToNext != 10 || results[0].UpdateID != second.ID {
+			t.Errorf("results = %+v, want Bob first by 10 votes as of the second update", results)
+		}
+
+		candidates, err := store.ContestCandidates(contest.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, candidate := range candidates {
+			if len(candidate.VoteTallies) != 2 {
+				t.Errorf("%s has %d tallies, want 2", candidate.Name, len(candidate.VoteTallies))
+			}
+		}
+
+		// Loading the same file is left to the caller, see LoadNewUpdate
+		if update, err := store.FindUpdate("second", election); err != nil || update == nil || update.ID != second.ID {
+			t.Errorf("FindUpdate(second) = %v, %v", update, err)
+		}
+		if update, err := store.FindUpdate("third", election); err != nil || update != nil {
+			t.Errorf("FindUpdate(third) = %v, %v, want nil", update, err)
+		}
+	})
+}
+
+func TestStoreDeleteUpdate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		first := loadTestUpdate(t, store, election, "first", 1, testRecord("Mayor", "Alice", 150), testRecord("Council", "Carol", 80))
+		loadTestUpdate(t, store, election, "second", 2, testRecord("Mayor", "Alice", 160), testRecord("Council", "Carol", 80))
+		if err := store.DeleteUpdate(first); err != nil {
+			t.Fatal(err)
+		}
+		// Council's only tally was in the first update, it moves to the second
+		tests := []struct {
+			contest string
+			want    map[string]int
+		}{
+			{"Mayor", map[string]int{"Alice": 160}},
+			{"Council", map[string]int{"Carol": 80}},
+		}
+		for _, test := range tests {
+			if got := currentVotes(t, store, election, test.contest); !maps.Equal(got, test.want) {
+				t.Errorf("%s votes = %v, want %v", test.contest, got, test.want)
+			}
+		}
+	})
+}
+
+func TestStoreCurrentResultsByUpdate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		state := func(title string, candidate string, votes int) GenericVoteRecord {
+			record := testRecord(title, candidate, votes)
+			record.JurisdictionType = StateJurisdiction
+			return record
+		}
+		loadTestUpdate(t, store, election, "state-1", 1, state("Mayor", "Alice", 100), state("Council", "Bob", 50))
+		loadTestUpdate(t, store, election, "county-1", 2, testRecord("Mayor", "Alice", 110))
+		if got := currentVotes(t, store, election, "Mayor"); got["Alice"] != 110 {
+			t.Errorf("votes after the county update = %v, want the county's", got)
+		}
+		// The state reports Mayor unchanged, so the update has no tallies for it
+		stateUpdate := loadTestUpdate(t, store, election, "state-2", 3, state("Mayor", "Alice", 100), state("Council", "Bob", 60))
+		if got := currentVotes(t, store, election, "Mayor"); got["Alice"] != 100 {
+			t.Errorf("votes after the state update = %v, want the state's", got)
+		}
+		results, err := store.ElectionResults(election.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			if result.JurisdictionType != StateJurisdiction {
+				t.Errorf("%s results come from the %s", result.Contest.BallotTitle, result.JurisdictionType)
+			}
+		}
+
+		// Without the state's latest update the county's is the most recent
+		if err := store.RetractUpdate(stateUpdate, "clerk", "wrong file"); err != nil {
+			t.Fatal(err)
+		}
+		if got := currentVotes(t, store, election, "Mayor"); got["Alice"] != 110 {
+			t.Errorf("votes after retracting the state update = %v, want the county's", got)
+		}
+	})
+}
+
+func TestStoreDeleteElectionCandidates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		primary := Election{ID: "2024_primary", Name: "2024 Primary", ElectionDate: testElectionDate.AddDate(0, -3, 0), Type: PrimaryElection}
+		if err := store.CreateElection(&primary); err != nil {
+			t.Fatal(err)
+		}
+		loadTestUpdate(t, store, primary, "primary", 1, testRecord("Mayor", "Alice Smith", 90), testRecord("Mayor", "Carol White", 40))
+		loadTestUpdate(t, store, election, "general", 1, testRecord("Mayor", "Alice Smith", 150))
+		if err := store.DeleteElection(primary.ID); err != nil {
+			t.Fatal(err)
+		}
+		candidates, err := store.ListCandidates("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, candidate := range candidates {
+			names = append(names, candidate.Name)
+		}
+		if want := []string{"Alice Smith"}; !slices.Equal(names, want) {
+			t.Errorf("candidates = %v, want %v", names, want)
+		}
+		if candidate, err := store.FindCandidate("carol-white"); err == nil && candidate != nil {
+			t.Error("found carol-white after deleting the only election they ran in")
+		}
+	})
+}
+
+func TestStoreLinkCandidates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		loadTestUpdate(t, store, election, "first", 1,
+			testRecord("Mayor", "Alice Smith", 150), testRecord("Council", "Alice J. Smith", 20),
+			testRecord("Prop 1", "Yes", 300), testRecord("Prop 1", "No", 200))
+		if err := store.MergeCandidates("alice-j-smith", "alice-smith"); err != nil {
+			t.Fatal(err)
+		}
+		loadTestUpdate(t, store, election, "second", 2, testRecord("Levy", "Alice J. Smith", 30), testRecord("Levy", "Levy No", 10))
+
+		want := map[string]map[string]string{
+			"Mayor":  {"Alice Smith": "alice-smith"},
+			"Prop 1": {"Yes": "", "No": ""},
+			"Levy":   {"Alice J. Smith": "alice-smith", "Levy No": ""},
+		}
+		for title, responses := range want {
+			contest, err := store.FindContest(election.ID, getContestKey(title, "King County"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			candidates, err := store.ContestCandidates(contest.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, candidate := range candidates {
+				slug := ""
+				if candidate.Candidate != nil {
+					slug = candidate.Candidate.Slug
+				}
+				if slug != responses[candidate.Name] {
+					t.Errorf("%s in %s linked to %q, want %q", candidate.Name, title, slug, responses[candidate.Name])
+				}
+				if candidate.NotCandidate != (responses[candidate.Name] == "") {
+					t.Errorf("%s in %s has NotCandidate %v", candidate.Name, title, candidate.NotCandidate)
+				}
+			}
+		}
+	})
+}
+
+func TestStoreSearch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		election := createTestElection(t, store)
+		loadTestUpdate(t, store, election, "first", 1, testRecord("Mayor", "Alice Smith", 150), testRecord("Council", "Bob Jones", 80))
+		tests := []struct {
+			query      string
+			contests   []string
+			candidates []string
+		}{
+			{"smith", []string{"Mayor"}, []string{"Alice Smith"}},
+			{"council", []string{"Council"}, nil},
+			{"nobody", nil, nil},
+			{"", nil, nil},
+		}
+		for _, test := range tests {
+			results, err := store.Search(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var contests, candidates []string
+			for _, result := range results {
+				contests = append(contests, result.Contest.BallotTitle)
+				for _, candidate := range result.Candidates {
+					candidates = append(candidates, candidate.Name)
+				}
+			}
+			if !slices.Equal(contests, test.contests) || !slices.Equal(candidates, test.candidates) {
+				t.Errorf("Search(%q) = %v %v, want %v %v", test.query, contests, candidates, test.contests, test.candidates)
+			}
+		}
+	})
+}
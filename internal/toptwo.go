@@ -0,0 +1,75 @@
+package internal
+
+import "slices"
+
+// TopTwo is where a contest in a top-two primary stands. The first two
+// candidates advance to the general election regardless of party.
+type TopTwo struct {
+	// First and second place
+	Advancing []ContestResult
+	// Third place, nil when only two candidates ran
+	Third *ContestResult
+	// Votes between second and third place
+	Gap int
+	// Gap as a percentage of the votes cast for second and third place
+	GapPercent float64
+}
+
+// Reports whether the candidate is in the top two.
+func (t TopTwo) Advances(ballotResponseID uint) bool {
+	return slices.ContainsFunc(t.Advancing, func(r ContestResult) bool { return r.BallotResponseID == ballotResponseID })
+}
+
+// Reports whether third place can no longer catch second place with
+// outstanding ballots left to count.
+func (t TopTwo) Settled(outstanding int) bool {
+	return t.Third == nil || t.Gap > outstanding
+}
+
+// Works out the top two of a contest from its current results, ordered by
+// rank. Write-ins are skipped since they're counted together. Returns nil for
+// measures and for contests with fewer than two candidates.
+func CheckTopTwo(results []ContestResult) *TopTwo {
+	var candidates []ContestResult
+	for _, result := range results {
+		if isCandidateName(result.BallotResponse.Name) {
+			candidates = append(candidates, result)
+		}
+	}
+	if len(candidates) < 2 {
+		return nil
+	}
+	t := &TopTwo{Advancing: candidates[:2]}
+	if len(candidates) > 2 {
+		t.Third = &candidates[2]
+		t.Gap = candidates[1].Votes - candidates[2].Votes
+		if total := candidates[1].Votes + candidates[2].Votes; total > 0 {
+			t.GapPercent = float64(t.Gap) * 100 / float64(total)
+		}
+	}
+	return t
+}
+
+// Returns the top two of each contest, keyed by contest ID. results are an
+// election's current results, as returned by ElectionResults.
+func ElectionTopTwo(results []ContestResult) map[uint]TopTwo {
+	topTwo := make(map[uint]TopTwo)
+	for contestID, contestResults := range resultsByContest(results) {
+		if t := CheckTopTwo(contestResults); t != nil {
+			topTwo[contestID] = *t
+		}
+	}
+	return topTwo
+}
+
+// Groups results by contest, each ordered by rank.
+func resultsByContest(results []ContestResult) map[uint][]ContestResult {
+	byContest := make(map[uint][]ContestResult)
+	for _, result := range results {
+		byContest[result.ContestID] = append(byContest[result.ContestID], result)
+	}
+	for _, contestResults := range byContest {
+		slices.SortFunc(contestResults, func(a, b ContestResult) int { return a.Rank - b.Rank })
+	}
+	return byContest
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheckTopTwo(t *testing.T) {
+	tests := []struct {
+		name       string
+		names      []string
+		votes      []int
+		advancing  []string
+		third      string
+		gap        int
+		gapPercent float64
+		none       bool
+	}{
+		{name: "clear second", names: []string{"Alice", "Bob", "Carol"}, votes: []int{500, 300, 200}, advancing: []string{"Alice", "Bob"}, third: "Carol", gap: 100, gapPercent: 20},
+		{name: "tie for second", names: []string{"Alice", "Bob", "Carol"}, votes: []int{500, 300, 300}, advancing: []string{"Alice", "Bob"}, third: "Carol", gap: 0, gapPercent: 0},
+		{name: "tie for first", names: []string{"Alice", "Bob", "Carol"}, votes: []int{400, 400, 200}, advancing: []string{"Alice", "Bob"}, third: "Carol", gap: 200, gapPercent: 200.0 * 100 / 600},
+		{name: "two candidates", names: []string{"Alice", "Bob"}, votes: []int{500, 300}, advancing: []string{"Alice", "Bob"}},
+		{name: "write-ins skipped", names: []string{"Alice", "Write-in", "Bob"}, votes: []int{500, 400, 300}, advancing: []string{"Alice", "Bob"}},
+		{name: "no votes", names: []string{"Alice", "Bob", "Carol"}, votes: []int{0, 0, 0}, advancing: []string{"Alice", "Bob"}, third: "Carol"},
+		{name: "measure", names: []string{"Yes", "No"}, votes: []int{500, 300}, none: true},
+		{name: "levy", names: []string{"Levy Yes", "Levy No"}, votes: []int{500, 300}, none: true},
+		{name: "one candidate and write-ins", names: []string{"Alice", "Write-in"}, votes: []int{500, 10}, none: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := CheckTopTwo(testContestResults(1, test.names, test.votes...))
+			if test.none {
+				if got != nil {
+					t.Errorf("CheckTopTwo = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("CheckTopTwo = nil")
+			}
+			var advancing []string
+			for _, result := range got.Advancing {
+				advancing = append(advancing, result.BallotResponse.Name)
+				if !got.Advances(result.BallotResponseID) {
+					t.Errorf("Advances(%s) = false", result.BallotResponse.Name)
+				}
+			}
+			third := ""
+			if got.Third != nil {
+				third = got.Third.BallotResponse.Name
+				if got.Advances(got.Third.BallotResponseID) {
+					t.Errorf("Advances(%s) = true for third place", third)
+				}
+			}
+			if !slices.Equal(advancing, test.advancing) || third != test.third || got.Gap != test.gap || got.GapPercent != test.gapPercent {
+				t.Errorf("CheckTopTwo = %v, third %q, gap %d (%v%%); want %v, %q, %d (%v%%)",
+					advancing, third, got.Gap, got.GapPercent, test.advancing, test.third, test.gap, test.gapPercent)
+			}
+		})
+	}
+}
+
+func TestTopTwoSettled(t *testing.T) {
+	third := ContestResult{}
+	tests := []struct {
+		name        string
+		topTwo      TopTwo
+		outstanding int
+		want        bool
+	}{
+		{"no third", TopTwo{}, 1000, true},
+		{"gap over outstanding", TopTwo{Third: &third, Gap: 100}, 99, true},
+		{"gap equal to outstanding", TopTwo{Third: &third, Gap: 100}, 100, false},
+		{"tie with nothing outstanding", TopTwo{Third: &third, Gap: 0}, 0, false},
+		{"gap with nothing outstanding", TopTwo{Third: &third, Gap: 1}, 0, true},
+	}
+	for _, test := range tests {
+		if got := test.topTwo.Settled(test.outstanding); got != test.want {
+			t.Errorf("%s: Settled(%d) = %v, want %v", test.name, test.outstanding, got, test.want)
+		}
+	}
+}
+
+func TestOutstandingBallots(t *testing.T) {
+	// 20000 ballots counted of 100000 registered voters
+	counted := projectionCandidates([2]int{6000, 4000}, [2]int{12000, 8000})
+	unreported := projectionCandidates([2]int{6000, 4000})
+	for i := range unreported {
+		unreported[i].VoteTallies[0].BallotsCounted = 0
+	}
+	tests := []struct {
+		name            string
+		candidates      []BallotResponse
+		expectedTurnout float64
+		outstanding     int
+		ok              bool
+	}{
+		{"ballots left", counted, 40, 20000, true},
+		{"count at the expected turnout", counted, 20, 0, true},
+		{"count past the expected turnout", counted, 10, 0, true},
+		{"no expected turnout", counted, 0, 0, false},
+		{"negative expected turnout", counted, -5, 0, false},
+		{"ballots counted not reported", unreported, 40, 0, false},
+		{"no tallies", []BallotResponse{{Name: "Alice"}}, 40, 0, false},
+	}
+	for _, test := range tests {
+		outstanding, ok := OutstandingBallots(test.candidates, test.expectedTurnout)
+		if outstanding != test.outstanding || ok != test.ok {
+			t.Errorf("%s: OutstandingBallots = %d, %v; want %d, %v", test.name, outstanding, ok, test.outstanding, test.ok)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package internal
 
 import (
+	"cmp"
+	"database/sql/driver"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 // StateCSVRecord represents the structure of each row in the state CSV file
@@ -15,6 +19,8 @@ type StateCSVRecord struct {
 	Votes                  int     `csv:"Votes"`
 	PercentageOfTotalVotes float64 `csv:"PercentageOfTotalVotes"`
 	JurisdictionName       string  `csv:"JurisdictionName"`
+	// Only in the per-county results file
+	County string `csv:"County"`
 }
 
 func (rec StateCSVRecord) ToGeneric() GenericVoteRecord {
@@ -27,6 +33,8 @@ func (rec StateCSVRecord) ToGeneric() GenericVoteRecord {
 		Votes:            rec.Votes,
 		PartyPreference:  extractParty(rec.Party),
 		JurisdictionType: StateJurisdiction,
+		County:           cmp.Or(countyName(rec.County), countyName(rec.JurisdictionName)),
+		DistrictHeading:  stateDistrictHeading(rec.JurisdictionName),
 	}
 }
 
@@ -57,9 +65,27 @@ func (rec CountyCSVRecord) ToGeneric() GenericVoteRecord {
 		Votes:            rec.Votes,
 		PartyPreference:  extractParty(rec.PartyPreference),
 		JurisdictionType: CountyJurisdiction,
+		DistrictHeading:  strings.TrimSpace(rec.DistrictType + " " + rec.DistrictTypeSubheading),
+		BallotsCounted:   rec.BallotsCountedForDistrict,
+		RegisteredVoters: rec.RegisteredVotersForDistrict,
 	}
 }
 
+// PrecinctCSVRecord represents the structure of each row in the county's
+// precinct results file. CounterType is a candidate's name or a count such as
+// Registered Voters.
+type PrecinctCSVRecord struct {
+	Precinct     string `csv:"Precinct"`
+	Race         string `csv:"Race"`
+	LEG          string `csv:"LEG"`
+	CC           string `csv:"CC"`
+	CG           string `csv:"CG"`
+	CounterGroup string `csv:"CounterGroup"`
+	Party        string `csv:"Party"`
+	CounterType  string `csv:"CounterType"`
+	SumOfCount   int    `csv:"SumOfCount"`
+}
+
 type GenericVoteRecord struct {
 	DistrictName     string
 	BallotTitle      string
@@ -68,6 +94,22 @@ type GenericVoteRecord struct {
 	VotePercentage   float32
 	PartyPreference  string
 	JurisdictionType JurisdictionType
+	// Ballots counted and registered voters in the contest's district, only
+	// reported by the county
+	BallotsCounted   int
+	RegisteredVoters int
+	// County the record is limited to in the state's per-county results, ""
+	// for a contest's totals
+	County string
+	// Precinct of a precinct results record, with an empty Name otherwise
+	Precinct Precinct
+	// Heading the source file lists the district under, used to tell its
+	// type: the county's District Type and subheading, or the state's
+	// JurisdictionName
+	DistrictHeading string
+	// Row of the source file the record came from, counting the header as
+	// row 1. 0 when the record didn't come from a file.
+	Row int
 }
 
 type JurisdictionType string
@@ -75,49 +117,127 @@ type JurisdictionType string
 const (
 	StateJurisdiction  JurisdictionType = "State"
 	CountyJurisdiction JurisdictionType = "County"
+	// The county's precinct results, which break down its contests
+	PrecinctJurisdiction JurisdictionType = "Precinct"
+)
+
+type ElectionType string
+
+const (
+	PrimaryElection ElectionType = "primary"
+	GeneralElection ElectionType = "general"
+	SpecialElection ElectionType = "special"
+)
+
+type ElectionStatus string
+
+const (
+	ActiveElection   ElectionStatus = "active"
+	ArchivedElection ElectionStatus = "archived"
 )
 
+// StringArray is a list of strings stored as a text[] column in PostgreSQL
+// and as the same array literal ({a,b}) in a text column elsewhere.
+type StringArray []string
+
+func (StringArray) GormDataType() string {
+	return "string_array"
+}
+
+func (StringArray) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "text[]"
+	}
+	return "text"
+}
+
+func (a *StringArray) Scan(src any) error {
+	return (*pq.StringArray)(a).Scan(src)
+}
+
+func (a StringArray) Value() (driver.Value, error) {
+	return pq.StringArray(a).Value()
+}
+
 // Structs to represent the data in DB
 type Election struct {
 	gorm.Model
-	ID           string
+	// ID is the election's slug (2024_primary), used in URLs and to reference
+	// the election from the scraper and importer.
+	ID           string `gorm:"primaryKey"`
 	Name         string
 	ElectionDate time.Time
+	Type         ElectionType
+	Status       ElectionStatus   `gorm:"default:active"`
 	Contests     []Contest        `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
 	Updates      []Update         `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
 	Candidates   []BallotResponse `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
+	IngestRuns   []IngestRun      `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
+	Boundaries   []Boundary       `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
+	// Expected final turnout as a percentage of registered voters, used to
+	// estimate the ballots left to count. 0 when unknown.
+	ExpectedTurnout float64
+	// Whether the election is a top-two primary, where the first two
+	// candidates in each contest advance regardless of party
+	TopTwo bool
+	// When the results were certified, nil until then
+	CertifiedAt *time.Time
 }
 
+// Contests are identified by their ContestKey within an election, so the same
+// race title can appear in many elections.
 type Contest struct {
 	gorm.Model
 	BallotTitle     string
 	District        string
-	ContestKey      string           `gorm:"index"`
-	Jurisdictions   pq.StringArray   `gorm:"type:text[]"`
+	ContestKey      string `gorm:"uniqueIndex:idx_contest_election_key"`
+	Jurisdictions   StringArray
 	BallotResponses []BallotResponse `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
-	ElectionID      string
+	ElectionID      string           `gorm:"uniqueIndex:idx_contest_election_key"`
 	Election        Election
+	// Kind of office and level of government, set by the contest rules when
+	// the contest is first loaded
+	Category ContestCategory `gorm:"index"`
+	Level    ContestLevel    `gorm:"index"`
 }
 
+// Ballot responses (candidates, or yes/no on a measure) are identified by
+// their name within a contest.
 type BallotResponse struct {
 	gorm.Model
-	Name        string
+	Name        string `gorm:"uniqueIndex:idx_ballot_response_contest_name"`
 	Party       *string
-	ContestID   uint
+	ContestID   uint `gorm:"uniqueIndex:idx_ballot_response_contest_name"`
 	Contest     Contest
 	VoteTallies []VoteTally `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
-	ElectionID  string
+	ElectionID  string      `gorm:"index"`
 	Election    Election
+	// The person behind the response across elections, nil for measure
+	// choices like Yes and No
+	CandidateID *uint      `gorm:"index"`
+	Candidate   *Candidate `gorm:"constraint:OnDelete:SET NULL"`
+	// Set on measure choices and placeholders once linking has skipped them,
+	// so that later loads don't look at them again
+	NotCandidate bool `gorm:"not null;default:false"`
+	// The canonical party matching the preference in Party as the source file
+	// states it, nil when no party is stated
+	PartyID        *uint  `gorm:"index"`
+	CanonicalParty *Party `gorm:"foreignKey:PartyID;constraint:OnDelete:SET NULL"`
 }
 
 type Update struct {
 	gorm.Model
 	Timestamp        time.Time
-	Hash             string `gorm:"uniqueIndex"`
+	Hash             string `gorm:"uniqueIndex:idx_update_election_hash"`
 	JurisdictionType JurisdictionType
 	VoteTallies      []VoteTally `gorm:"constraint:OnDelete:CASCADE,onUpdate:CASCADE"`
-	ElectionID       string
+	ElectionID       string      `gorm:"uniqueIndex:idx_update_election_hash"`
 	Election         Election
+	// A retracted update is kept for auditing but hidden from results
+	RetractedAt      *time.Time
+	RetractedBy      string
+	RetractionReason string
+	Events           []UpdateEvent `gorm:"constraint:OnDelete:CASCADE"`
 }
 
 // func (u *Update) BeforeDelete(tx *gorm.DB) (err error) {
@@ -139,4 +259,8 @@ type VoteTally struct {
 	Update           Update `gorm:"constraint:OnDelete:CASCADE"`
 	Votes            int
 	VotePercentage   float32
+	// Ballots counted and registered voters in the contest's district as of
+	// the update, 0 when the source file doesn't report them
+	BallotsCounted   int
+	RegisteredVoters int
 }
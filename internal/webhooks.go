@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Webhooks are URLs that are sent a JSON POST whenever an update is retracted
+// or restored, so that caches and feeds built on the results can drop or bring
+// back its numbers.
+type Webhooks []string
+
+// UpdateNotification is the body posted to webhooks.
+type UpdateNotification struct {
+	Action       UpdateAction     `json:"action"`
+	UpdateID     uint             `json:"update_id"`
+	ElectionID   string           `json:"election_id"`
+	Jurisdiction JurisdictionType `json:"jurisdiction"`
+	Timestamp    time.Time        `json:"timestamp"`
+	Hash         string           `json:"hash"`
+	Actor        string           `json:"actor"`
+	Reason       string           `json:"reason"`
+}
+
+func NewUpdateNotification(update Update, action UpdateAction, actor string, reason string) UpdateNotification {
+	return UpdateNotification{
+		Action:       action,
+		UpdateID:     update.ID,
+		ElectionID:   update.ElectionID,
+		Jurisdiction: update.JurisdictionType,
+		Timestamp:    update.Timestamp,
+		Hash:         update.Hash,
+		Actor:        actor,
+		Reason:       reason,
+	}
+}
+
+// Parses a comma separated list of http(s) URLs.
+func ParseWebhooks(s string) (Webhooks, error) {
+	var webhooks Webhooks
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		u, err := url.Parse(field)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q", field)
+		}
+		webhooks = append(webhooks, field)
+	}
+	return webhooks, nil
+}
+
+// Returns the webhooks set in the UPDATE_WEBHOOKS environment variable.
+func WebhooksFromEnv() (Webhooks, error) {
+	return ParseWebhooks(os.Getenv("UPDATE_WEBHOOKS"))
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Posts the notification to every webhook, returning the failures of those
+// that didn't answer with a 2xx status.
+func (w Webhooks) Notify(ctx context.Context, notification UpdateNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %v", err)
+	}
+	var errs []error
+	for _, webhook := range w {
+		if err := postWebhook(ctx, webhook, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func postWebhook(ctx context.Context, webhook string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error notifying %s: %v", webhook, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error notifying %s: %v", webhook, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error notifying %s: %s", webhook, resp.Status)
+	}
+	return nil
+}
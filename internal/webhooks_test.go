@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseWebhooks(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Webhooks
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"https://example.com/hook", Webhooks{"https://example.com/hook"}, false},
+		{" http://a.test/x , https://b.test/y ,", Webhooks{"http://a.test/x", "https://b.test/y"}, false},
+		{"ftp://example.com", nil, true},
+		{"example.com/hook", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseWebhooks(test.s)
+		if !slices.Equal(got, test.want) || (err != nil) != test.wantErr {
+			t.Errorf("ParseWebhooks(%q) = %v, %v; want %v, error %v", test.s, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestWebhooksNotify(t *testing.T) {
+	var received []UpdateNotification
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var notification UpdateNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Error(err)
+		}
+		received = append(received, notification)
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	update := Update{Hash: "abc", ElectionID: "2024_general", JurisdictionType: CountyJurisdiction, Timestamp: testElectionDate}
+	update.ID = 42
+	notification := NewUpdateNotification(update, RetractedUpdate, "clerk", "bad file")
+
+	if err := (Webhooks{ok.URL}).Notify(context.Background(), notification); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0] != notification {
+		t.Errorf("received %+v, want %+v", received, notification)
+	}
+
+	err := (Webhooks{failing.URL, ok.URL}).Notify(context.Background(), notification)
+	if err == nil || !strings.Contains(err.Error(), failing.URL) {
+		t.Errorf("error = %v, want one naming %s", err, failing.URL)
+	}
+	if len(received) != 2 {
+		t.Errorf("a failing webhook stopped the others from being notified")
+	}
+}